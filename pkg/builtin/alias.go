@@ -0,0 +1,370 @@
+package builtin
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/proto/alias_file"
+)
+
+// There are two kinds of user defined aliases, they are saved in different files:
+//   - abbrs: extra abbrs of the last segment of a command path, registered to the parent of the command
+//   - aliases: full command paths from root, resolved to the target commands
+type userAliasKind struct {
+	abbr     bool
+	name     string
+	plural   string
+	fileKey  string
+	cmdGroup string
+}
+
+var (
+	userAbbrs   = userAliasKind{true, "abbr", "abbrs", "strs.abbrs-file-name", "cmds.abbrs"}
+	userAliases = userAliasKind{false, "alias", "aliases", "strs.aliases-file-name", "cmds.alias"}
+)
+
+// Apply the user defined abbrs and aliases to the command tree, it runs at the end of bootstrap (after the hub is loaded).
+// The ones of not-loaded commands are ignored, the conflicted ones are skipped and reported as tolerable errors
+func LoadAliases(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	for _, kind := range []userAliasKind{userAbbrs, userAliases} {
+		path := kind.filePath(env, flow.Cmds[currCmdIdx])
+		for _, alias := range alias_file.ReadAliasFile(path, env.GetRaw("strs.proto-sep")) {
+			cmd := cc.Cmds.GetSub(strings.Split(alias.CmdPath, cc.Cmds.Strs.PathSep)...)
+			if cmd == nil || cmd.IsRoot() {
+				continue
+			}
+			err := kind.apply(cc.Cmds, cmd, alias.Name)
+			if err != nil {
+				cc.TolerableErrs.OnErr(err, path, path,
+					fmt.Sprintf("user defined %s is not applied (remove it by '%s.remove')",
+						kind.name, kind.cmdGroup))
+			}
+		}
+	}
+	return currCmdIdx, true
+}
+
+func ListAbbrs(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAbbrs.list(cc, env, flow, currCmdIdx)
+}
+
+func ListAliases(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAliases.list(cc, env, flow, currCmdIdx)
+}
+
+func AddAbbrs(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAbbrs.add(argv, cc, env, flow, currCmdIdx)
+}
+
+func AddAliases(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAliases.add(argv, cc, env, flow, currCmdIdx)
+}
+
+func RemoveAbbrs(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAbbrs.remove(argv, cc, env, flow, currCmdIdx)
+}
+
+func RemoveAliases(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return userAliases.remove(argv, cc, env, flow, currCmdIdx)
+}
+
+func (self userAliasKind) list(
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	path := self.filePath(env, flow.Cmds[currCmdIdx])
+	aliases := alias_file.ReadAliasFile(path, env.GetRaw("strs.proto-sep"))
+	if len(aliases) == 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			"no user defined "+self.plural+".",
+			"",
+			"add "+self.plural+" to a command by:",
+			"",
+			display.SuggestAddAlias(env, self.abbr))
+		return currCmdIdx, true
+	}
+
+	display.PrintTipTitle(cc.Screen, env, "user defined "+self.plural+":")
+	var paths []string
+	grouped := map[string][]string{}
+	for _, alias := range aliases {
+		if _, ok := grouped[alias.CmdPath]; !ok {
+			paths = append(paths, alias.CmdPath)
+		}
+		grouped[alias.CmdPath] = append(grouped[alias.CmdPath], alias.Name)
+	}
+	for _, cmdPath := range paths {
+		self.print(cc, env, cmdPath, grouped[cmdPath])
+	}
+	return currCmdIdx, true
+}
+
+func (self userAliasKind) add(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	parsedCmd := flow.Cmds[currCmdIdx]
+
+	cmd := getAliasCmd(argv, cc, parsedCmd)
+	if cmd == nil {
+		panic(core.NewCmdError(parsedCmd, fmt.Sprintf("command '%s' not found", argv.GetRaw("cmd-path"))))
+	}
+	cmdPath := cmd.DisplayPath()
+	names := self.parse(getAndCheckArg(argv, parsedCmd, self.plural), cc, env, parsedCmd)
+
+	path := self.filePath(env, parsedCmd)
+	sep := env.GetRaw("strs.proto-sep")
+	aliases := alias_file.ReadAliasFile(path, sep)
+	// The saved ones of all commands, the ones of not loaded commands are not in the command tree
+	saved := map[alias_file.Alias]bool{}
+	// An alias is a full path, it can't be saved for two commands, an abbr only matters under its parent
+	savedAliases := map[string]string{}
+	for _, alias := range aliases {
+		saved[alias] = true
+		savedAliases[alias.Name] = alias.CmdPath
+	}
+
+	var added []string
+	for _, name := range names {
+		alias := alias_file.Alias{cmdPath, name}
+		// Skip the existing ones, include the ones registered by repos
+		if saved[alias] || self.applied(cc.Cmds, cmd, name) {
+			continue
+		}
+		if other, ok := savedAliases[name]; ok && !self.abbr {
+			panic(core.NewCmdError(parsedCmd,
+				fmt.Sprintf("alias '%s' is used by command '%s'", name, other)))
+		}
+		err := self.apply(cc.Cmds, cmd, name)
+		if err != nil {
+			panic(core.NewCmdError(parsedCmd, err.Error()))
+		}
+		saved[alias] = true
+		savedAliases[name] = cmdPath
+		aliases = append(aliases, alias)
+		added = append(added, name)
+	}
+
+	if len(added) == 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			"the "+self.plural+" already exist, nothing changed.")
+	} else {
+		alias_file.WriteAliasFile(path, aliases, sep)
+		display.PrintTipTitle(cc.Screen, env,
+			self.plural+" of command '"+cmdPath+"' are saved.")
+	}
+	var all []string
+	for _, alias := range aliases {
+		if alias.CmdPath == cmdPath {
+			all = append(all, alias.Name)
+		}
+	}
+	self.print(cc, env, cmdPath, all)
+	return currCmdIdx, true
+}
+
+func (self userAliasKind) remove(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	parsedCmd := flow.Cmds[currCmdIdx]
+
+	// The command may not be loaded now, use the path as it is
+	cmdPath := normalizeCmdPath(getAndCheckArg(argv, parsedCmd, "cmd-path"),
+		cc.Cmds.Strs.PathSep, cc.Cmds.Strs.PathAlterSeps)
+	cmd := getAliasCmd(argv, cc, parsedCmd)
+	if cmd != nil {
+		cmdPath = cmd.DisplayPath()
+	}
+
+	removing := map[string]bool{}
+	for _, name := range self.parse(argv.GetRaw(self.plural), cc, env, parsedCmd) {
+		removing[name] = true
+	}
+
+	path := self.filePath(env, parsedCmd)
+	sep := env.GetRaw("strs.proto-sep")
+	var aliases []alias_file.Alias
+	var removed []string
+	for _, alias := range alias_file.ReadAliasFile(path, sep) {
+		if alias.CmdPath == cmdPath && (len(removing) == 0 || removing[alias.Name]) {
+			removed = append(removed, alias.Name)
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	if len(removed) == 0 {
+		panic(core.NewCmdError(parsedCmd,
+			fmt.Sprintf("no matched user defined %s of command '%s'", self.plural, cmdPath)))
+	}
+	alias_file.WriteAliasFile(path, aliases, sep)
+
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("%d %s of command '%s' are removed:", len(removed), self.plural, cmdPath),
+		"",
+		"    "+strings.Join(removed, ", "))
+	return currCmdIdx, true
+}
+
+func (self userAliasKind) apply(root *core.CmdTree, cmd *core.CmdTree, name string) error {
+	if self.abbr {
+		return applyAbbr(cmd, name)
+	}
+	return applyAlias(root, cmd, name)
+}
+
+func (self userAliasKind) applied(root *core.CmdTree, cmd *core.CmdTree, name string) bool {
+	if cmd == nil {
+		return false
+	}
+	if self.abbr {
+		return cmd.Parent().GetSub(name) == cmd
+	}
+	alias := root.GetSub(strings.Split(name, root.Strs.PathSep)...)
+	return alias == cmd || isAliasCmd(alias) && alias.Cmd().Redirect() == cmd.DisplayPath()
+}
+
+// Abbrs are seperated by list-sep or spaces, they are single segments of command paths.
+// Aliases are command paths, so they can't contain abbrs-sep
+func (self userAliasKind) parse(str string, cc *core.Cli, env *core.Env, parsedCmd core.ParsedCmd) (names []string) {
+	listSep := env.GetRaw("strs.list-sep")
+	invalid := cc.Cmds.Strs.AbbrsSep + env.GetRaw("strs.env-bracket-left") + env.GetRaw("strs.env-kv-sep")
+	if self.abbr {
+		invalid += cc.Cmds.Strs.PathSep + cc.Cmds.Strs.PathAlterSeps
+	}
+	for _, name := range strings.Fields(strings.ReplaceAll(str, listSep, " ")) {
+		normalized := normalizeCmdPath(name, cc.Cmds.Strs.PathSep, cc.Cmds.Strs.PathAlterSeps)
+		if strings.ContainsAny(name, invalid) || len(normalized) == 0 {
+			panic(core.NewCmdError(parsedCmd, fmt.Sprintf("invalid %s '%s'", self.name, name)))
+		}
+		names = append(names, normalized)
+	}
+	return
+}
+
+func (self userAliasKind) print(cc *core.Cli, env *core.Env, cmdPath string, names []string) {
+	screen := cc.Screen
+	cmd := cc.Cmds.GetSub(strings.Split(cmdPath, cc.Cmds.Strs.PathSep)...)
+	screen.Print(display.ColorCmd("["+cmdPath+"]", env) + "\n")
+	screen.Print("    " + display.ColorProp("- "+self.plural+":", env) + "\n")
+	for _, name := range names {
+		line := "        " + name
+		if cmd == nil {
+			line += display.ColorDisabled(" (command not loaded)", env)
+		} else if !self.applied(cc.Cmds, cmd, name) {
+			line += display.ColorDisabled(" (not applied)", env)
+		}
+		screen.Print(line + "\n")
+	}
+}
+
+func (self userAliasKind) filePath(env *core.Env, cmd core.ParsedCmd) string {
+	path := env.GetRaw("sys.paths.data")
+	file := env.GetRaw(self.fileKey)
+	if len(path) == 0 || len(file) == 0 {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("can't find local data path")))
+	}
+	return filepath.Join(path, file)
+}
+
+// Register the abbr to the parent of the command, so 'say' could be an abbr of 'dbg.echo' as 'dbg.say'.
+// The conflicted error is core.CmdTreeErrSubAbbrConflicted
+func applyAbbr(cmd *core.CmdTree, abbr string) error {
+	return cmd.TryAddAbbrs(abbr)
+}
+
+// Register the alias as a command redirected to the target, an existing path can't be an alias.
+// The alias is a path from root, so 'dp' could be an alias of 'cluster.deploy.full'.
+// Using an existing path is reported as core.CmdTreeErrSubAbbrConflicted, same as the conflicted abbrs
+func applyAlias(root *core.CmdTree, cmd *core.CmdTree, name string) error {
+	sep := root.Strs.PathSep
+	path := strings.Split(name, sep)
+	if old := root.GetSub(path...); old != nil {
+		return old.Parent().SubAbbrConflicted(path[len(path)-1], name)
+	}
+	for i := 1; i < len(path); i++ {
+		if isAliasCmd(root.GetSub(path[:i]...)) {
+			return fmt.Errorf("'%s' is an alias, can't have sub commands", strings.Join(path[:i], sep))
+		}
+	}
+	target := cmd.DisplayPath()
+	root.GetOrAddSub(path...).RegEmptyCmd("alias of " + target).SetAlias(target)
+	return nil
+}
+
+// Find the command by path, an alias is resolved to its target
+func getAliasCmd(argv core.ArgVals, cc *core.Cli, parsedCmd core.ParsedCmd) *core.CmdTree {
+	cmdPath := normalizeCmdPath(getAndCheckArg(argv, parsedCmd, "cmd-path"),
+		cc.Cmds.Strs.PathSep, cc.Cmds.Strs.PathAlterSeps)
+	cmd := cc.Cmds.GetSub(strings.Split(cmdPath, cc.Cmds.Strs.PathSep)...)
+	if isAliasCmd(cmd) {
+		cmd = cc.Cmds.GetSub(strings.Split(cmd.Cmd().Redirect(), cc.Cmds.Strs.PathSep)...)
+	}
+	if cmd == nil || cmd.IsRoot() {
+		return nil
+	}
+	return cmd
+}
+
+func isAliasCmd(cmd *core.CmdTree) bool {
+	return cmd != nil && cmd.Cmd() != nil && cmd.Cmd().IsAlias()
+}
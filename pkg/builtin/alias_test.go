@@ -0,0 +1,101 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestApplyAlias(t *testing.T) {
+	root := core.NewCmdTree(core.CmdTreeStrsForTest())
+	echo := root.AddSub("dbg").AddSub("echo", "e")
+	echo.RegEmptyCmd("print message")
+	deploy := root.AddSub("cluster", "c").AddSub("deploy", "dp").AddSub("full")
+	deploy.RegEmptyCmd("deploy a cluster")
+
+	test := func(cmd *core.CmdTree, name string, path ...string) {
+		err := applyAlias(root, cmd, name)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", name, err)
+		}
+		alias := root.GetSub(path...)
+		if !isAliasCmd(alias) || alias.Cmd().Redirect() != cmd.DisplayPath() {
+			t.Fatalf("%#v: alias of %#v is not applied\n", name, cmd.DisplayPath())
+		}
+		if !userAliases.applied(root, cmd, name) {
+			t.Fatalf("%#v: alias of %#v should be found\n", name, cmd.DisplayPath())
+		}
+	}
+
+	test(deploy, "dp", "dp")
+	test(echo, "dbg.say", "dbg", "say")
+	test(echo, "my.tools.say", "my", "tools", "say")
+
+	conflicted := func(cmd *core.CmdTree, name string, parent string, abbr string) {
+		err := applyAlias(root, cmd, name)
+		conflict, ok := err.(core.CmdTreeErrSubAbbrConflicted)
+		if !ok {
+			t.Fatalf("%#v: should be an abbr conflicted error, got: %v\n", name, err)
+		}
+		if conflict.Abbr != abbr || conflict.ForNewCmdName != name ||
+			root.GetSub(conflict.ParentCmdPath...).DisplayPath() != parent {
+			t.Fatalf("%#v: bad conflicted error: %#v\n", name, conflict)
+		}
+	}
+
+	// Existing paths, include the abbrs and the applied aliases
+	conflicted(echo, "dbg", "<root>", "dbg")
+	conflicted(echo, "dbg.e", "dbg", "e")
+	conflicted(echo, "c.dp", "cluster", "dp")
+	conflicted(echo, "dp", "<root>", "dp")
+
+	// An alias can't have sub commands
+	if err := applyAlias(root, echo, "dp.say"); err == nil {
+		t.Fatalf("'dp.say' should be failed\n")
+	}
+}
+
+func TestApplyAbbr(t *testing.T) {
+	root := core.NewCmdTree(core.CmdTreeStrsForTest())
+	dbg := root.AddSub("dbg")
+	echo := dbg.AddSub("echo", "e")
+	echo.RegEmptyCmd("print message")
+	exit := dbg.AddSub("exit", "x")
+	exit.RegEmptyCmd("exit")
+
+	test := func(cmd *core.CmdTree, abbr string) {
+		err := applyAbbr(cmd, abbr)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", abbr, err)
+		}
+		if cmd.Parent().GetSub(abbr) != cmd || !userAbbrs.applied(root, cmd, abbr) {
+			t.Fatalf("%#v: abbr of %#v is not applied\n", abbr, cmd.DisplayPath())
+		}
+	}
+
+	test(echo, "say")
+	// The abbrs are under the parent, so the same abbr could be used in other branches
+	test(root.AddSub("hub").AddSub("clear"), "say")
+	// Existing abbrs of the same command are fine
+	test(echo, "e")
+	test(echo, "echo")
+
+	conflicted := func(cmd *core.CmdTree, abbr string, old string) {
+		err := applyAbbr(cmd, abbr)
+		conflict, ok := err.(core.CmdTreeErrSubAbbrConflicted)
+		if !ok {
+			t.Fatalf("%#v: should be an abbr conflicted error, got: %v\n", abbr, err)
+		}
+		if conflict.Abbr != abbr || conflict.ForOldCmdName != old || conflict.ForNewCmdName != cmd.Name() {
+			t.Fatalf("%#v: bad conflicted error: %#v\n", abbr, conflict)
+		}
+		if cmd.Parent().GetSub(abbr) == cmd {
+			t.Fatalf("%#v: the conflicted abbr should not be applied\n", abbr)
+		}
+	}
+
+	conflicted(exit, "e", "echo")
+	conflicted(exit, "echo", "echo")
+	conflicted(exit, "say", "echo")
+	conflicted(echo, "x", "exit")
+}
@@ -88,6 +88,21 @@ func RegisterExecutorCmds(cmds *core.CmdTree) {
 		SetPriority()
 	addFindStrArgs(findTag)
 
+	selfTest := cmds.AddSub("selftest", "self-test", "st").
+		RegPowerCmd(SelfTest,
+			"run the commands with tag '"+cmds.Strs.TagMark+"selftest' one by one, each in a new session")
+	addFindStrArgs(selfTest)
+	selfTest.AddArg("repo", "", "r", "R").
+		AddArg("junit", "", "j", "J")
+
+	cmds.AddSub("server", "serve", "srv").
+		RegPowerCmd(Serve,
+			"run as a local service, list commands, desc or execute flows by http api").
+		SetQuiet().
+		AddArg("listen", "127.0.0.1:6780", "l", "L").
+		AddArg("unix-socket", "", "socket", "sock", "u", "U").
+		AddArg("token", "", "tk")
+
 	desc := cmds.AddSub("desc", "d", "D").
 		RegPowerCmd(DumpFlowAll,
 			"desc the flow about to execute").
@@ -120,6 +135,13 @@ func RegisterExecutorCmds(cmds *core.CmdTree) {
 		SetQuiet().
 		SetPriority()
 
+	cmds.AddSub("install-deps", "install-dep", "deps-install", "dep-install").
+		RegPowerCmd(InstallFlowDepends,
+			"install the missed depended os-commands of the flow by the install recipes").
+		SetQuiet().
+		SetPriority().
+		AddArg("yes", "false", "y", "Y")
+
 	descFlow := desc.AddSub("flow", "f", "F").
 		RegPowerCmd(DumpFlow,
 			"desc the flow execution").
@@ -186,6 +208,42 @@ func RegisterExecutorCmds(cmds *core.CmdTree) {
 			"list builtin and loaded commands in lite style").
 		SetAllowTailModeCall()
 	addFindStrArgs(listSimple)
+
+	abbrs := mods.AddSub("abbrs", "abbr")
+	abbrs.RegPowerCmd(ListAbbrs,
+		"list user defined abbrs (extra abbrs of the last segments of command paths)")
+
+	abbrs.AddSub("add", "a", "A", "+").
+		RegPowerCmd(AddAbbrs,
+			"add abbrs to a command, they are saved to local and applied on each run").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("abbrs", "", "abbr", "a", "A")
+
+	abbrs.AddSub("remove", "rm", "delete", "del", "-").
+		RegPowerCmd(RemoveAbbrs,
+			"remove user defined abbrs of a command, remove all of them if no abbrs specified").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("abbrs", "", "abbr", "a", "A")
+
+	alias := mods.AddSub("alias", "aliases")
+	alias.RegPowerCmd(ListAliases,
+		"list user defined aliases (full command paths resolved to other commands)")
+
+	alias.AddSub("add", "a", "A", "+").
+		RegPowerCmd(AddAliases,
+			"add aliases to a command, they are saved to local and applied on each run").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("aliases", "", "alias", "a", "A")
+
+	alias.AddSub("remove", "rm", "delete", "del", "-").
+		RegPowerCmd(RemoveAliases,
+			"remove user defined aliases of a command, remove all of them if no aliases specified").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("aliases", "", "alias", "a", "A")
 }
 
 func RegisterFlowCmds(cmds *core.CmdTree) {
@@ -201,7 +259,17 @@ func RegisterFlowCmds(cmds *core.CmdTree) {
 			"save current commands as a flow").
 		SetQuiet().
 		SetPriority().
-		AddArg("to-cmd-path", "", "path", "p", "P")
+		AddArg("to-cmd-path", "", "path", "p", "P").
+		AddArg("args", "", "arg", "a", "A").
+		AddArg("tags", "", "tag", "t", "T").
+		AddArg("trivial", "", "triv")
+
+	flow.AddSub("export", "exp", "x", "X").
+		RegPowerCmd(ExportFlowToBash,
+			"export current commands as a standalone bash script, print it if the file path is empty").
+		SetQuiet().
+		SetPriority().
+		AddArg("to-file", "", "file", "path", "p", "P")
 
 	flow.AddSub("set-help-str", "help", "h", "H").
 		RegPowerCmd(SetFlowHelpStr,
@@ -210,6 +278,65 @@ func RegisterFlowCmds(cmds *core.CmdTree) {
 		AddArg("cmd-path", "", "path", "p", "P").
 		AddArg("help-str", "", "help", "h", "H")
 
+	flow.AddSub("set-abbrs", "abbrs", "abbr", "a", "A").
+		RegPowerCmd(SetFlowAbbrs,
+			"set abbrs to a saved flow").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("abbrs", "", "abbr", "a", "A")
+
+	flow.AddSub("tag", "tags", "t", "T").
+		RegPowerCmd(TagFlow,
+			"add or remove tags, or set the trivial level of a saved flow").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("add", "", "tags", "tag", "+").
+		AddArg("remove", "", "rm", "untag", "-").
+		AddArg("trivial", "", "triv")
+
+	flow.AddSub("rename", "ren", "rn").
+		RegPowerCmd(RenameFlow,
+			"rename a saved flow to another command path").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("to-cmd-path", "", "to", "t", "T")
+
+	flow.AddSub("copy", "cp").
+		RegPowerCmd(CopyFlow,
+			"copy a saved flow to another command path").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("to-cmd-path", "", "to", "t", "T")
+
+	step := flow.AddSub("step", "steps", "st").
+		RegPowerCmd(ListFlowSteps,
+			"list steps of a saved flow with indexes").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P")
+
+	step.AddSub("insert", "ins", "add", "+").
+		RegPowerCmd(InsertFlowStep,
+			"insert a step before the Nth (from 1) step of a saved flow, append if index is 0").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("step", "", "s", "S").
+		AddArg("index", "0", "idx", "i", "I")
+
+	step.AddSub("replace", "set", "=").
+		RegPowerCmd(ReplaceFlowStep,
+			"replace the Nth (from 1) step of a saved flow").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("index", "", "idx", "i", "I").
+		AddArg("step", "", "s", "S")
+
+	step.AddSub("delete", "remove", "rm", "del", "-").
+		RegPowerCmd(RemoveFlowStep,
+			"remove the Nth (from 1) step of a saved flow").
+		SetQuiet().
+		AddArg("cmd-path", "", "path", "p", "P").
+		AddArg("index", "", "idx", "i", "I")
+
 	flow.AddSub("remove", "rm", "delete", "del", "-").
 		RegPowerCmd(RemoveFlow,
 			"remove a saved flow").
@@ -228,6 +355,12 @@ func RegisterFlowCmds(cmds *core.CmdTree) {
 			"load flows from local dir").
 		AddArg("path", "", "p", "P")
 
+	flow.AddSub("lint", "check", "verify").
+		RegPowerCmd(LintFlows,
+			"check flows without executing them, all flows will be checked if the path is empty, "+
+				"the path could be a dir or a find-str of repos in hub").
+		AddArg("path", "", "p", "P")
+
 	flow.AddSub("clear", "reset", "--").
 		RegPowerCmd(RemoveAllFlows,
 			"remove all flows saved in local")
@@ -266,12 +399,44 @@ func RegisterEnvCmds(cmds *core.CmdTree) {
 			"save session env changes to local").
 		SetQuiet()
 
+	env.AddSub("export", "exp", "x", "X").
+		RegPowerCmd(ExportEnv,
+			"export env values for other tools, format could be: sh, dotenv, json").
+		SetQuiet().
+		AddArg("format", "sh", "fmt", "f", "F").
+		AddArg("prefix", "", "pre", "p", "P")
+
 	env.AddSub("remove-and-save", "remove", "rm", "delete", "del", "-").
 		RegPowerCmd(RemoveEnvValAndSaveToLocal,
 			"remove specified env value and save changes to local").
 		SetAllowTailModeCall().
 		AddArg("key", "", "k", "K")
 
+	envHistory := env.AddSub("history", "hist", "h", "H").
+		RegPowerCmd(DumpEnvHistory,
+			"list env changes in current session, with the writer commands,\n"+
+				"only the changes in the current process are recorded").
+		SetAllowTailModeCall()
+	addFindStrArgs(envHistory)
+
+	env.AddSub("rollback", "undo", "u", "U").
+		RegPowerCmd(RollbackSessionEnv,
+			"roll back session env to the state before the specified step,\n"+
+				"only the steps in the current process could be rolled back").
+		AddArg("step", "", "s", "S")
+
+	env.AddSub("snapshot", "snap").
+		RegPowerCmd(SaveEnvSnapshot,
+			"save current env as a named snapshot for comparing").
+		AddArg("name", "", "n", "N")
+
+	env.AddSub("diff", "d", "D").
+		RegPowerCmd(DiffEnv,
+			"show added, removed and changed keys between two env sources:\n"+
+				"default, persisted, os, session, step.<N>, snapshot.<name>, session.<id>").
+		AddArg("left", "default", "l", "L").
+		AddArg("right", "session", "r", "R")
+
 	env.AddSub("reset-session", "reset", "--").
 		RegPowerCmd(ResetSessionEnv,
 			"clear all env values in current session")
@@ -407,6 +572,11 @@ func RegisterBuiltinCmds(cmds *core.CmdTree) {
 			"setup runtime env values").
 		SetQuiet()
 
+	envLoad.AddSub("os", "o", "O").
+		RegPowerCmd(LoadOsEnv,
+			"import OS env values by rules 'sys.env.from-os.<key>=<OS-env-name>'").
+		SetQuiet()
+
 	mod := cmds.AddSub("mod", "mods", "m", "M")
 
 	modLoad := mod.AddSub("load", "l", "L")
@@ -423,6 +593,11 @@ func RegisterBuiltinCmds(cmds *core.CmdTree) {
 		RegPowerCmd(LoadModsFromHub,
 			"load flows and mods from local hub")
 
+	modLoad.AddSub("aliases", "alias", "a", "A").
+		RegPowerCmd(LoadAliases,
+			"apply user defined command abbrs and aliases").
+		SetQuiet()
+
 	cmds.AddSub("display", "disp", "dis", "di", "d", "D").
 		AddSub("load", "l", "L").
 		AddSub("platform", "p", "P").
@@ -475,6 +650,33 @@ func RegisterDbgCmds(cmds *core.CmdTree) {
 		"sys.step-by-step",
 		"step-by-step", "step", "confirm", "cfm")
 
+	mock := registerSimpleSwitch(cmds,
+		"mock mode, executable-file commands only write their declared keys without executing",
+		"sys.mock",
+		"mock", "mk")
+	registerSimpleSwitch(mock,
+		"recording the written values of executable-file commands for mock mode",
+		"sys.mock.record",
+		"record", "rec")
+
+	replay := cmds.AddSub("replay", "rp")
+	replay.AddSub("record", "rec").
+		RegEmptyCmd(
+			"record executions of executable-file commands to a replay bundle dir").
+		SetQuiet().
+		AddArg("dir", "", "d", "D").
+		AddArg2Env("sys.replay.record-to", "dir")
+	replay.AddSub("from", "play", "run").
+		RegEmptyCmd(
+			"use the recorded results in a replay bundle dir instead of executing executable-file commands").
+		SetQuiet().
+		AddArg("dir", "", "d", "D").
+		AddArg2Env("sys.replay.from", "dir")
+	replay.AddSub("list", "ls").
+		RegPowerCmd(ListReplayBundle,
+			"list the recorded steps in a replay bundle dir").
+		AddArg("dir", "", "d", "D")
+
 	cmds.AddSub("delay-execute", "delay", "dl", "d", "D").
 		RegPowerCmd(DbgDelayExecute,
 			"wait for a while before executing a command").
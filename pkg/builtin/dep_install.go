@@ -0,0 +1,195 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/utils"
+)
+
+type depInstaller struct {
+	name      string
+	tool      string
+	cmdLine   []string
+	needRoot  bool
+	platforms []string
+}
+
+// The package managers in preferred order, "cmd" (a ticat command) is always the last choice.
+// The names should be in core.DependInstallers
+var depInstallers = []depInstaller{
+	{"brew", "brew", []string{"brew", "install"}, false, []string{"darwin", "linux"}},
+	{"apt", "apt-get", []string{"apt-get", "install", "-y"}, true, []string{"linux"}},
+	{"dnf", "dnf", []string{"dnf", "install", "-y"}, true, []string{"linux"}},
+	{"yum", "yum", []string{"yum", "install", "-y"}, true, []string{"linux"}},
+}
+
+const depInstallerCmd = "cmd"
+
+type depInstallPlan struct {
+	osCmd   string
+	install core.DependInstall
+}
+
+func InstallFlowDepends(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	deps := core.Depends{}
+	core.CollectDepends(cc, env.Clone(), flow, currCmdIdx+1, deps, false, EnvOpCmds())
+
+	foundOsCmds, osCmds, missedOsCmds := display.GatherOsCmdsExistingInfo(cc.VersionProbes, deps)
+	if missedOsCmds == 0 {
+		if len(deps) == 0 {
+			display.PrintTipTitle(cc.Screen, env, "no depended os commands")
+		} else {
+			display.PrintTipTitle(cc.Screen, env, "depended os-commands are all installed.")
+		}
+		return clearFlow(flow)
+	}
+
+	var plans []depInstallPlan
+	var noRecipes []string
+	for _, osCmd := range osCmds {
+		if foundOsCmds[osCmd] {
+			continue
+		}
+		install, ok := pickDepInstall(deps.Installs(osCmd), runtime.GOOS, isOsCmdInstalled)
+		if !ok {
+			noRecipes = append(noRecipes, osCmd)
+			continue
+		}
+		plans = append(plans, depInstallPlan{osCmd, install})
+	}
+
+	if len(noRecipes) != 0 {
+		screen := display.NewCacheScreen()
+		display.DumpDepends(cc.VersionProbes, screen, env, deps)
+		screen.WriteTo(cc.Screen)
+		panic(core.NewCmdError(cmd, "no available install recipe for os-commands: "+
+			strings.Join(noRecipes, ", ")))
+	}
+
+	var lines []string
+	for _, plan := range plans {
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s", plan.osCmd, plan.install.Installer, plan.install.Target))
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		"the missed os-commands will be installed:",
+		"",
+		lines)
+
+	if !argv.GetBool("yes") {
+		if !env.GetBool("sys.interact") {
+			panic(core.NewCmdError(cmd, "need confirmation to install, set arg 'yes' to skip it"))
+		}
+		cc.Screen.Print(display.ColorTip("[confirm]", env) + " type " +
+			display.ColorWarn("'y'", env) + " and press enter to install:\n")
+		utils.UserConfirm()
+	}
+
+	sep := cc.Cmds.Strs.PathSep
+	caller := cmd.DisplayPath(sep, true)
+	var failed []string
+	for _, plan := range plans {
+		cc.Screen.Print(display.ColorCmd("["+plan.osCmd+"]", env) +
+			display.ColorSymbol(" => ", env) + plan.install.Installer + ": " + plan.install.Target + "\n")
+		err := runDepInstall(cc, caller, plan.install)
+		if err == nil {
+			cc.VersionProbes.Reset(deps.VersionProbe(plan.osCmd))
+			state := display.CheckOsCmd(cc.VersionProbes, deps, plan.osCmd)
+			if !state.Exists {
+				err = fmt.Errorf("still not found after installing")
+			} else if !state.Satisfied() {
+				err = fmt.Errorf("version %s", state.VersionErr)
+			}
+		}
+		if err != nil {
+			cc.Screen.Print(display.ColorError(fmt.Sprintf("[%s] install failed: %v", plan.osCmd, err), env) + "\n")
+			failed = append(failed, plan.osCmd)
+		}
+	}
+
+	if len(failed) != 0 {
+		panic(core.NewCmdError(cmd, "failed to install os-commands: "+strings.Join(failed, ", ")))
+	}
+	display.PrintTipTitle(cc.Screen, env, "depended os-commands are all installed.")
+	return clearFlow(flow)
+}
+
+// Pick the first package manager which has a recipe, supports the platform and is installed
+func pickDepInstall(
+	installs []core.DependInstall,
+	platform string,
+	installed func(tool string) bool) (install core.DependInstall, ok bool) {
+
+	recipes := map[string]core.DependInstall{}
+	for _, it := range installs {
+		recipes[it.Installer] = it
+	}
+	for _, installer := range depInstallers {
+		it, ok := recipes[installer.name]
+		if ok && installer.supports(platform) && installed(installer.tool) {
+			return it, true
+		}
+	}
+	install, ok = recipes[depInstallerCmd]
+	return
+}
+
+func runDepInstall(cc *core.Cli, caller string, install core.DependInstall) error {
+	if install.Installer == depInstallerCmd {
+		if !cc.Executor.Execute(caller, cc, strings.Fields(install.Target)...) {
+			return fmt.Errorf("command '%s' failed", install.Target)
+		}
+		return nil
+	}
+
+	var cmdLine []string
+	for _, installer := range depInstallers {
+		if installer.name != install.Installer {
+			continue
+		}
+		cmdLine = append(cmdLine, installer.cmdLine...)
+		if installer.needRoot && os.Geteuid() != 0 && isOsCmdInstalled("sudo") {
+			cmdLine = append([]string{"sudo"}, cmdLine...)
+		}
+	}
+	if len(cmdLine) == 0 {
+		return fmt.Errorf("unknown installer '%s'", install.Installer)
+	}
+	cmdLine = append(cmdLine, strings.Fields(install.Target)...)
+
+	c := exec.Command(cmdLine[0], cmdLine[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err := c.Run()
+	if err != nil {
+		return fmt.Errorf("run '%s' failed: %v", strings.Join(cmdLine, " "), err)
+	}
+	return nil
+}
+
+func (self depInstaller) supports(platform string) bool {
+	for _, it := range self.platforms {
+		if it == platform {
+			return true
+		}
+	}
+	return false
+}
+
+func isOsCmdInstalled(cmd string) bool {
+	path, err := exec.LookPath(cmd)
+	return err == nil && len(path) > 0
+}
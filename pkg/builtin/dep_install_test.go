@@ -0,0 +1,85 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestPickDepInstall(t *testing.T) {
+	for _, installer := range depInstallers {
+		if !core.IsDependInstaller(installer.name) {
+			t.Fatalf("installer %#v should be in core.DependInstallers\n", installer.name)
+		}
+	}
+
+	all := []core.DependInstall{
+		{"cmd", "install.mysql"},
+		{"yum", "mariadb"},
+		{"apt", "mysql-client"},
+		{"brew", "mysql-client@8"},
+	}
+	tests := []struct {
+		installs []core.DependInstall
+		platform string
+		tools    []string
+		expected string
+	}{
+		// The preferred order, not the declared order
+		{all, "linux", []string{"brew", "apt-get", "yum"}, "brew"},
+		{all, "linux", []string{"apt-get", "yum"}, "apt"},
+		{all, "linux", []string{"yum", "dnf"}, "yum"},
+		// Only brew on macOS
+		{all, "darwin", []string{"apt-get", "yum"}, "cmd"},
+		{all, "darwin", []string{"brew", "apt-get"}, "brew"},
+		// No supported package managers on the platform
+		{all, "windows", []string{"brew", "apt-get", "yum"}, "cmd"},
+		// No recipe for the installed package manager
+		{all, "linux", []string{"dnf"}, "cmd"},
+		{all, "linux", nil, "cmd"},
+		{all[1:], "linux", []string{"dnf", "apt-get"}, "apt"},
+		// No recipes could be used
+		{all[1:], "linux", []string{"dnf"}, ""},
+		{all[1:], "darwin", []string{"apt-get", "yum"}, ""},
+		{nil, "linux", []string{"brew", "apt-get"}, ""},
+	}
+	for _, it := range tests {
+		tools := map[string]bool{}
+		for _, tool := range it.tools {
+			tools[tool] = true
+		}
+		installed := func(tool string) bool { return tools[tool] }
+		install, ok := pickDepInstall(it.installs, it.platform, installed)
+		if ok != (len(it.expected) != 0) || install.Installer != it.expected {
+			t.Fatalf("%#v on %s with %#v: picked %#v (%v), should be %#v\n",
+				it.installs, it.platform, it.tools, install.Installer, ok, it.expected)
+		}
+	}
+}
+
+type failedExecutorForTest struct {
+	executed [][]string
+}
+
+func (self *failedExecutorForTest) Execute(caller string, cc *core.Cli, input ...string) bool {
+	self.executed = append(self.executed, input)
+	return false
+}
+
+func TestRunDepInstallFailed(t *testing.T) {
+	executor := &failedExecutorForTest{}
+	cc := &core.Cli{Executor: executor}
+
+	err := runDepInstall(cc, "caller", core.DependInstall{"cmd", "install.mysql ver=8"})
+	if err == nil {
+		t.Fatalf("the failed install command should be an error\n")
+	}
+	if len(executor.executed) != 1 || len(executor.executed[0]) != 2 || executor.executed[0][0] != "install.mysql" {
+		t.Fatalf("the install command should be executed: %#v\n", executor.executed)
+	}
+
+	err = runDepInstall(cc, "caller", core.DependInstall{"pip", "mysql"})
+	if err == nil {
+		t.Fatalf("an unknown installer should be an error\n")
+	}
+}
@@ -103,3 +103,34 @@ func DumpEssentialEnvFlattenVals(
 	}
 	return currCmdIdx, true
 }
+
+func DumpEnvHistory(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	findStrs := getFindStrsFromArgvAndFlow(flow, currCmdIdx, argv)
+
+	journal := env.Journal()
+	if journal == nil {
+		display.PrintTipTitle(cc.Screen, env, "env changes are not recorded in this session.")
+		return currCmdIdx, true
+	}
+
+	screen := display.NewCacheScreen()
+	display.DumpEnvHistory(screen, env, journal.Changes, findStrs...)
+	if screen.OutputNum() <= 0 {
+		display.PrintTipTitle(cc.Screen, env, "no matched env changes.")
+	} else {
+		display.PrintTipTitle(cc.Screen, env,
+			"env changes in session, format: [step] time key = old => new by command",
+			"",
+			"roll back to the state before a step by:",
+			"",
+			display.SuggestRollbackEnv(env))
+	}
+	screen.WriteTo(cc.Screen)
+	return currCmdIdx, true
+}
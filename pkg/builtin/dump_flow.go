@@ -66,7 +66,7 @@ func DumpFlowSkeleton(
 
 	deps := core.Depends{}
 	core.CollectDepends(cc, env, flow, currCmdIdx+1, deps, false, EnvOpCmds())
-	_, _, missedOsCmds := display.GatherOsCmdsExistingInfo(deps)
+	_, _, missedOsCmds := display.GatherOsCmdsExistingInfo(cc.VersionProbes, deps)
 
 	checker := &core.EnvOpsChecker{}
 	result := []core.EnvOpsCheckResult{}
@@ -104,7 +104,7 @@ func DumpFlowDepends(
 	core.CollectDepends(cc, env, flow, currCmdIdx+1, deps, false, EnvOpCmds())
 
 	if len(deps) != 0 {
-		display.DumpDepends(cc.Screen, env, deps)
+		display.DumpDepends(cc.VersionProbes, cc.Screen, env, deps)
 	} else {
 		display.PrintTipTitle(cc.Screen, env, "no depended os commands")
 	}
@@ -151,7 +151,7 @@ func dumpFlowAll(
 
 	if len(deps) != 0 {
 		cc.Screen.Print("\n")
-		display.DumpDepends(cc.Screen, env, deps)
+		display.DumpDepends(cc.VersionProbes, cc.Screen, env, deps)
 	}
 
 	checker := &core.EnvOpsChecker{}
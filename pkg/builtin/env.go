@@ -1,9 +1,11 @@
 package builtin
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
 	"github.com/pingcap/ticat/pkg/cli/display"
@@ -20,6 +22,15 @@ func LoadDefaultEnv(env *core.Env) {
 	env.SetBool("sys.panic.recover", true)
 	env.SetInt("sys.execute-delay-sec", 0)
 	env.SetBool("sys.interact", true)
+	env.SetBool("sys.mock", false)
+	env.SetBool("sys.mock.record", false)
+	env.Set("sys.mock.placeholder", "mocked")
+	// The finished sessions are kept for comparing, see "env.diff session.<id>"
+	env.SetInt("sys.sessions.keep", 8)
+	// A rpc call not responded in time fails and the helper is killed, 0 means no limit
+	env.SetInt("sys.rpc.timeout-sec", 3600)
+	// A worker step not finished in time fails and the worker is killed, 0 means no limit
+	env.SetInt("sys.worker.timeout-sec", 3600)
 
 	env.Set("sys.version", "1.0.0")
 	env.Set("sys.dev.name", "marsh")
@@ -90,14 +101,18 @@ func LoadRuntimeEnv(
 
 	assertNotTailMode(flow, currCmdIdx)
 
-	env = env.GetLayer(core.EnvLayerSession)
-
 	path, err := os.Executable()
 	if err != nil {
 		panic(core.NewCmdError(flow.Cmds[currCmdIdx],
 			fmt.Sprintf("get abs self-path fail: %v", err)))
 	}
-	data := path + ".data"
+	// The data dir could be specified by the embedding program
+	data := env.GetRaw("sys.paths.data")
+	if len(data) == 0 {
+		data = path + ".data"
+	}
+
+	env = env.GetLayer(core.EnvLayerSession)
 
 	sys := cc.EnvAbbrs.GetOrAddSub("sys")
 	paths := sys.GetOrAddSub("paths").AddAbbrs("path", "p", "P")
@@ -115,6 +130,12 @@ func LoadRuntimeEnv(
 	env.Set("sys.paths.sessions", filepath.Join(data, "sessions"))
 	paths.GetOrAddSub("sessions").AddAbbrs("session", "s", "S")
 
+	env.Set("sys.paths.snapshots", filepath.Join(data, "snapshots"))
+	paths.GetOrAddSub("snapshots").AddAbbrs("snapshot", "snap")
+
+	env.Set("sys.paths.mocks", filepath.Join(data, "mocks"))
+	paths.GetOrAddSub("mocks").AddAbbrs("mock")
+
 	return currCmdIdx, true
 }
 
@@ -131,6 +152,8 @@ func LoadLocalEnv(
 	path := getEnvLocalFilePath(env, flow.Cmds[currCmdIdx])
 	core.LoadEnvFromFile(env.GetLayer(core.EnvLayerPersisted), path, kvSep)
 	env.GetLayer(core.EnvLayerPersisted).DeleteInSelfLayer("sys.stack-depth")
+	env.GetLayer(core.EnvLayerPersisted).DeleteInSelfLayer("sys.replay.cursor")
+	env.GetLayer(core.EnvLayerPersisted).DeleteInSelfLayer("sys.replay.record-idx")
 	env.GetLayer(core.EnvLayerPersisted).Deduplicate()
 	env.GetLayer(core.EnvLayerSession).Deduplicate()
 
@@ -141,6 +164,36 @@ func LoadLocalEnv(
 	return currCmdIdx, true
 }
 
+// Import OS env vars by the rules "sys.env.from-os.<key> = <OS-env-var-name>",
+// the rules could be defined in env or in the repo list file of a repo
+func LoadOsEnv(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	prefix := "sys.env.from-os."
+	osEnv := env.GetLayer(core.EnvLayerOs)
+	for k, name := range env.Flatten(true, nil, true) {
+		if !strings.HasPrefix(k, prefix) || len(name) == 0 {
+			continue
+		}
+		key := k[len(prefix):]
+		if len(key) == 0 {
+			continue
+		}
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		osEnv.Set(key, val)
+	}
+	return currCmdIdx, true
+}
+
 func SaveEnvToLocal(
 	argv core.ArgVals,
 	cc *core.Cli,
@@ -151,6 +204,15 @@ func SaveEnvToLocal(
 	assertNotTailMode(flow, currCmdIdx)
 	kvSep := env.GetRaw("strs.env-kv-sep")
 	path := getEnvLocalFilePath(env, flow.Cmds[currCmdIdx])
+
+	// The values imported from OS env should not be persisted
+	env = env.Clone()
+	osEnv := env.GetLayer(core.EnvLayerOs)
+	keys, _ := osEnv.Pairs()
+	for _, k := range keys {
+		osEnv.DeleteInSelfLayer(k)
+	}
+
 	core.SaveEnvToFile(env, path, kvSep)
 	display.PrintTipTitle(cc.Screen, env,
 		"changes of env are saved, could be listed by:",
@@ -159,6 +221,27 @@ func SaveEnvToLocal(
 	return currCmdIdx, true
 }
 
+func ExportEnv(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	format := strings.ToLower(argv.GetRaw("format"))
+	prefix := argv.GetRaw("prefix")
+
+	buf := bytes.NewBuffer(nil)
+	err := core.EnvExport(env, buf, format, prefix)
+	if err != nil {
+		panic(core.NewCmdError(flow.Cmds[currCmdIdx],
+			fmt.Sprintf("export env failed: %v", err)))
+	}
+	cc.Screen.Print(buf.String())
+	return currCmdIdx, true
+}
+
 // TODO: support abbrs for arg 'key'
 func RemoveEnvValAndSaveToLocal(
 	argv core.ArgVals,
@@ -228,6 +311,32 @@ func ResetLocalEnv(
 	return currCmdIdx, true
 }
 
+func RollbackSessionEnv(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	cmd := flow.Cmds[currCmdIdx]
+	journal := env.Journal()
+	if journal == nil {
+		panic(core.NewCmdError(cmd, "env changes are not recorded in this session"))
+	}
+	step := argv.GetInt("step")
+	if step <= 0 || step >= journal.CurrStep() {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("step '%d' out of range, should be in [1, %d)",
+			step, journal.CurrStep())))
+	}
+
+	reverted := env.RollbackJournal(step)
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("session env rolled back to before step [%d], %d changes reverted", step, reverted))
+	return currCmdIdx, true
+}
+
 func ResetSessionEnv(
 	argv core.ArgVals,
 	cc *core.Cli,
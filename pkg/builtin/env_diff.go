@@ -0,0 +1,169 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+func SaveEnvSnapshot(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	cmd := flow.Cmds[currCmdIdx]
+	name := argv.GetRaw("name")
+	if len(name) == 0 {
+		panic(core.NewCmdError(cmd, "arg 'name' is empty"))
+	}
+	path := getEnvSnapshotPath(env, cmd, name)
+	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	core.SaveEnvToFile(env.GetLayer(core.EnvLayerSession), path, env.GetRaw("strs.env-kv-sep"))
+
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("env snapshot '%s' saved, could be compared with other env by:", name),
+		"",
+		display.SuggestDiffEnv(env))
+	return currCmdIdx, true
+}
+
+func DiffEnv(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+
+	cmd := flow.Cmds[currCmdIdx]
+	leftName := argv.GetRaw("left")
+	rightName := argv.GetRaw("right")
+	left := getEnvDiffSource(env, cmd, leftName)
+	right := getEnvDiffSource(env, cmd, rightName)
+
+	screen := display.NewCacheScreen()
+	display.DumpEnvDiff(screen, env, left, right)
+	if screen.OutputNum() <= 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("no difference between env '%s' and '%s'.", leftName, rightName))
+		return currCmdIdx, true
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("env difference from '%s' to '%s':", leftName, rightName))
+	screen.WriteTo(cc.Screen)
+	return currCmdIdx, true
+}
+
+// Sources: default, persisted, os, session: the flatten env of the layer,
+// "step.<N>": the session env before step N, "snapshot.<name>": a snapshot saved by "env.snapshot",
+// "session.<id>": the env of a past (or running) session, the id is the session dir name
+func getEnvDiffSource(env *core.Env, cmd core.ParsedCmd, name string) map[string]string {
+	// TODO: put all these special key path in one place
+	filtered := []string{
+		"session",
+		"strs.",
+		"display.height",
+		"sys.stack",
+	}
+
+	if strings.HasPrefix(name, "step.") {
+		step, err := strconv.Atoi(name[len("step."):])
+		if err != nil {
+			panic(core.NewCmdError(cmd, fmt.Sprintf("bad step number in env source '%s'", name)))
+		}
+		return env.CloneBeforeStep(step).Flatten(true, filtered, true)
+	}
+
+	if strings.HasPrefix(name, "snapshot.") || strings.HasPrefix(name, "snap.") {
+		snapName := name[strings.Index(name, ".")+1:]
+		path := getEnvSnapshotPath(env, cmd, snapName)
+		if !fileExists(path) {
+			panic(core.NewCmdError(cmd, fmt.Sprintf("env snapshot '%s' not found", snapName)))
+		}
+		snap := env.GetLayer(core.EnvLayerDefault).Clone().NewLayer(core.EnvLayerPersisted)
+		core.LoadEnvFromFile(snap, path, env.GetRaw("strs.env-kv-sep"))
+		return snap.Flatten(true, filtered, true)
+	}
+
+	if strings.HasPrefix(name, "session.") {
+		id := name[len("session."):]
+		path := getSessionEnvPath(env, cmd, id)
+		if !fileExists(path) {
+			panic(core.NewCmdError(cmd, fmt.Sprintf("env of session '%s' not found, the existing sessions: %s",
+				id, strings.Join(listSessionIds(env), " "))))
+		}
+		session := env.GetLayer(core.EnvLayerDefault).Clone().NewLayer(core.EnvLayerSession)
+		core.LoadEnvFromFile(session, path, env.GetRaw("strs.env-kv-sep"))
+		return session.Flatten(true, filtered, true)
+	}
+
+	switch name {
+	case "default", "def":
+		return env.GetLayer(core.EnvLayerDefault).Flatten(true, filtered, true)
+	case "persisted", "saved":
+		return env.GetLayer(core.EnvLayerPersisted).Flatten(true, filtered, true)
+	case "os":
+		return env.GetLayer(core.EnvLayerOs).Flatten(true, filtered, true)
+	case "session", "current", "curr":
+		return env.Flatten(true, filtered, true)
+	}
+	panic(core.NewCmdError(cmd, fmt.Sprintf("unknown env source '%s', should be one of: "+
+		"default, persisted, os, session, step.<N>, snapshot.<name>, session.<id>", name)))
+}
+
+func getEnvSnapshotPath(env *core.Env, cmd core.ParsedCmd, name string) string {
+	dir := env.GetRaw("sys.paths.snapshots")
+	if len(dir) == 0 {
+		panic(core.NewCmdError(cmd, "can't find env snapshots dir"))
+	}
+	checkEnvSourceName(cmd, "snapshot", name)
+	return filepath.Join(dir, name)
+}
+
+func getSessionEnvPath(env *core.Env, cmd core.ParsedCmd, id string) string {
+	dir := env.GetRaw("sys.paths.sessions")
+	if len(dir) == 0 {
+		panic(core.NewCmdError(cmd, "can't find sessions dir"))
+	}
+	checkEnvSourceName(cmd, "session", id)
+	return filepath.Join(dir, id, env.GetRaw("strs.session-env-file"))
+}
+
+// The session ids which have env files, the latest first
+func listSessionIds(env *core.Env) (ids []string) {
+	dir := env.GetRaw("sys.paths.sessions")
+	file := env.GetRaw("strs.session-env-file")
+	infos := map[string]os.FileInfo{}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(dir, entry.Name(), file))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, entry.Name())
+		infos[entry.Name()] = info
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return infos[ids[i]].ModTime().After(infos[ids[j]].ModTime())
+	})
+	return
+}
+
+// The names are used as file names, they can't point to somewhere else
+func checkEnvSourceName(cmd core.ParsedCmd, kind string, name string) {
+	if len(name) == 0 || name == "." || strings.Contains(name, "..") ||
+		strings.ContainsAny(name, "/\\"+string(filepath.Separator)) {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("invalid %s name '%s'", kind, name)))
+	}
+}
@@ -0,0 +1,86 @@
+package builtin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestGetEnvDiffSource(t *testing.T) {
+	dir := t.TempDir()
+	env := core.NewEnv().NewLayers(core.EnvLayerDefault, core.EnvLayerPersisted, core.EnvLayerOs, core.EnvLayerSession)
+	def := env.GetLayer(core.EnvLayerDefault)
+	def.Set("strs.env-kv-sep", "=")
+	def.Set("strs.session-env-file", "env")
+	def.Set("sys.paths.snapshots", filepath.Join(dir, "snapshots"))
+	def.Set("sys.paths.sessions", filepath.Join(dir, "sessions"))
+	def.Set("a", "def")
+	env.GetLayer(core.EnvLayerPersisted).Set("b", "saved")
+	env.GetLayer(core.EnvLayerOs).Set("c", "os")
+
+	session := env.GetLayer(core.EnvLayerSession)
+	session.EnableJournal()
+	session.Set("session", filepath.Join(dir, "sessions", "1-1"))
+	session.Journal().BeginStep("x")
+	session.Set("a", "step1")
+	session.Journal().BeginStep("y")
+	session.Set("a", "step2")
+	session.Set("d", "new")
+
+	snapPath := filepath.Join(dir, "snapshots", "snap")
+	os.MkdirAll(filepath.Dir(snapPath), os.ModePerm)
+	core.SaveEnvToFile(session, snapPath, "=")
+	sessionPath := filepath.Join(dir, "sessions", "1-1", "env")
+	os.MkdirAll(filepath.Dir(sessionPath), os.ModePerm)
+	core.SaveEnvToFile(session, sessionPath, "=")
+
+	sys := map[string]string{
+		"sys.paths.snapshots": filepath.Join(dir, "snapshots"),
+		"sys.paths.sessions":  filepath.Join(dir, "sessions"),
+	}
+	with := func(vals map[string]string) map[string]string {
+		for k, v := range sys {
+			vals[k] = v
+		}
+		return vals
+	}
+
+	tests := []struct {
+		name     string
+		expected map[string]string
+	}{
+		{"default", with(map[string]string{"a": "def"})},
+		{"persisted", with(map[string]string{"a": "def", "b": "saved"})},
+		{"os", with(map[string]string{"a": "def", "b": "saved", "c": "os"})},
+		{"session", with(map[string]string{"a": "step2", "b": "saved", "c": "os", "d": "new"})},
+		{"step.1", with(map[string]string{"a": "def", "b": "saved", "c": "os"})},
+		{"step.2", with(map[string]string{"a": "step1", "b": "saved", "c": "os"})},
+		// The saved env files have the values above the default layer
+		{"snapshot.snap", with(map[string]string{"a": "step2", "b": "saved", "c": "os", "d": "new"})},
+		{"session.1-1", with(map[string]string{"a": "step2", "b": "saved", "c": "os", "d": "new"})},
+	}
+	for _, it := range tests {
+		res := getEnvDiffSource(env, core.ParsedCmd{}, it.name)
+		if !reflect.DeepEqual(res, it.expected) {
+			t.Fatalf("%#v: %#v != %#v\n", it.name, res, it.expected)
+		}
+	}
+
+	fail := func(name string) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%#v: should be failed\n", name)
+			}
+		}()
+		getEnvDiffSource(env, core.ParsedCmd{}, name)
+	}
+	fail("unknown")
+	fail("step.x")
+	fail("snapshot.none")
+	fail("snapshot.../snap")
+	fail("session.none")
+	fail("session.1-1/..")
+}
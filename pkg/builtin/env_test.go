@@ -0,0 +1,163 @@
+package builtin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func newOsEnvForTest() *core.Env {
+	env := core.NewEnv().NewLayers(
+		core.EnvLayerDefault,
+		core.EnvLayerPersisted,
+		core.EnvLayerOs,
+		core.EnvLayerSession,
+	)
+	LoadDefaultEnv(env)
+	env.GetLayer(core.EnvLayerDefault).Set("strs.env-kv-sep", "=")
+	env.GetLayer(core.EnvLayerDefault).Set("strs.env-file-name", "env")
+	return env
+}
+
+func setOsEnvForTest(t *testing.T, vals map[string]string) {
+	for k, v := range vals {
+		old, ok := os.LookupEnv(k)
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatalf("set OS env '%s' failed: %v\n", k, err)
+		}
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func loadOsEnvForTest(env *core.Env) {
+	flow := &core.ParsedCmds{Cmds: []core.ParsedCmd{{}}}
+	LoadOsEnv(core.ArgVals{}, nil, env, flow, 0)
+}
+
+func TestLoadOsEnv(t *testing.T) {
+	setOsEnvForTest(t, map[string]string{
+		"TICAT_TEST_TIUP_HOME": "/home/me/.tiup",
+		"TICAT_TEST_USER":      "me",
+		"TICAT_TEST_REPO":      "from-repo",
+		"TICAT_TEST_EMPTY":     "",
+	})
+
+	env := newOsEnvForTest()
+	dir := t.TempDir()
+	hub := filepath.Join(dir, "hub.ticat")
+	err := ioutil.WriteFile(hub, []byte("[env.from-os]\nrepo.val = TICAT_TEST_REPO\nrepo.user = TICAT_TEST_REPO\n"), 0644)
+	if err != nil {
+		t.Fatalf("write file '%s' failed: %v\n", hub, err)
+	}
+	loadOsEnvImportRules(env, hub)
+	if env.GetLayer(core.EnvLayerDefault).GetRaw("sys.env.from-os.repo.val") != "TICAT_TEST_REPO" {
+		t.Fatalf("the rules from repos should be in the default layer\n")
+	}
+
+	rules := env.GetLayer(core.EnvLayerPersisted)
+	rules.Set("sys.env.from-os.deploy.tiup.home", "TICAT_TEST_TIUP_HOME")
+	rules.Set("sys.env.from-os.USER", "TICAT_TEST_USER")
+	rules.Set("sys.env.from-os.empty", "TICAT_TEST_EMPTY")
+	rules.Set("sys.env.from-os.not-exists", "TICAT_TEST_NOT_EXISTS")
+	rules.Set("sys.env.from-os.no-name", "")
+	rules.Set("sys.env.from-os.", "TICAT_TEST_USER")
+	rules.Set("sys.env.from-os", "TICAT_TEST_USER")
+	rules.Set("sys.env.x.deploy", "TICAT_TEST_USER")
+	// The user's rule overwrites the repo's
+	rules.Set("sys.env.from-os.repo.user", "TICAT_TEST_USER")
+
+	loadOsEnvForTest(env)
+	keys, vals := env.GetLayer(core.EnvLayerOs).Pairs()
+	res := map[string]string{}
+	for i, k := range keys {
+		res[k] = vals[i].Raw
+	}
+	expected := map[string]string{
+		"deploy.tiup.home": "/home/me/.tiup",
+		"USER":             "me",
+		"empty":            "",
+		"repo.val":         "from-repo",
+		"repo.user":        "me",
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("%#v != %#v\n", res, expected)
+	}
+}
+
+func TestOsEnvLayerPrecedence(t *testing.T) {
+	setOsEnvForTest(t, map[string]string{"TICAT_TEST_A": "os", "TICAT_TEST_B": "os", "TICAT_TEST_C": "os"})
+
+	env := newOsEnvForTest()
+	for _, k := range []string{"a", "b", "c"} {
+		env.GetLayer(core.EnvLayerDefault).Set(k, "default")
+		env.GetLayer(core.EnvLayerPersisted).Set("sys.env.from-os."+k, "TICAT_TEST_"+strings.ToUpper(k))
+	}
+	env.GetLayer(core.EnvLayerPersisted).Set("b", "persisted")
+	env.GetLayer(core.EnvLayerPersisted).Set("c", "persisted")
+	env.GetLayer(core.EnvLayerSession).Set("c", "session")
+	loadOsEnvForTest(env)
+
+	// Default < persisted < os < session
+	for k, v := range map[string]string{"a": "os", "b": "os", "c": "session"} {
+		if env.GetRaw(k) != v {
+			t.Fatalf("%#v: %#v != %#v\n", k, env.GetRaw(k), v)
+		}
+	}
+	if env.GetLayer(core.EnvLayerPersisted).GetRaw("b") != "persisted" {
+		t.Fatalf("the persisted value should not be changed by importing\n")
+	}
+}
+
+func TestSaveEnvToLocalWithoutOsEnv(t *testing.T) {
+	setOsEnvForTest(t, map[string]string{"TICAT_TEST_A": "os", "TICAT_TEST_B": "os", "TICAT_TEST_C": "os"})
+
+	cc, _ := newParserCliForTest(core.NewCmdTree(core.CmdTreeStrsForTest()))
+	env := newOsEnvForTest()
+	dir := t.TempDir()
+	env.GetLayer(core.EnvLayerDefault).Set("sys.paths.data", dir)
+	persisted := env.GetLayer(core.EnvLayerPersisted)
+	persisted.Set("sys.env.from-os.a", "TICAT_TEST_A")
+	persisted.Set("sys.env.from-os.b", "TICAT_TEST_B")
+	persisted.Set("sys.env.from-os.c", "TICAT_TEST_C")
+	persisted.Set("b", "persisted")
+	env.GetLayer(core.EnvLayerSession).Set("c", "session")
+	env.GetLayer(core.EnvLayerSession).Set("d", "session")
+	loadOsEnvForTest(env)
+
+	flow := &core.ParsedCmds{Cmds: []core.ParsedCmd{{}}}
+	SaveEnvToLocal(core.ArgVals{}, cc, env, flow, 0)
+
+	saved := core.NewEnv()
+	core.LoadEnvFromFile(saved, filepath.Join(dir, "env"), "=")
+	// The imported values are not saved, the rules are saved
+	for k, v := range map[string]string{
+		"a":                 "",
+		"b":                 "persisted",
+		"c":                 "session",
+		"d":                 "session",
+		"sys.env.from-os.a": "TICAT_TEST_A",
+	} {
+		if saved.GetRaw(k) != v {
+			t.Fatalf("%#v: saved %#v != %#v\n", k, saved.GetRaw(k), v)
+		}
+	}
+	if saved.Has("a") {
+		t.Fatalf("the imported key should not be saved\n")
+	}
+	// The env in use is not changed by saving
+	if env.GetRaw("a") != "os" || env.GetRaw("b") != "os" {
+		t.Fatalf("the imported values should be kept after saving\n")
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
 	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/cli/parser"
 	"github.com/pingcap/ticat/pkg/proto/flow_file"
 	"github.com/pingcap/ticat/pkg/proto/mod_meta"
 	"github.com/pingcap/ticat/pkg/utils"
@@ -38,7 +40,7 @@ func ListFlows(
 		}
 
 		cmdPath := getCmdPath(path, flowExt, flow.Cmds[currCmdIdx])
-		flowStrs, help, abbrsStr := flow_file.LoadFlowFile(path)
+		flowStrs, help, abbrsStr, args, flowMeta := flow_file.LoadFlowFile(path)
 		flowStr := strings.Join(flowStrs, " ")
 
 		matched := true
@@ -66,6 +68,8 @@ func ListFlows(
 			screen.Print("    " + display.ColorProp("- abbrs:", env) + "\n")
 			screen.Print(fmt.Sprintf("        %s\n", abbrsStr))
 		}
+		printFlowArgs(screen, args, env)
+		printFlowMeta(screen, flowMeta, env)
 		screen.Print("    " + display.ColorProp("- flow:", env) + "\n")
 		for _, flowStr := range flowStrs {
 			screen.Print("        " + display.ColorFlow(flowStr, env) + "\n")
@@ -171,6 +175,8 @@ func SaveFlow(
 	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, false, "to-cmd-path")
 	screen := display.NewCacheScreen()
 
+	args := parseFlowArgs(argv.GetRaw("args"), env, flow.Cmds[currCmdIdx])
+
 	_, err := os.Stat(filePath)
 	if !os.IsNotExist(err) {
 		if !env.GetBool("sys.interact") {
@@ -185,6 +191,10 @@ func SaveFlow(
 		}
 	}
 
+	tags := parseFlowTags(argv.GetRaw("tags"), env)
+	trivial := checkFlowTrivial(argv.GetRaw("trivial"), flow.Cmds[currCmdIdx])
+	flowMeta := flow_file.FlowMeta{"", "", strings.Join(tags, " "), trivial, "", ""}
+
 	w := bytes.NewBuffer(nil)
 	flow.RemoveLeadingCmds(1)
 
@@ -199,6 +209,8 @@ func SaveFlow(
 	flowStr := w.String()
 
 	screen.Print(fmt.Sprintf(display.ColorCmd("[%s]", env)+"\n", cmdPath))
+	printFlowArgs(screen, args, env)
+	printFlowMeta(screen, flowMeta, env)
 	screen.Print("    " + display.ColorProp("- flow:", env) + "\n")
 	screen.Print("        " + display.ColorFlow(flowStr, env) + "\n")
 	screen.Print("    " + display.ColorProp("- executable:", env) + "\n")
@@ -207,7 +219,7 @@ func SaveFlow(
 	dirPath := filepath.Dir(filePath)
 	os.MkdirAll(dirPath, os.ModePerm)
 
-	flow_file.SaveFlowFile(filePath, []string{flowStr}, "", "")
+	flow_file.SaveFlowFile(filePath, []string{flowStr}, "", "", args, flowMeta)
 
 	display.PrintTipTitle(cc.Screen, env,
 		"flow '"+cmdPath+"' is saved, can be used as a command")
@@ -224,14 +236,15 @@ func SetFlowHelpStr(
 
 	help := argv.GetRaw("help-str")
 	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, true, argv, cc, env, true, "cmd-path")
-	flowStrs, oldHelp, abbrsStr := flow_file.LoadFlowFile(filePath)
-	flow_file.SaveFlowFile(filePath, flowStrs, help, abbrsStr)
+	flowStrs, oldHelp, abbrsStr, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	flow_file.SaveFlowFile(filePath, flowStrs, help, abbrsStr, args, flowMeta)
 
 	display.PrintTipTitle(cc.Screen, env,
 		"help string of flow '"+cmdPath+"' is saved")
 
 	cc.Screen.Print(display.ColorCmd(fmt.Sprintf("[%s]", cmdPath), env) + "\n")
 	cc.Screen.Print("     " + display.ColorHelp("'"+help+"'", env) + "\n")
+	printFlowArgs(cc.Screen, args, env)
 	cc.Screen.Print("    " + display.ColorProp("- flow:", env) + "\n")
 	for _, flowStr := range flowStrs {
 		cc.Screen.Print("        " + display.ColorFlow(flowStr, env) + "\n")
@@ -366,7 +379,7 @@ func saveFlow(w io.Writer, flow *core.ParsedCmds, currCmdIdx int, cmdPathSep str
 			}
 			lastSegHasNoCmd = (seg.Matched.Cmd == nil)
 			cmdHasEnv = cmdHasEnv || saveFlowEnv(w, seg.Env, path, envPathSep,
-				bracketLeft, bracketRight, envKeyValSep,
+				bracketLeft, bracketRight, envKeyValSep, seqSep,
 				!cmdHasEnv && j == len(cmd.Segments)-1)
 		}
 	}
@@ -380,6 +393,7 @@ func saveFlowEnv(
 	bracketLeft string,
 	bracketRight string,
 	envKeyValSep string,
+	seqSep string,
 	useArgsFmt bool) bool {
 
 	if len(env) == 0 {
@@ -401,7 +415,9 @@ func saveFlowEnv(
 		if strings.HasPrefix(k, prefix) && len(k) != len(prefix) {
 			k = strings.Join(v.MatchedPath[len(prefixPath):], pathSep)
 		}
-		kvs = append(kvs, fmt.Sprintf("%v%s%v", k, envKeyValSep, quoteIfHasSpace(v.Val)))
+		// Spaces are kept in the quotes, the ticat syntax chars still need escaping after the quotes removed
+		val := parser.EscapeLiterals(v.Val, seqSep+bracketLeft+bracketRight+envKeyValSep)
+		kvs = append(kvs, fmt.Sprintf("%v%s%v", k, envKeyValSep, quoteIfNeeded(val)))
 	}
 
 	format := bracketLeft + "%s" + bracketRight
@@ -452,7 +468,7 @@ func getFlowCmdPath(
 	if !expectExists && fileExists(filePath) {
 		if !env.GetBool("sys.interact") {
 			panic(core.NewCmdError(flow.Cmds[currCmdIdx],
-				fmt.Sprintf("flow '%s' file '%s' exists", cmdPath, filePath)))
+				fmt.Sprintf("flow '%s' already exists, file '%s'", cmdPath, filePath)))
 		} else {
 			return
 		}
@@ -477,6 +493,139 @@ func checkAndConfirmIfFlowHasParseError(screen core.Screen, flow *core.ParsedCmd
 	return true
 }
 
+// Check the edited flow: parse errors first, then the env-ops
+func checkAndConfirmIfFlowHasError(cc *core.Cli, flow *core.ParsedCmds, env *core.Env, cmd core.ParsedCmd) bool {
+	if !checkAndConfirmIfFlowHasParseError(cc.Screen, flow, env) {
+		return false
+	}
+	if flow.FirstErr() != nil {
+		return true
+	}
+
+	checker := &core.EnvOpsChecker{}
+	result := []core.EnvOpsCheckResult{}
+	env = env.Clone()
+	core.CheckEnvOps(cc, flow, env, checker, true, EnvOpCmds(), &result)
+	fatals, _, _ := display.AggEnvOpsCheckResult(result)
+	if len(fatals.Result) == 0 {
+		return true
+	}
+
+	display.DumpEnvOpsCheckResult(cc.Screen, flow.Cmds, env, result, cc.Cmds.Strs.PathSep)
+	if !env.GetBool("sys.interact") {
+		panic(core.NewCmdError(cmd, "flow has 'read before write' on env keys"))
+	}
+	cc.Screen.Print(display.ColorTip("[confirm]", env) + " flow has env-ops errors, " +
+		"type " + display.ColorWarn("'y'", env) + " and press enter to force save:\n")
+	utils.UserConfirm()
+	return true
+}
+
+// Parse "<name>|<abbr>...=<default-val>,..." to the args of a flow file
+// The names of an arg are seperated by abbrs-sep, they can't be empty or be used by other args
+func parseFlowArgs(str string, env *core.Env, cmd core.ParsedCmd) (args []flow_file.FlowArg) {
+	listSep := env.GetRaw("strs.list-sep")
+	kvSep := env.GetRaw("strs.env-kv-sep")
+	abbrsSep := env.GetRaw("strs.abbrs-sep")
+	used := map[string]string{}
+	for _, it := range strings.Split(str, listSep) {
+		it = strings.TrimSpace(it)
+		if len(it) == 0 {
+			continue
+		}
+		var defVal string
+		i := strings.Index(it, kvSep)
+		if i >= 0 {
+			defVal = strings.TrimSpace(it[i+len(kvSep):])
+			it = strings.TrimSpace(it[:i])
+		}
+		var names []string
+		for _, name := range strings.Split(it, abbrsSep) {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				panic(core.NewCmdError(cmd, fmt.Sprintf("empty arg name in '%s'", str)))
+			}
+			if other, ok := used[name]; ok {
+				panic(core.NewCmdError(cmd, fmt.Sprintf("arg name '%s' is used more than once, in '%s' and '%s'",
+					name, other, it)))
+			}
+			used[name] = it
+			names = append(names, name)
+		}
+		args = append(args, flow_file.FlowArg{strings.Join(names, abbrsSep), defVal})
+	}
+	return
+}
+
+func printFlowArgs(screen core.Screen, args []flow_file.FlowArg, env *core.Env) {
+	if len(args) == 0 {
+		return
+	}
+	screen.Print("    " + display.ColorProp("- args:", env) + "\n")
+	for _, arg := range args {
+		defVal := arg.DefVal
+		if len(defVal) == 0 {
+			defVal = "''"
+		}
+		screen.Print(fmt.Sprintf("        %s = %s\n", display.ColorArg(arg.Names, env), defVal))
+	}
+}
+
+// Tags could be seperated by spaces or list-sep, the tag-mark is optional
+func parseFlowTags(str string, env *core.Env) (tags []string) {
+	tagMark := env.GetRaw("strs.tag-mark")
+	listSep := env.GetRaw("strs.list-sep")
+	for _, tag := range strings.Fields(strings.ReplaceAll(str, listSep, " ")) {
+		tag = strings.TrimPrefix(tag, tagMark)
+		if len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+func checkFlowTrivial(str string, cmd core.ParsedCmd) string {
+	if len(str) == 0 {
+		return str
+	}
+	if _, err := strconv.Atoi(str); err != nil {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("trivial level '%s' is not int", str)))
+	}
+	return str
+}
+
+func printFlowMeta(screen core.Screen, flowMeta flow_file.FlowMeta, env *core.Env) {
+	if len(flowMeta.Tags) != 0 {
+		tagMark := env.GetRaw("strs.tag-mark")
+		var tags []string
+		for _, tag := range strings.Fields(flowMeta.Tags) {
+			tags = append(tags, display.ColorTag(tagMark+tag, env))
+		}
+		screen.Print("    " + display.ColorProp("- tags:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", strings.Join(tags, " ")))
+	}
+	if len(flowMeta.Trivial) != 0 {
+		screen.Print("    " + display.ColorProp("- trivial:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", flowMeta.Trivial))
+	}
+	if len(flowMeta.Scoped) != 0 {
+		screen.Print("    " + display.ColorProp("- scoped:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", flowMeta.Scoped))
+	}
+	if len(flowMeta.Exports) != 0 {
+		screen.Print("    " + display.ColorProp("- export:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", flowMeta.Exports))
+	}
+	if len(flowMeta.Deprecated) != 0 {
+		screen.Print("    " + display.ColorProp("- deprecated:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", flowMeta.Deprecated))
+	}
+	if len(flowMeta.Redirect) != 0 {
+		screen.Print("    " + display.ColorProp("- redirect:", env) + "\n")
+		screen.Print(fmt.Sprintf("        %s\n", flowMeta.Redirect))
+	}
+}
+
 func getFlowRoot(env *core.Env, cmd core.ParsedCmd) string {
 	root := env.GetRaw("sys.paths.flows")
 	if len(root) == 0 {
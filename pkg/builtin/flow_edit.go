@@ -0,0 +1,406 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/proto/flow_file"
+	"github.com/pingcap/ticat/pkg/utils"
+)
+
+func RenameFlow(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return copyFlow(argv, cc, env, flow, currCmdIdx, true)
+}
+
+func CopyFlow(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	return copyFlow(argv, cc, env, flow, currCmdIdx, false)
+}
+
+func SetFlowAbbrs(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	abbrs := argv.GetRaw("abbrs")
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, help, oldAbbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	checkFlowAbbrs(cc.Cmds, flow.Cmds[currCmdIdx], cmdPath, abbrs)
+	flow_file.SaveFlowFile(filePath, flowStrs, help, abbrs, args, flowMeta)
+
+	display.PrintTipTitle(cc.Screen, env,
+		"abbrs of flow '"+cmdPath+"' is saved")
+
+	cc.Screen.Print(display.ColorCmd(fmt.Sprintf("[%s]", cmdPath), env) + "\n")
+	if len(abbrs) != 0 {
+		cc.Screen.Print("    " + display.ColorProp("- abbrs:", env) + "\n")
+		cc.Screen.Print(fmt.Sprintf("        %s\n", abbrs))
+	}
+	cc.Screen.Print("    " + display.ColorProp("- executable:", env) + "\n")
+	cc.Screen.Print(fmt.Sprintf("        %s\n", filePath))
+	if len(oldAbbrs) != 0 {
+		cc.Screen.Print("    " + display.ColorProp("- old-abbrs:", env) + "\n")
+		cc.Screen.Print(fmt.Sprintf("        %s\n", oldAbbrs))
+	}
+	return currCmdIdx, true
+}
+
+// Add or remove tags, or set the trivial level of a saved flow, show them if nothing to change
+func TagFlow(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, help, abbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+
+	adds := parseFlowTags(argv.GetRaw("add"), env)
+	removes := parseFlowTags(argv.GetRaw("remove"), env)
+	trivial := checkFlowTrivial(argv.GetRaw("trivial"), flow.Cmds[currCmdIdx])
+
+	if len(adds) != 0 || len(removes) != 0 || len(trivial) != 0 {
+		removed := map[string]bool{}
+		for _, tag := range removes {
+			removed[tag] = true
+		}
+		exists := map[string]bool{}
+		var tags []string
+		for _, tag := range append(strings.Fields(flowMeta.Tags), adds...) {
+			if removed[tag] || exists[tag] {
+				continue
+			}
+			exists[tag] = true
+			tags = append(tags, tag)
+		}
+		flowMeta.Tags = strings.Join(tags, " ")
+		if len(trivial) != 0 {
+			// Zero is the default level, no need to save
+			if trivial == "0" {
+				trivial = ""
+			}
+			flowMeta.Trivial = trivial
+		}
+		flow_file.SaveFlowFile(filePath, flowStrs, help, abbrs, args, flowMeta)
+		display.PrintTipTitle(cc.Screen, env,
+			"tags of flow '"+cmdPath+"' is saved")
+	} else {
+		display.PrintTipTitle(cc.Screen, env,
+			"tags of flow '"+cmdPath+"':")
+	}
+
+	cc.Screen.Print(display.ColorCmd(fmt.Sprintf("[%s]", cmdPath), env) + "\n")
+	printFlowMeta(cc.Screen, flowMeta, env)
+	cc.Screen.Print("    " + display.ColorProp("- executable:", env) + "\n")
+	cc.Screen.Print(fmt.Sprintf("        %s\n", filePath))
+	return currCmdIdx, true
+}
+
+func ListFlowSteps(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, _, _, _, _ := flow_file.LoadFlowFile(filePath)
+	steps := newFlowStepsText(env, flowStrs)
+
+	display.PrintTipTitle(cc.Screen, env,
+		"steps of flow '"+cmdPath+"':")
+	printFlowSteps(cc, env, cmdPath, filePath, steps)
+	return currCmdIdx, true
+}
+
+// The step indexes start from 1, insert with index 0 means append to the end.
+// The global env of the flow is not a step, it's always kept at the head.
+func InsertFlowStep(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, help, abbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	steps := newFlowStepsText(env, flowStrs)
+	inserting := getFlowStepArg(argv, cmd)
+
+	idx := argv.GetInt("index")
+	if idx == 0 {
+		idx = steps.StepCount() + 1
+	}
+	if idx < 1 || idx > steps.StepCount()+1 {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("step index %d out of range [1, %d]",
+			idx, steps.StepCount()+1)))
+	}
+
+	flowStrs = steps.Insert(idx, inserting)
+	if !saveFlowSteps(cc, env, cmd, filePath, flowStrs, help, abbrs, args, flowMeta) {
+		return currCmdIdx, false
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("step %d of flow '%s' is inserted", idx, cmdPath))
+	printFlowSteps(cc, env, cmdPath, filePath, newFlowStepsText(env, flowStrs))
+	return currCmdIdx, true
+}
+
+func ReplaceFlowStep(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, help, abbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	steps := newFlowStepsText(env, flowStrs)
+	idx := getFlowStepIdx(argv, steps, cmd)
+	replacing := getFlowStepArg(argv, cmd)
+
+	flowStrs = steps.Replace(idx, replacing)
+	if !saveFlowSteps(cc, env, cmd, filePath, flowStrs, help, abbrs, args, flowMeta) {
+		return currCmdIdx, false
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("step %d of flow '%s' is replaced", idx, cmdPath))
+	printFlowSteps(cc, env, cmdPath, filePath, newFlowStepsText(env, flowStrs))
+	return currCmdIdx, true
+}
+
+func RemoveFlowStep(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	flowStrs, help, abbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	steps := newFlowStepsText(env, flowStrs)
+	idx := getFlowStepIdx(argv, steps, cmd)
+	if steps.StepCount() == 1 {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("can't remove the only step of flow '%s', "+
+			"use 'flow.remove' to remove the flow", cmdPath)))
+	}
+
+	flowStrs = steps.Remove(idx)
+	if !saveFlowSteps(cc, env, cmd, filePath, flowStrs, help, abbrs, args, flowMeta) {
+		return currCmdIdx, false
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("step %d of flow '%s' is removed", idx, cmdPath))
+	printFlowSteps(cc, env, cmdPath, filePath, newFlowStepsText(env, flowStrs))
+	return currCmdIdx, true
+}
+
+func copyFlow(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int,
+	removeOrigin bool) (int, bool) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	cmdPath, filePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, true, "cmd-path")
+	toCmdPath, toFilePath := getFlowCmdPath(flow, currCmdIdx, false, argv, cc, env, false, "to-cmd-path")
+	if filePath == toFilePath {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("flow '%s' can't be copied to itself", cmdPath)))
+	}
+	if fileExists(toFilePath) {
+		if !env.GetBool("sys.interact") {
+			panic(core.NewCmdError(cmd,
+				fmt.Sprintf("flow '%s' already exists, file '%s'", toCmdPath, toFilePath)))
+		}
+		cc.Screen.Print(fmt.Sprintf(display.ColorTip("[confirm]", env)+
+			" flow file of '%s' exists, "+
+			"type "+display.ColorWarn("'y'", env)+" and press enter to "+
+			display.ColorWarn("overwrite:", env)+"\n", toCmdPath))
+		utils.UserConfirm()
+	}
+
+	flowStrs, help, abbrs, args, flowMeta := flow_file.LoadFlowFile(filePath)
+	// The abbrs belong to the path segments, a copy would conflict with the origin
+	if removeOrigin {
+		pathSep := cc.Cmds.Strs.PathSep
+		abbrs = renameFlowAbbrs(abbrs, strings.Split(cmdPath, pathSep), strings.Split(toCmdPath, pathSep), pathSep)
+	} else {
+		abbrs = ""
+	}
+	checkFlowAbbrs(cc.Cmds, cmd, toCmdPath, abbrs)
+	os.MkdirAll(filepath.Dir(toFilePath), os.ModePerm)
+	flow_file.SaveFlowFile(toFilePath, flowStrs, help, abbrs, args, flowMeta)
+
+	action := "copied"
+	if removeOrigin {
+		err := os.Remove(filePath)
+		if err != nil {
+			panic(core.NewCmdError(cmd, fmt.Sprintf("remove flow file '%s' failed: %v", filePath, err)))
+		}
+		action = "renamed"
+	}
+
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("flow '%s' is %s to '%s'", cmdPath, action, toCmdPath))
+	cc.Screen.Print(display.ColorCmd(fmt.Sprintf("[%s]", toCmdPath), env) + "\n")
+	if len(help) != 0 {
+		cc.Screen.Print("     " + display.ColorHelp("'"+help+"'", env) + "\n")
+	}
+	cc.Screen.Print("    " + display.ColorProp("- flow:", env) + "\n")
+	for _, flowStr := range flowStrs {
+		cc.Screen.Print("        " + display.ColorFlow(flowStr, env) + "\n")
+	}
+	cc.Screen.Print("    " + display.ColorProp("- executable:", env) + "\n")
+	cc.Screen.Print(fmt.Sprintf("        %s\n", toFilePath))
+	if removeOrigin {
+		cc.Screen.Print(fmt.Sprintf(display.ColorCmd("[%s]", env)+
+			display.ColorDisabled(" (removed)", env)+"\n", cmdPath))
+		cc.Screen.Print(fmt.Sprintf("    %s\n", filePath))
+	}
+	return currCmdIdx, true
+}
+
+// Keep the abbrs of the segments which names are not changed, the others are unrelated to the new names
+func renameFlowAbbrs(abbrs string, from []string, to []string, pathSep string) string {
+	if len(abbrs) == 0 {
+		return ""
+	}
+	segs := strings.Split(abbrs, pathSep)
+	var kept []string
+	for i, seg := range segs {
+		if i >= len(from) || i >= len(to) || from[i] != to[i] {
+			seg = ""
+		}
+		kept = append(kept, seg)
+	}
+	for len(kept) != 0 && len(kept[len(kept)-1]) == 0 {
+		kept = kept[:len(kept)-1]
+	}
+	return strings.Join(kept, pathSep)
+}
+
+// The abbrs of a flow are registered on loading, a conflicted one makes all commands fail, so check it before saving
+func checkFlowAbbrs(cmds *core.CmdTree, cmd core.ParsedCmd, cmdPath string, abbrs string) {
+	if len(abbrs) == 0 {
+		return
+	}
+	path := strings.Split(cmdPath, cmds.Strs.PathSep)
+	for i, seg := range strings.Split(abbrs, cmds.Strs.PathSep) {
+		if i >= len(path) {
+			break
+		}
+		parent := cmds.GetSub(path[:i]...)
+		if parent == nil {
+			break
+		}
+		for _, abbr := range strings.Split(seg, cmds.Strs.AbbrsSep) {
+			if len(abbr) == 0 {
+				continue
+			}
+			if old := parent.GetSub(abbr); old != nil && old.Name() != path[i] {
+				panic(core.NewCmdError(cmd, fmt.Sprintf("abbr '%s' of '%s' conflicted with command '%s'",
+					abbr, strings.Join(path[:i+1], cmds.Strs.PathSep), old.DisplayPath())))
+			}
+		}
+	}
+}
+
+func newFlowStepsText(env *core.Env, flowStrs []string) *flowText {
+	return newFlowText(flowStrs, flowTextStrs{
+		env.GetRaw("strs.seq-sep"),
+		env.GetRaw("strs.env-bracket-left"),
+		env.GetRaw("strs.env-bracket-right"),
+		env.GetRaw("strs.env-kv-sep"),
+	})
+}
+
+// The step is saved as it is, it could have more than one steps
+func getFlowStepArg(argv core.ArgVals, cmd core.ParsedCmd) string {
+	step := strings.TrimSpace(argv.GetRaw("step"))
+	if len(step) == 0 {
+		panic(core.NewCmdError(cmd, "arg 'step' is empty"))
+	}
+	return step
+}
+
+func getFlowStepIdx(argv core.ArgVals, steps *flowText, cmd core.ParsedCmd) int {
+	idx := argv.GetInt("index")
+	if idx < 1 || idx > steps.StepCount() {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("step index %d out of range [1, %d]",
+			idx, steps.StepCount())))
+	}
+	return idx
+}
+
+// Check the edited flow before saving, the templates are not rendered, comment lines are dropped
+func saveFlowSteps(
+	cc *core.Cli,
+	env *core.Env,
+	cmd core.ParsedCmd,
+	filePath string,
+	flowStrs []string,
+	help string,
+	abbrs string,
+	args []flow_file.FlowArg,
+	flowMeta flow_file.FlowMeta) bool {
+
+	stripped := core.StripFlowForExecute(flowStrs, env.GetRaw("strs.seq-sep"))
+	flowStr := strings.Join(stripped, " ")
+	input, err := shellwords.Parse(flowStr)
+	if err != nil {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("parse flow '%s' failed: %v", flowStr, err)))
+	}
+	parsed := cc.Parser.Parse(cc.Cmds, cc.EnvAbbrs, input...)
+	if !checkAndConfirmIfFlowHasError(cc, parsed, env, cmd) {
+		return false
+	}
+	flow_file.SaveFlowFile(filePath, flowStrs, help, abbrs, args, flowMeta)
+	return true
+}
+
+func printFlowSteps(
+	cc *core.Cli,
+	env *core.Env,
+	cmdPath string,
+	filePath string,
+	steps *flowText) {
+
+	cc.Screen.Print(display.ColorCmd(fmt.Sprintf("[%s]", cmdPath), env) + "\n")
+	if globalEnv := steps.GlobalEnv(); len(globalEnv) != 0 {
+		cc.Screen.Print("    " + display.ColorProp("- global-env:", env) + "\n")
+		cc.Screen.Print("        " + display.ColorFlow(globalEnv, env) + "\n")
+	}
+	cc.Screen.Print("    " + display.ColorProp("- steps:", env) + "\n")
+	for i := 1; i <= steps.StepCount(); i++ {
+		cc.Screen.Print(fmt.Sprintf("        %s %s\n",
+			display.ColorSymbol(fmt.Sprintf("[%d]", i), env),
+			display.ColorFlow(steps.Step(i), env)))
+	}
+	cc.Screen.Print("    " + display.ColorProp("- executable:", env) + "\n")
+	cc.Screen.Print(fmt.Sprintf("        %s\n", filePath))
+}
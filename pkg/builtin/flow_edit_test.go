@@ -0,0 +1,210 @@
+package builtin
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/proto/flow_file"
+)
+
+func TestRenameFlowAbbrs(t *testing.T) {
+	test := func(abbrs string, from string, to string, expected string) {
+		res := renameFlowAbbrs(abbrs, strings.Split(from, "."), strings.Split(to, "."), ".")
+		if res != expected {
+			t.Fatalf("%#v: rename %#v to %#v: %#v != %#v\n", abbrs, from, to, res, expected)
+		}
+	}
+
+	test("", "x.foo", "x.bar", "")
+	test("x.f", "x.foo", "x.bar", "x")
+	test("x.f", "x.foo", "y.foo", ".f")
+	test("x.f", "x.foo", "y.bar", "")
+	test("x.f|fo", "x.foo", "x.foo.sub", "x.f|fo")
+	test("x.f.s", "x.foo.sub", "x.foo", "x.f")
+	test("x|X.f.s", "x.foo.sub", "x.foo.bar", "x|X.f")
+}
+
+func TestCheckFlowAbbrs(t *testing.T) {
+	root := core.NewCmdTree(core.CmdTreeStrsForTest())
+	x := root.AddSub("x")
+	x.AddSub("foo", "f").RegEmptyCmd("flow foo")
+	x.AddSub("fix").RegEmptyCmd("flow fix")
+
+	check := func(cmdPath string, abbrs string) (err interface{}) {
+		defer func() {
+			err = recover()
+		}()
+		checkFlowAbbrs(root, core.ParsedCmd{}, cmdPath, abbrs)
+		return nil
+	}
+	test := func(cmdPath string, abbrs string) {
+		if err := check(cmdPath, abbrs); err != nil {
+			t.Fatalf("%#v %#v: unexpected error: %v\n", cmdPath, abbrs, err)
+		}
+	}
+	fail := func(cmdPath string, abbrs string) {
+		if err := check(cmdPath, abbrs); err == nil {
+			t.Fatalf("%#v %#v: should be failed\n", cmdPath, abbrs)
+		}
+	}
+
+	test("x.foo", "x.f")
+	test("x.foo", "X.f|fo")
+	test("x.bar", "x.b")
+	test("x.bar", "")
+	test("y.bar", "y.f")
+	// Used by other commands
+	fail("x.bar", "x.f")
+	fail("x.bar", ".fix")
+	fail("x.foo", "x.fix")
+}
+
+func TestCopyFlowNotInteractive(t *testing.T) {
+	dir := t.TempDir()
+	cc, env := newParserCliForTest(core.NewCmdTree(core.CmdTreeStrsForTest()))
+	env.Set("sys.paths.flows", dir)
+	env.SetBool("sys.interact", false)
+	flowExt := env.GetRaw("strs.flow-ext")
+	flow_file.SaveFlowFile(filepath.Join(dir, "x.a")+flowExt, []string{"dbg.echo a"}, "flow a", "", nil, flow_file.FlowMeta{})
+	flow_file.SaveFlowFile(filepath.Join(dir, "x.b")+flowExt, []string{"dbg.echo b"}, "flow b", "", nil, flow_file.FlowMeta{})
+
+	copy := func(to string) (err interface{}) {
+		defer func() {
+			err = recover()
+		}()
+		argv := core.ArgVals{"cmd-path": core.ArgVal{Raw: "x.a"}, "to-cmd-path": core.ArgVal{Raw: to}}
+		copyFlow(argv, cc, env, &core.ParsedCmds{Cmds: []core.ParsedCmd{{}}}, 0, false)
+		return nil
+	}
+
+	// Fail without asking for confirmation, the existing flow is not changed
+	err := copy("x.b")
+	if cmdErr, ok := err.(*core.CmdError); !ok || !strings.Contains(cmdErr.Error(), "already exists") {
+		t.Fatalf("copying to an existing flow should be failed, got: %v\n", err)
+	}
+	flowStrs, help, _, _, _ := flow_file.LoadFlowFile(filepath.Join(dir, "x.b") + flowExt)
+	if help != "flow b" || len(flowStrs) != 1 || flowStrs[0] != "dbg.echo b" {
+		t.Fatalf("the existing flow should not be changed: %#v %#v\n", help, flowStrs)
+	}
+
+	if err := copy("x.c"); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	flowStrs, help, _, _, _ = flow_file.LoadFlowFile(filepath.Join(dir, "x.c") + flowExt)
+	if help != "flow a" || len(flowStrs) != 1 || flowStrs[0] != "dbg.echo a" {
+		t.Fatalf("the flow is not copied: %#v %#v\n", help, flowStrs)
+	}
+}
+
+func TestParseFlowTags(t *testing.T) {
+	env := newFlowEnvForTest()
+	test := func(str string, expected ...string) {
+		tags := parseFlowTags(str, env)
+		if !reflect.DeepEqual(tags, expected) {
+			t.Fatalf("%#v: %#v != %#v\n", str, tags, expected)
+		}
+	}
+
+	test("")
+	test(" , @ ")
+	test("ready", "ready")
+	test("@ready", "ready")
+	test("ready selftest", "ready", "selftest")
+	test("@ready,@selftest", "ready", "selftest")
+	test(" ready , selftest  x", "ready", "selftest", "x")
+}
+
+func TestCheckFlowTrivial(t *testing.T) {
+	check := func(str string) (res string, err interface{}) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = r
+			}
+		}()
+		return checkFlowTrivial(str, core.ParsedCmd{}), nil
+	}
+
+	for _, str := range []string{"", "0", "1", "-1", "10"} {
+		if res, err := check(str); err != nil || res != str {
+			t.Fatalf("%#v: unexpected result %#v, error: %v\n", str, res, err)
+		}
+	}
+	for _, str := range []string{"x", "1.5", " 1", "1x"} {
+		_, err := check(str)
+		if cmdErr, ok := err.(*core.CmdError); !ok || !strings.Contains(cmdErr.Error(), "is not int") {
+			t.Fatalf("%#v: should be failed, got: %v\n", str, err)
+		}
+	}
+}
+
+func TestTagFlow(t *testing.T) {
+	dir := t.TempDir()
+	cc, env := newParserCliForTest(core.NewCmdTree(core.CmdTreeStrsForTest()))
+	env.Set("sys.paths.flows", dir)
+	env.GetLayer(core.EnvLayerDefault).Set("strs.list-sep", ",")
+	env.GetLayer(core.EnvLayerDefault).Set("strs.tag-mark", "@")
+	path := filepath.Join(dir, "x.a") + env.GetRaw("strs.flow-ext")
+	args := []flow_file.FlowArg{{Names: "host|h", DefVal: "127.0.0.1"}}
+	flow_file.SaveFlowFile(path, []string{"dbg.echo a"}, "flow a", "x.A", args,
+		flow_file.FlowMeta{Scoped: "x.", Tags: "old ready"})
+
+	tag := func(add string, remove string, trivial string) (err interface{}) {
+		defer func() {
+			err = recover()
+		}()
+		argv := core.ArgVals{
+			"cmd-path": core.ArgVal{Raw: "x.a"},
+			"add":      core.ArgVal{Raw: add},
+			"remove":   core.ArgVal{Raw: remove},
+			"trivial":  core.ArgVal{Raw: trivial},
+		}
+		TagFlow(argv, cc, env, &core.ParsedCmds{Cmds: []core.ParsedCmd{{}}}, 0)
+		return nil
+	}
+	check := func(tags string, trivial string) {
+		flowStrs, help, abbrs, savedArgs, flowMeta := flow_file.LoadFlowFile(path)
+		if flowMeta.Tags != tags || flowMeta.Trivial != trivial {
+			t.Fatalf("tags %#v, trivial %#v != %#v, %#v\n", flowMeta.Tags, flowMeta.Trivial, tags, trivial)
+		}
+		// The other parts of the flow are kept
+		if !reflect.DeepEqual(flowStrs, []string{"dbg.echo a"}) || help != "flow a" || abbrs != "x.A" ||
+			!reflect.DeepEqual(savedArgs, args) || flowMeta.Scoped != "x." {
+			t.Fatalf("the flow is changed: %#v %#v %#v %#v %#v\n", flowStrs, help, abbrs, savedArgs, flowMeta)
+		}
+	}
+	do := func(add string, remove string, trivial string) {
+		if err := tag(add, remove, trivial); err != nil {
+			t.Fatalf("%#v %#v %#v: unexpected error: %v\n", add, remove, trivial, err)
+		}
+	}
+
+	// Only list the tags
+	do("", "", "")
+	check("old ready", "")
+
+	do("@new,ready", "", "")
+	check("old ready new", "")
+	do("", "old @not-exists", "")
+	check("ready new", "")
+	// A tag both added and removed is removed
+	do("old x", "new x", "")
+	check("ready old", "")
+
+	do("", "", "2")
+	check("ready old", "2")
+	// The level is kept if not provided
+	do("y", "", "")
+	check("ready old y", "2")
+	// The default level is not saved
+	do("", "", "0")
+	check("ready old y", "")
+
+	// The bad level is not saved, neither the tags
+	if err := tag("z", "", "high"); err == nil {
+		t.Fatalf("the bad trivial level should be failed\n")
+	}
+	check("ready old y", "")
+}
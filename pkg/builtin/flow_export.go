@@ -0,0 +1,396 @@
+package builtin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+// Compile the flow into a bash script, sub-flows are expanded and templates are rendered on exporting,
+// the executable files are called with the same protocol as ticat: "<runner> <file> <session-dir> <args...>",
+// and the env is passed by the file "<session-dir>/env".
+// The executable files are embedded in the script, so it could run on other machines,
+// the "sys.*" keys are not exported since they are about the local ticat.
+func ExportFlowToBash(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	path := argv.GetRaw("to-file")
+	cmd := flow.Cmds[currCmdIdx]
+
+	flow.RemoveLeadingCmds(1)
+	if len(flow.Cmds) == 0 {
+		panic(core.NewCmdError(cmd, "no commands to export"))
+	}
+
+	w := bytes.NewBuffer(nil)
+	trivialMark := env.GetRaw("strs.trivial-mark")
+	saveFlow(w, flow, currCmdIdx, cc.Cmds.Strs.PathSep, trivialMark, env)
+	flowStr := w.String()
+
+	// The env will be modified during exporting, like it's executing
+	env = env.Clone()
+	exporter := newBashFlowExporter(cc, env)
+	exporter.exportFlow(env, flow)
+	script := exporter.script(flowStr, env.GetRaw("strs.session-env-file"))
+
+	if len(path) == 0 {
+		cc.Screen.Print(script)
+		return clearFlow(flow)
+	}
+
+	err := ioutil.WriteFile(path, []byte(script), 0755)
+	if err != nil {
+		panic(core.NewCmdError(cmd,
+			fmt.Sprintf("write script file '%s' failed: %v", path, err)))
+	}
+
+	tips := []interface{}{
+		fmt.Sprintf("flow is exported to '%s', %d executable steps", path, exporter.steps),
+	}
+	if len(exporter.skipped) != 0 {
+		tips = append(tips, "", "these commands can only run in ticat, they are not exported:", "")
+		for _, it := range exporter.skipped {
+			tips = append(tips, "    "+it)
+		}
+	}
+	display.PrintTipTitle(cc.Screen, env, tips...)
+	return clearFlow(flow)
+}
+
+type bashFlowExporter struct {
+	cc      *core.Cli
+	body    *bytes.Buffer
+	sysPath string
+	initEnv map[string]string
+	synced  map[string]string
+	deps    []string
+	metDeps map[string]bool
+	steps   int
+	scopes  int
+	skipped []string
+	// The embedded executable files, from the local path to the name in the script
+	mods     map[string]string
+	modPaths []string
+}
+
+func newBashFlowExporter(cc *core.Cli, env *core.Env) *bashFlowExporter {
+	exporter := &bashFlowExporter{
+		cc:      cc,
+		body:    bytes.NewBuffer(nil),
+		sysPath: env.GetRaw("strs.env-sys-path") + cc.Cmds.Strs.EnvPathSep,
+		metDeps: map[string]bool{},
+		mods:    map[string]string{},
+	}
+	exporter.initEnv = exporter.exportVals(env)
+	exporter.synced = exporter.initEnv
+	return exporter
+}
+
+func (self *bashFlowExporter) exportVals(env *core.Env) map[string]string {
+	vals := core.SessionFileVals(env.GetLayer(core.EnvLayerSession))
+	for k := range vals {
+		if strings.HasPrefix(k, self.sysPath) {
+			delete(vals, k)
+		} else {
+			checkExportedEnvVal(k, vals[k])
+		}
+	}
+	return vals
+}
+
+// The env file has one "key=value" per line, so values with multiple lines can't be passed to the files
+func checkExportedEnvVal(key string, val string) {
+	if strings.ContainsAny(key, "\n\x00") || strings.ContainsAny(val, "\n\x00") {
+		panic(fmt.Errorf("[ExportFlowToBash] env key '%s' has multi-line or binary value %#v, can't be exported to bash",
+			key, val))
+	}
+}
+
+func (self *bashFlowExporter) addDep(osCmd string) {
+	if !self.metDeps[osCmd] {
+		self.metDeps[osCmd] = true
+		self.deps = append(self.deps, osCmd)
+	}
+}
+
+// Return the path of the embedded file in the script
+func (self *bashFlowExporter) embed(path string) string {
+	name, ok := self.mods[path]
+	if !ok {
+		name = filepath.Base(path)
+		if len(self.mods) != 0 {
+			name = fmt.Sprintf("%d-%s", len(self.mods), name)
+		}
+		self.mods[path] = name
+		self.modPaths = append(self.modPaths, path)
+	}
+	return `"${mods}"/` + core.QuoteShellVal(name)
+}
+
+func (self *bashFlowExporter) exportFlow(env *core.Env, flow *core.ParsedCmds) {
+	sep := self.cc.Cmds.Strs.PathSep
+	for _, cmd := range flow.Cmds {
+		last := cmd.LastCmd()
+		if last == nil {
+			continue
+		}
+		cmdEnv, argv := cmd.ApplyMappingGenEnvAndArgv(env, self.cc.Cmds.Strs.EnvValDelAllMark, sep)
+		displayPath := cmd.DisplayPath(sep, true)
+
+		switch last.Type() {
+		case core.CmdTypeFile, core.CmdTypeDirWithCmd:
+			self.exportFile(cmdEnv, displayPath, last, argv)
+		case core.CmdTypeFlow:
+			self.exportSubFlow(env, cmdEnv, last, argv)
+		case core.CmdTypeFileNFlow:
+			self.exportSubFlow(env, cmdEnv, last, argv)
+			self.exportFile(cmdEnv, displayPath, last, argv)
+		case core.CmdTypeEmpty, core.CmdTypeEmptyDir:
+		default:
+			self.skipped = append(self.skipped, displayPath)
+			fmt.Fprintf(self.body, "\n# [%s] (%s) is not exported, it can only run in ticat\n",
+				displayPath, last.Type())
+		}
+	}
+}
+
+func (self *bashFlowExporter) exportSubFlow(env *core.Env, cmdEnv *core.Env, cmd *core.Cmd, argv core.ArgVals) {
+	subFlow, _ := cmd.Flow(argv, cmdEnv, false)
+	if len(subFlow) == 0 {
+		return
+	}
+	parsedFlow := self.cc.Parser.Parse(self.cc.Cmds, self.cc.EnvAbbrs, subFlow...)
+	err := parsedFlow.FirstErr()
+	if err != nil {
+		panic(err.Error)
+	}
+	if !cmd.IsScoped() {
+		parsedFlow.GlobalEnv.WriteNotArgTo(env, self.cc.Cmds.Strs.EnvValDelAllMark)
+		self.exportFlow(env, parsedFlow)
+		return
+	}
+
+	// The same as ticat, save the env before a scoped flow, and restore it when the flow finishes.
+	// The values of the command layer are recorded, they are not exported if the flow doesn't change them
+	self.scopes += 1
+	saved := fmt.Sprintf(`"${env_file}.scope.%d"`, self.scopes)
+	cmdVals := fmt.Sprintf(`"${env_file}.scope.%d.cmd"`, self.scopes)
+	fmt.Fprintf(self.body, "\n# [%s] is scoped, the env changes are discarded except the exported keys\n",
+		cmd.Owner().DisplayPath())
+	fmt.Fprintf(self.body, "cp \"${env_file}\" %s\n", saved)
+	fmt.Fprintf(self.body, ": > %s\n", cmdVals)
+	cmdLayer := cmdEnv.GetOrNewLayer(core.EnvLayerCmd)
+	layerVals := map[string]string{}
+	keys, vals := cmdLayer.Pairs()
+	for i, k := range keys {
+		if !strings.HasPrefix(k, self.sysPath) {
+			checkExportedEnvVal(k, vals[i].Raw)
+			layerVals[k] = vals[i].Raw
+		}
+	}
+	for _, k := range sortedKeys(layerVals) {
+		fmt.Fprintf(self.body, "echo %s=%s >> %s\n", core.QuoteShellVal(k), core.QuoteShellVal(layerVals[k]), cmdVals)
+	}
+
+	sessionEnv := env.GetLayer(core.EnvLayerSession)
+	scope := sessionEnv.BeginScope(cmdLayer)
+	parsedFlow.GlobalEnv.WriteNotArgTo(scope.Env(), self.cc.Cmds.Strs.EnvValDelAllMark)
+	self.exportFlow(scope.Env(), parsedFlow)
+	exports := cmd.ScopeExports()
+	scope.End(exports, self.cc.Cmds.Strs.EnvPathSep)
+	self.synced = self.exportVals(sessionEnv)
+
+	line := []string{"end_scope", saved, cmdVals}
+	for _, it := range exports {
+		line = append(line, core.QuoteShellVal(it))
+	}
+	fmt.Fprintf(self.body, "%s\n", strings.Join(line, " "))
+}
+
+func (self *bashFlowExporter) exportFile(env *core.Env, displayPath string, cmd *core.Cmd, argv core.ArgVals) {
+	if len(cmd.CmdLine()) == 0 {
+		return
+	}
+	for _, dep := range cmd.GetDepends() {
+		self.addDep(dep.OsCmd)
+	}
+
+	self.steps += 1
+	fmt.Fprintf(self.body, "\n# [%s]\n", displayPath)
+
+	// Only the changed values, the values written by the executed files are in the session file already
+	vals := self.exportVals(env)
+	for _, k := range sortedKeys(vals) {
+		v := vals[k]
+		old, ok := self.synced[k]
+		if ok && old == v {
+			continue
+		}
+		fmt.Fprintf(self.body, "set_env %s %s\n", core.QuoteShellVal(k), core.QuoteShellVal(v))
+	}
+	self.synced = vals
+
+	bin, args := cmd.FileRunner(env)
+	line := []string{core.QuoteShellVal(bin)}
+	for _, arg := range args {
+		line = append(line, core.QuoteShellVal(arg))
+	}
+	line = append(line, self.embed(cmd.CmdLine()), `"${session}"`)
+	cmdArgs := cmd.Args()
+	for _, name := range cmdArgs.Names() {
+		line = append(line, core.QuoteShellVal(argv[name].Raw))
+	}
+	fmt.Fprintf(self.body, "compact_env\n%s\n", strings.Join(line, " "))
+}
+
+func (self *bashFlowExporter) script(flowStr string, sessionFileName string) string {
+	mods := self.embeddedMods()
+
+	w := bytes.NewBuffer(nil)
+	fmt.Fprintf(w, "#!/usr/bin/env bash\n")
+	fmt.Fprintf(w, "# Exported by ticat from flow:\n#   %s\n", flowStr)
+	fmt.Fprintf(w, "set -euo pipefail\n")
+
+	if len(self.deps) != 0 {
+		fmt.Fprintf(w, "\n")
+		for _, dep := range self.deps {
+			dep = core.QuoteShellVal(dep)
+			fmt.Fprintf(w, "command -v %s >/dev/null || { echo \"os command %s not found\" >&2; exit 1; }\n",
+				dep, dep)
+		}
+	}
+
+	fmt.Fprintf(w, "\nsession=\"$(mktemp -d)\"\n")
+	fmt.Fprintf(w, "mods=\"$(mktemp -d)\"\n")
+	fmt.Fprintf(w, "trap 'rm -rf \"${session}\" \"${mods}\"' EXIT\n")
+	fmt.Fprintf(w, "env_file=\"${session}/%s\"\n", sessionFileName)
+	fmt.Fprintf(w, `
+set_env() {
+	echo "${1}=${2}" >> "${env_file}"
+}
+
+# The last value of a key is used, the same as ticat
+compact_env() {
+	awk '{ i = index($0, "="); k = substr($0, 1, i - 1); if (!(k in v)) ks[n++] = k; v[k] = $0 }
+		END { for (j = 0; j < n; j++) print v[ks[j]] }' "${env_file}" > "${env_file}.tmp"
+	mv "${env_file}.tmp" "${env_file}"
+}
+`)
+
+	if self.scopes != 0 {
+		fmt.Fprintf(w, `
+# Discard the env changes of a scoped flow, except the exported keys (or key prefixes end with "%s"),
+# an exported key still with the value from the caller's command layer is not changed by the flow, so it's discarded
+end_scope() {
+	local saved="${1}"
+	local cmd_vals="${2}"
+	shift 2
+	awk -v exports="${*}" -v sep=%s '
+		BEGIN { n = split(exports, es, " ") }
+		function exported(k,    j) {
+			for (j = 1; j <= n; j++) {
+				if (k == es[j] || (substr(es[j], length(es[j])) == sep && index(k, es[j]) == 1)) return 1
+			}
+			return 0
+		}
+		{ i = index($0, "="); k = substr($0, 1, i - 1) }
+		FILENAME == ARGV[1] { cmd[k] = $0; next }
+		FILENAME == ARGV[2] { if (!exported(k)) print; else old[k] = $0; next }
+		exported(k) { if (!(k in cmd) || cmd[k] != $0) print; else if (k in old) print old[k] }' \
+		"${cmd_vals}" "${saved}" "${env_file}" > "${env_file}.tmp"
+	mv "${env_file}.tmp" "${env_file}"
+	rm -f "${saved}" "${cmd_vals}"
+}
+`, self.cc.Cmds.Strs.EnvPathSep, core.QuoteShellVal(self.cc.Cmds.Strs.EnvPathSep))
+	}
+
+	initEnv := bytes.NewBuffer(nil)
+	for _, k := range sortedKeys(self.initEnv) {
+		fmt.Fprintf(initEnv, "%s=%s\n", k, self.initEnv[k])
+	}
+	delimiter := heredocDelimiter(initEnv.Bytes(), "TICAT_ENV")
+	fmt.Fprintf(w, "\ncat > \"${env_file}\" <<'%s'\n", delimiter)
+	w.Write(initEnv.Bytes())
+	fmt.Fprintf(w, "%s\n", delimiter)
+
+	w.Write(mods)
+	w.Write(self.body.Bytes())
+	return w.String()
+}
+
+// The text files are embedded as they are, the others are in base64
+func (self *bashFlowExporter) embeddedMods() []byte {
+	w := bytes.NewBuffer(nil)
+	for i, path := range self.modPaths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			panic(fmt.Errorf("[ExportFlowToBash] read executable file '%s' failed: %v", path, err))
+		}
+		file := `"${mods}"/` + core.QuoteShellVal(self.mods[path])
+		delimiter := fmt.Sprintf("TICAT_MOD_%d", i)
+		w.WriteString("\n")
+		if isEmbeddableText(data, delimiter) {
+			fmt.Fprintf(w, "cat > %s <<'%s'\n", file, delimiter)
+			w.Write(data)
+			if !bytes.HasSuffix(data, []byte("\n")) {
+				w.WriteString("\n")
+			}
+		} else {
+			self.addDep("base64")
+			fmt.Fprintf(w, "base64 -d > %s <<'%s'\n", file, delimiter)
+			encoded := base64.StdEncoding.EncodeToString(data)
+			for len(encoded) > 76 {
+				fmt.Fprintf(w, "%s\n", encoded[:76])
+				encoded = encoded[76:]
+			}
+			fmt.Fprintf(w, "%s\n", encoded)
+		}
+		fmt.Fprintf(w, "%s\nchmod +x %s\n", delimiter, file)
+	}
+	return w.Bytes()
+}
+
+func isEmbeddableText(data []byte, delimiter string) bool {
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return false
+	}
+	return !hasLine(data, delimiter)
+}
+
+// Pick a delimiter not in the text, for embedding the text as it is
+func heredocDelimiter(data []byte, base string) string {
+	delimiter := base
+	for i := 1; hasLine(data, delimiter); i++ {
+		delimiter = fmt.Sprintf("%s_%d", base, i)
+	}
+	return delimiter
+}
+
+func hasLine(data []byte, line string) bool {
+	for _, it := range strings.Split(string(data), "\n") {
+		if it == line {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(vals map[string]string) (keys []string) {
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
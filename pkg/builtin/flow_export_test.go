@@ -0,0 +1,192 @@
+package builtin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/parser"
+)
+
+func newParserCliForTest(tree *core.CmdTree) (*core.Cli, *core.Env) {
+	env := newSelfTestEnvForTest()
+	env.GetLayer(core.EnvLayerDefault).Set("sys.ext.exec.sh", "bash")
+	env.GetLayer(core.EnvLayerDefault).Set("strs.env-sys-path", "sys")
+	tokenizer := parser.NewTokenizer(":{= \t")
+	seqParser := parser.NewSequenceParser(":", nil, []string{"//"})
+	envParser := parser.NewEnvParser(parser.Brackets{Left: "{", Right: "}"}, " \t", "=", ".")
+	cmdParser := parser.NewCmdParser(envParser, ".", ".", " \t", "<root>", "@")
+	cliParser := parser.NewParser(tokenizer, seqParser, cmdParser)
+	return core.NewCli(env, &core.QuietScreen{}, tree, cliParser, core.NewEnvAbbrs("<root>")), env
+}
+
+func exportFlowForTest(t *testing.T, cc *core.Cli, env *core.Env, input ...string) (script string, exporter *bashFlowExporter) {
+	flow := cc.Parser.Parse(cc.Cmds, cc.EnvAbbrs, input...)
+	if err := flow.FirstErr(); err != nil {
+		t.Fatalf("%#v: parse failed: %v\n", input, err.Error)
+	}
+	// The global env of the flow is applied before exporting, the same as executing
+	env = env.Clone()
+	if flow.GlobalEnv != nil {
+		flow.GlobalEnv.WriteNotArgTo(env.GetLayer(core.EnvLayerSession), cc.Cmds.Strs.EnvValDelAllMark)
+	}
+	exporter = newBashFlowExporter(cc, env)
+	exporter.exportFlow(env, flow)
+	return exporter.script(strings.Join(input, " "), "env"), exporter
+}
+
+func TestExportFlowToBash(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0755); err != nil {
+			t.Fatalf("write file '%s' failed: %v\n", path, err)
+		}
+		return path
+	}
+	step := writeFile("step.sh", "echo step\nTICAT_MOD_0\n")
+	bin := writeFile("bin.sh", "echo \x00\xff\n")
+
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	x := tree.AddSub("x")
+	x.AddSub("step").RegFileCmd(step, "step for test").AddArg("msg", "")
+	x.AddSub("bin").RegFileCmd(bin, "binary step for test")
+	x.AddSub("scoped").RegFlowCmd([]string{"{b=2}", ":", "x.bin"}, "scoped flow for test").SetScoped("b")
+
+	cc, env := newParserCliForTest(tree)
+	env.GetLayer(core.EnvLayerSession).Set("sys.not-exported", "1")
+	script, exporter := exportFlowForTest(t, cc, env,
+		"{a=it's&b}", ":", "x.step", "msg=hi there", ":", "x.step", "msg=x|y", ":", "x.scoped", ":", "x.step")
+
+	if exporter.steps != 4 {
+		t.Fatalf("executable steps %d != 4\n", exporter.steps)
+	}
+	for _, expected := range []string{
+		// The initial env, sys keys are not exported
+		"cat > \"${env_file}\" <<'TICAT_ENV'\na=it's&b\nTICAT_ENV\n",
+		// The text file has a line same as the delimiter, so it's in base64 as the binary file
+		"base64 -d > \"${mods}\"/step.sh <<'TICAT_MOD_0'\nZWNobyBzdGVwClRJQ0FUX01PRF8wCg==\nTICAT_MOD_0\n",
+		"base64 -d > \"${mods}\"/1-bin.sh <<'TICAT_MOD_1'\nZWNobyAA/wo=\nTICAT_MOD_1\n",
+		"command -v base64 >/dev/null",
+		// The runner lines with quoted args, no env changes
+		"\n# [x.step]\ncompact_env\nbash \"${mods}\"/step.sh \"${session}\" 'hi there'\n",
+		"\n# [x.step]\ncompact_env\nbash \"${mods}\"/step.sh \"${session}\" 'x|y'\n",
+		// The scoped flow sets env, and keeps the exported key when it ends
+		"cp \"${env_file}\" \"${env_file}.scope.1\"\n: > \"${env_file}.scope.1.cmd\"\n\n# [x.bin]\nset_env b 2\ncompact_env\n" +
+			"bash \"${mods}\"/1-bin.sh \"${session}\"\nend_scope \"${env_file}.scope.1\" \"${env_file}.scope.1.cmd\" b\n",
+		// The exported key is synced, not set again
+		"end_scope \"${env_file}.scope.1\" \"${env_file}.scope.1.cmd\" b\n\n# [x.step]\ncompact_env\nbash \"${mods}\"/step.sh \"${session}\" ''\n",
+		"end_scope() {",
+		"awk -v exports=\"${*}\" -v sep=. '",
+		"compact_env() {",
+		"set_env() {",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Fatalf("%#v not in the script:\n%s\n", expected, script)
+		}
+	}
+	if strings.Contains(script, "sys.not-exported") {
+		t.Fatalf("sys keys should not be exported:\n%s\n", script)
+	}
+}
+
+func TestIsEmbeddableText(t *testing.T) {
+	test := func(data string, expected bool) {
+		if isEmbeddableText([]byte(data), "EOF") != expected {
+			t.Fatalf("%#v: embeddable should be %v\n", data, expected)
+		}
+	}
+
+	test("echo hi\n", true)
+	test("cat <<EOF\nEOF_X\n", true)
+	test("cat <<EOF\nEOF\n", false)
+	test("a\x00b", false)
+	test("\xff\xfe", false)
+}
+
+func TestExportScopedFlowWithCmdEnv(t *testing.T) {
+	dir := t.TempDir()
+	step := filepath.Join(dir, "step.sh")
+	if err := ioutil.WriteFile(step, []byte("echo 'x.written=2' >> \"${1}/env\"\n"), 0755); err != nil {
+		t.Fatalf("write file '%s' failed: %v\n", step, err)
+	}
+
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	x := tree.AddSub("x")
+	x.AddSub("step").RegFileCmd(step, "step for test")
+	x.AddSub("scoped").RegFlowCmd([]string{"x.step"}, "scoped flow for test").SetScoped("x.")
+
+	cc, env := newParserCliForTest(tree)
+	env.GetLayer(core.EnvLayerSession).Set("x.old", "0")
+	script, exporter := exportFlowForTest(t, cc, env, "x.step", ":", "x{old=1}{new=1}.scoped")
+
+	for _, expected := range []string{
+		// The values of the command layer are recorded for end_scope
+		": > \"${env_file}.scope.1.cmd\"\n" +
+			"echo x.new=1 >> \"${env_file}.scope.1.cmd\"\n" +
+			"echo x.old=1 >> \"${env_file}.scope.1.cmd\"\n",
+		// They are visible in the scoped flow
+		"set_env x.new 1\nset_env x.old 1\ncompact_env\n",
+		"end_scope \"${env_file}.scope.1\" \"${env_file}.scope.1.cmd\" x.\n",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Fatalf("%#v not in the script:\n%s\n", expected, script)
+		}
+	}
+	// The values of the command layer match the exports, but they are not exported
+	if exporter.synced["x.old"] != "0" {
+		t.Fatalf("x.old should be restored: %#v\n", exporter.synced)
+	}
+	if _, ok := exporter.synced["x.new"]; ok {
+		t.Fatalf("x.new should be discarded: %#v\n", exporter.synced)
+	}
+}
+
+func TestHeredocDelimiter(t *testing.T) {
+	test := func(data string, expected string) {
+		if delimiter := heredocDelimiter([]byte(data), "EOF"); delimiter != expected {
+			t.Fatalf("%#v: delimiter %#v != %#v\n", data, delimiter, expected)
+		}
+	}
+
+	test("a=1\n", "EOF")
+	test("a=1\nEOF=\n", "EOF")
+	test("a=1\nEOF\n", "EOF_1")
+	test("EOF\nEOF_1\nEOF_3\n", "EOF_2")
+}
+
+func TestExportMultiLineEnvVal(t *testing.T) {
+	dir := t.TempDir()
+	step := filepath.Join(dir, "step.sh")
+	if err := ioutil.WriteFile(step, []byte("echo step\n"), 0755); err != nil {
+		t.Fatalf("write file '%s' failed: %v\n", step, err)
+	}
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	tree.AddSub("step").RegFileCmd(step, "step for test")
+
+	export := func(env *core.Env) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = r.(error)
+			}
+		}()
+		cc, _ := newParserCliForTest(tree)
+		exportFlowForTest(t, cc, env, "step")
+		return
+	}
+
+	_, env := newParserCliForTest(tree)
+	env.GetLayer(core.EnvLayerSession).Set("a", "x\ny")
+	if err := export(env); err == nil || !strings.Contains(err.Error(), "multi-line") {
+		t.Fatalf("the multi-line value should not be exported, got: %v\n", err)
+	}
+
+	// The sys keys are not exported, so they are not checked
+	_, env = newParserCliForTest(tree)
+	env.GetLayer(core.EnvLayerSession).Set("sys.a", "x\ny")
+	if err := export(env); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+}
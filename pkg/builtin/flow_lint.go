@@ -0,0 +1,403 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/proto/flow_file"
+	meta "github.com/pingcap/ticat/pkg/proto/hub_meta"
+)
+
+// Check flows without executing them: parse errors, unresolvable command paths, missed template keys,
+// env-ops errors, missed os-commands and dangling abbrs.
+// Return false if any problem is found, so it could be used in the CI of hub repos.
+// Using deprecated or redirected commands are warnings, they don't fail the linting.
+func LintFlows(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	cmd := flow.Cmds[currCmdIdx]
+
+	var roots []string
+	path := argv.GetRaw("path")
+	if len(path) != 0 {
+		roots = getLintRoots(path, cc, env, cmd)
+	}
+
+	cmds := collectFlowCmds(cc.Cmds, roots, nil)
+	if len(cmds) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no flows to lint.")
+		return currCmdIdx, true
+	}
+
+	screen := display.NewCacheScreen()
+	failed := 0
+	warned := 0
+	for _, it := range cmds {
+		problems, warnings := lintFlow(cc, env, it)
+		if len(problems) == 0 && len(warnings) == 0 {
+			continue
+		}
+		if len(problems) != 0 {
+			failed += 1
+		} else {
+			warned += 1
+		}
+		screen.Print(display.ColorCmd("["+it.Owner().DisplayPath()+"]", env) + "\n")
+		screen.Print("    " + display.ColorProp("- file:", env) + "\n")
+		screen.Print("        " + it.MetaFile() + "\n")
+		if len(problems) != 0 {
+			screen.Print("    " + display.ColorProp("- problems:", env) + "\n")
+		}
+		for _, problem := range problems {
+			screen.Print("        " + display.ColorError(problem, env) + "\n")
+		}
+		if len(warnings) != 0 {
+			screen.Print("    " + display.ColorProp("- warnings:", env) + "\n")
+		}
+		for _, warning := range warnings {
+			screen.Print("        " + display.ColorWarn(warning, env) + "\n")
+		}
+	}
+
+	screen.WriteTo(cc.Screen)
+	if failed == 0 {
+		if warned == 0 {
+			display.PrintTipTitle(cc.Screen, env,
+				fmt.Sprintf("all %d flows passed linting.", len(cmds)))
+		} else {
+			display.PrintTipTitle(cc.Screen, env,
+				fmt.Sprintf("all %d flows passed linting, %d of them with warnings.", len(cmds), warned))
+		}
+		return currCmdIdx, true
+	}
+	display.PrintErrTitle(cc.Screen, env,
+		fmt.Sprintf("%d of %d flows failed linting.", failed, len(cmds)))
+	return currCmdIdx, false
+}
+
+// The path could be a dir or a find-str of repos in hub, the dir will be loaded if it's not loaded yet
+func getLintRoots(path string, cc *core.Cli, env *core.Env, cmd core.ParsedCmd) (roots []string) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		root := absPath(path)
+		if !isLoadedDir(root, env, cmd) {
+			loadLocalMods(cc, root,
+				env.GetRaw("strs.repos-file-name"),
+				env.GetRaw("strs.meta-ext"),
+				env.GetRaw("strs.flow-ext"),
+				env.GetRaw("strs.help-ext"),
+				env.GetRaw("strs.abbrs-sep"),
+				env.GetRaw("strs.env-path-sep"),
+				root,
+				env.GetBool("sys.panic.recover"))
+		}
+		return []string{root}
+	}
+
+	metaPath := getReposInfoPath(env, cmd)
+	fieldSep := env.GetRaw("strs.proto-sep")
+	infos, _ := meta.ReadReposInfoFile(metaPath, true, fieldSep)
+	for _, info := range infos {
+		if info.OnOff != "on" || !matchFindRepoInfo(info, path) {
+			continue
+		}
+		roots = append(roots, absPath(info.Path))
+	}
+	if len(roots) == 0 {
+		panic(core.NewCmdError(cmd,
+			fmt.Sprintf("'%s' is not a dir, and no enabled repo in hub matches it", path)))
+	}
+	return
+}
+
+func isLoadedDir(dir string, env *core.Env, cmd core.ParsedCmd) bool {
+	if isUnderDir(dir, absPath(getFlowRoot(env, cmd))) {
+		return true
+	}
+	metaPath := getReposInfoPath(env, cmd)
+	fieldSep := env.GetRaw("strs.proto-sep")
+	infos, _ := meta.ReadReposInfoFile(metaPath, true, fieldSep)
+	for _, info := range infos {
+		if info.OnOff == "on" && isUnderDir(dir, absPath(info.Path)) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectFlowCmds(tree *core.CmdTree, roots []string, cmds []*core.Cmd) []*core.Cmd {
+	cmd := tree.Cmd()
+	if cmd != nil && (cmd.Type() == core.CmdTypeFlow || cmd.Type() == core.CmdTypeFileNFlow) {
+		matched := len(roots) == 0
+		for _, root := range roots {
+			if isUnderDir(absPath(cmd.MetaFile()), root) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			cmds = append(cmds, cmd)
+		}
+	}
+	for _, name := range tree.SubNames() {
+		cmds = collectFlowCmds(tree.GetSub(name), roots, cmds)
+	}
+	return cmds
+}
+
+func lintFlow(cc *core.Cli, env *core.Env, cmd *core.Cmd) (problems []string, warnings []string) {
+	cmdPath := cmd.Owner().DisplayPath()
+	env = env.Clone()
+
+	_, _, abbrs, _, _ := flow_file.LoadFlowFile(cmd.MetaFile())
+	problems = append(problems, lintFlowAbbrs(cmd, abbrs)...)
+
+	// Call the flow as the caller does, the args without default values are provided by the caller
+	input := []string{cmdPath}
+	args := cmd.Args()
+	for _, name := range args.Names() {
+		if len(args.DefVal(name)) == 0 {
+			input = append(input, name+env.GetRaw("strs.env-kv-sep")+lintPlaceholder)
+		}
+	}
+	parsed := cc.Parser.Parse(cc.Cmds, cc.EnvAbbrs, input...)
+	if err := parsed.FirstErr(); err != nil {
+		return append(problems, "parse failed: "+err.Error.Error()), nil
+	}
+
+	cmdEnv, argv := parsed.Cmds[0].ApplyMappingGenEnvAndArgv(env, cc.Cmds.Strs.EnvValDelAllMark,
+		cc.Cmds.Strs.PathSep)
+	rendered, renderProblems := lintFlowTemplates(cmd, argv, cmdEnv)
+	problems = append(problems, renderProblems...)
+	stepProblems, warnings := lintFlowSteps(cc, env, rendered)
+	problems = append(problems, stepProblems...)
+
+	// Env-ops checking needs a fully rendered and parsed flow
+	if len(renderProblems) == 0 && len(stepProblems) == 0 {
+		problems = append(problems, lintFlowEnvOps(cc, env, parsed)...)
+	}
+	problems = append(problems, lintFlowDepends(cc, env, parsed)...)
+	return
+}
+
+// Abbrs are registered to the command tree when loading, the conflicted ones are not in the tree
+func lintFlowAbbrs(cmd *core.Cmd, abbrsStr string) (problems []string) {
+	if len(abbrsStr) == 0 {
+		return
+	}
+	tree := cmd.Owner()
+	path := tree.Path()
+	strs := tree.Strs
+
+	abbrs := make([][]string, len(path))
+	if cmd.Type() == core.CmdTypeFlow {
+		// Each segment of a flow's path has its own abbrs
+		segs := strings.Split(abbrsStr, strs.PathSep)
+		if len(segs) > len(path) {
+			problems = append(problems, fmt.Sprintf("abbrs '%s' has more segments than the command path, "+
+				"'%s' is ignored", abbrsStr, strings.Join(segs[len(path):], strs.PathSep)))
+			segs = segs[:len(path)]
+		}
+		for i, seg := range segs {
+			abbrs[i] = strings.Split(seg, strs.AbbrsSep)
+		}
+	} else {
+		abbrs[len(path)-1] = strings.Split(abbrsStr, strs.AbbrsSep)
+	}
+
+	nodes := []*core.CmdTree{}
+	for it := tree; !it.IsRoot(); it = it.Parent() {
+		nodes = append([]*core.CmdTree{it}, nodes...)
+	}
+	for i, node := range nodes {
+		for _, abbr := range abbrs[i] {
+			if len(abbr) == 0 {
+				continue
+			}
+			realname := node.Realname(abbr)
+			if realname == node.Name() {
+				continue
+			}
+			if len(realname) == 0 {
+				problems = append(problems, fmt.Sprintf("abbr '%s' of '%s' is not registered", abbr, node.Name()))
+			} else {
+				problems = append(problems, fmt.Sprintf("abbr '%s' of '%s' is taken by '%s'",
+					abbr, node.Name(), realname))
+			}
+		}
+	}
+	return
+}
+
+// The missed keys are filled with placeholders, so all of them could be found in one pass
+func lintFlowTemplates(cmd *core.Cmd, argv core.ArgVals, env *core.Env) (flow []string, problems []string) {
+	filled := map[string]bool{}
+	for {
+		flow, err := tryRenderFlow(cmd, argv, env)
+		if err == nil {
+			return flow, problems
+		}
+		key := ""
+		switch e := err.(type) {
+		case core.CmdMissedEnvValWhenRenderFlow:
+			key = e.MissedKey
+			// The key could be provided by the mapping arg, the caller's business
+			if len(e.MappingArg) == 0 {
+				problems = append(problems, "template key '"+key+"' not found in env or args")
+			}
+		case core.CmdMissedArgValWhenRenderFlow:
+			key = e.MissedArg
+		default:
+			return nil, append(problems, "render failed: "+err.Error())
+		}
+		if filled[key] {
+			return nil, append(problems, "render failed: "+err.Error())
+		}
+		filled[key] = true
+		env.Set(key, lintPlaceholder)
+	}
+}
+
+func tryRenderFlow(cmd *core.Cmd, argv core.ArgVals, env *core.Env) (flow []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	flow, _ = cmd.RenderedFlowStrs(argv, env, false)
+	return
+}
+
+func lintFlowSteps(cc *core.Cli, env *core.Env, flow []string) (problems []string, warnings []string) {
+	if len(flow) == 0 {
+		return
+	}
+	flowStr := strings.Join(core.StripFlowForExecute(flow, env.GetRaw("strs.seq-sep")), " ")
+	input, err := shellwords.Parse(flowStr)
+	if err != nil {
+		return []string{fmt.Sprintf("parse '%s' failed: %v", flowStr, err)}, nil
+	}
+	parsed := cc.Parser.Parse(cc.Cmds, cc.EnvAbbrs, input...)
+	for _, it := range parsed.Cmds {
+		err := it.ParseResult.Error
+		if err == nil {
+			warnings = append(warnings, lintDeprecatedStep(cc, it)...)
+			continue
+		}
+		if _, ok := err.(core.ParseErrExpectCmd); ok {
+			problems = append(problems, "unresolvable command path: "+err.Error())
+		} else {
+			problems = append(problems, "parse failed: "+err.Error())
+		}
+	}
+	return
+}
+
+func lintDeprecatedStep(cc *core.Cli, step core.ParsedCmd) (warnings []string) {
+	path := step.DisplayPath(cc.Cmds.Strs.PathSep, false)
+	if from := step.RedirectFrom; from != nil && !from.Cmd().IsAlias() {
+		warning := fmt.Sprintf("command '%s' is redirected to '%s', use the new path",
+			from.DisplayPath(), from.Cmd().Redirect())
+		if len(from.Cmd().DeprecatedMsg()) != 0 {
+			warning += ": " + from.Cmd().DeprecatedMsg()
+		}
+		warnings = append(warnings, warning)
+	}
+	if last := step.LastCmd(); last != nil && last.IsDeprecated() {
+		warning := fmt.Sprintf("command '%s' is deprecated", path)
+		if len(last.DeprecatedMsg()) != 0 {
+			warning += ": " + last.DeprecatedMsg()
+		}
+		warnings = append(warnings, warning)
+	}
+	return
+}
+
+func lintFlowEnvOps(cc *core.Cli, env *core.Env, flow *core.ParsedCmds) (problems []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			problems = append(problems, fmt.Sprintf("env-ops check failed: %v", r))
+		}
+	}()
+
+	checker := &core.EnvOpsChecker{}
+	result := []core.EnvOpsCheckResult{}
+	// The env-op commands (eg: env.reset) are not passed, or they will be executed in checking
+	core.CheckEnvOps(cc, flow, env, checker, true, nil, &result)
+	for _, it := range result {
+		if it.ReadNotExist || it.MayReadNotExist {
+			problems = append(problems, fmt.Sprintf("env key '%s' is read by [%s] but not provided",
+				it.Key, it.CmdDisplayPath))
+		} else {
+			problems = append(problems, fmt.Sprintf("env key '%s' is read by [%s] but may not be written",
+				it.Key, it.CmdDisplayPath))
+		}
+	}
+	return
+}
+
+func lintFlowDepends(cc *core.Cli, env *core.Env, flow *core.ParsedCmds) (problems []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			problems = append(problems, fmt.Sprintf("os-commands check failed: %v", r))
+		}
+	}()
+
+	deps := core.Depends{}
+	core.CollectDepends(cc, env, flow, 0, deps, true, nil)
+	osCmds := []string{}
+	for osCmd, _ := range deps {
+		osCmds = append(osCmds, osCmd)
+	}
+	sort.Strings(osCmds)
+
+	for _, osCmd := range osCmds {
+		state := display.CheckOsCmd(cc.VersionProbes, deps, osCmd)
+		if state.Satisfied() {
+			continue
+		}
+		var users []string
+		for cmd, _ := range deps[osCmd] {
+			users = append(users, "["+cmd.Owner().DisplayPath()+"]")
+		}
+		sort.Strings(users)
+		reason := "not found"
+		if state.Exists {
+			reason = "version " + state.VersionErr
+		}
+		problems = append(problems, fmt.Sprintf("os command '%s' %s, used by %s",
+			osCmd, reason, strings.Join(users, " ")))
+	}
+	return
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+func isUnderDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+const lintPlaceholder = "0"
@@ -0,0 +1,111 @@
+package builtin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestLintFlowAbbrs(t *testing.T) {
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	x := tree.AddSub("x", "X")
+	foo := x.AddSub("foo", "f", "fo").RegFlowCmd([]string{"x.bar"}, "flow foo")
+	x.AddSub("bar", "b").RegEmptyCmd("cmd bar")
+	file := x.AddSub("run", "r").RegFileNFlowCmd([]string{"x.bar"}, "/path/to/run", "file and flow run")
+
+	tests := []struct {
+		cmd      *core.Cmd
+		abbrs    string
+		problems []string
+	}{
+		{foo, "", nil},
+		{foo, "X.f|fo", nil},
+		{foo, "x.f", nil},
+		{foo, ".f", nil},
+		{foo, "X.z", []string{"abbr 'z' of 'foo' is not registered"}},
+		{foo, "Y.f", []string{"abbr 'Y' of 'x' is not registered"}},
+		{foo, "X.b", []string{"abbr 'b' of 'foo' is taken by 'bar'"}},
+		{foo, "X.f.s", []string{"abbrs 'X.f.s' has more segments than the command path, 's' is ignored"}},
+		// Not a flow, the abbrs are only for the last segment
+		{file, "r", nil},
+		{file, "r|z", []string{"abbr 'z' of 'run' is not registered"}},
+	}
+	for _, it := range tests {
+		problems := lintFlowAbbrs(it.cmd, it.abbrs)
+		if !reflect.DeepEqual(problems, it.problems) {
+			t.Fatalf("%s %#v: problems %#v != %#v\n", it.cmd.Owner().DisplayPath(), it.abbrs, problems, it.problems)
+		}
+	}
+}
+
+func TestLintFlowTemplates(t *testing.T) {
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	_, env := newParserCliForTest(tree)
+	env.GetLayer(core.EnvLayerSession).Set("found", "v")
+
+	tests := []struct {
+		flow     string
+		mapping  string
+		rendered string
+		problems []string
+	}{
+		{"x.a v=[[found]]", "", "x.a v=v", nil},
+		{"x.a v=[[missed]]", "", "x.a v=" + lintPlaceholder, []string{"template key 'missed' not found in env or args"}},
+		{"x.a v=[[m1]] : x.b v=[[m2]] : x.c v=[[m1]]", "", "x.a v=0 : x.b v=0 : x.c v=0", []string{
+			"template key 'm1' not found in env or args",
+			"template key 'm2' not found in env or args",
+		}},
+		// Provided by the mapping arg, it's the caller's business
+		{"x.a v=[[mapped]]", "mapped", "x.a v=" + lintPlaceholder, nil},
+	}
+	for i, it := range tests {
+		sub := tree.AddSub("flow" + string(rune('0'+i)))
+		cmd := sub.RegFlowCmd([]string{it.flow}, "flow for test")
+		if len(it.mapping) != 0 {
+			cmd.AddArg("arg", "").AddArg2Env(it.mapping, "arg")
+		}
+		rendered, problems := lintFlowTemplates(cmd, core.ArgVals{}, env.Clone())
+		if strings.Join(rendered, " ") != it.rendered {
+			t.Fatalf("%#v: rendered %#v != %#v\n", it.flow, strings.Join(rendered, " "), it.rendered)
+		}
+		if !reflect.DeepEqual(problems, it.problems) {
+			t.Fatalf("%#v: problems %#v != %#v\n", it.flow, problems, it.problems)
+		}
+	}
+}
+
+func TestLintFlowSteps(t *testing.T) {
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	x := tree.AddSub("x")
+	x.AddSub("foo").RegEmptyCmd("cmd foo").AddArg("v", "")
+	x.AddSub("old").RegEmptyCmd("cmd old").SetDeprecated("use x.foo")
+	cc, env := newParserCliForTest(tree)
+
+	tests := []struct {
+		flow     string
+		problems []string
+		warnings []string
+	}{
+		{"x.foo", nil, nil},
+		{"x.foo v=1 : x.foo", nil, nil},
+		{"x.foo : x.nope", []string{"unresolvable command path"}, nil},
+		{"x.foo bad=1", []string{"parse failed"}, nil},
+		{"x.old", nil, []string{"command 'x.old' is deprecated: use x.foo"}},
+	}
+	for _, it := range tests {
+		problems, warnings := lintFlowSteps(cc, env, []string{it.flow})
+		if len(problems) != len(it.problems) {
+			t.Fatalf("%#v: problems %#v should be %#v\n", it.flow, problems, it.problems)
+		}
+		for i, problem := range problems {
+			if !strings.HasPrefix(problem, it.problems[i]) {
+				t.Fatalf("%#v: problem %#v should be %#v\n", it.flow, problem, it.problems[i])
+			}
+		}
+		if !reflect.DeepEqual(warnings, it.warnings) {
+			t.Fatalf("%#v: warnings %#v != %#v\n", it.flow, warnings, it.warnings)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package builtin
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/proto/flow_file"
+)
+
+func newFlowEnvForTest() *core.Env {
+	env := newSelfTestEnvForTest()
+	def := env.GetLayer(core.EnvLayerDefault)
+	def.Set("strs.list-sep", ",")
+	def.Set("strs.abbrs-sep", "|")
+	def.Set("strs.tag-mark", "@")
+	return env
+}
+
+func TestSaveFlowEnv(t *testing.T) {
+	test := func(val string, expected string) {
+		w := bytes.NewBuffer(nil)
+		env := core.ParsedEnv{"a": core.ParsedEnvVal{Val: val, MatchedPath: []string{"a"}}}
+		saveFlowEnv(w, env, nil, ".", "{", "}", "=", ":", false)
+		if w.String() != expected {
+			t.Fatalf("%#v: saved %#v != %#v\n", val, w.String(), expected)
+		}
+	}
+
+	test("abc", `{a=abc}`)
+	test("hello world", `{a="hello world"}`)
+	test("t\tab", "{a=\"t\tab\"}")
+	test("p:q", `{a="p\\:q"}`)
+	test("p:q x", `{a="p\\:q x"}`)
+	test(`x"y`, `{a="x\\\"y"}`)
+	test(`a\b`, `{a="a\\\\b"}`)
+}
+
+func TestParseFlowArgs(t *testing.T) {
+	env := newFlowEnvForTest()
+	parse := func(str string) (args []flow_file.FlowArg, err interface{}) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = r
+			}
+		}()
+		return parseFlowArgs(str, env, core.ParsedCmd{}), nil
+	}
+	test := func(str string, expected ...flow_file.FlowArg) {
+		args, err := parse(str)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", str, err)
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("%#v: %#v != %#v\n", str, args, expected)
+		}
+	}
+	fail := func(str string, msg string) {
+		_, err := parse(str)
+		cmdErr, ok := err.(*core.CmdError)
+		if !ok || !strings.Contains(cmdErr.Error(), msg) {
+			t.Fatalf("%#v: should be failed by %#v, got: %v\n", str, msg, err)
+		}
+	}
+
+	test("")
+	test(" , ")
+	test("host", flow_file.FlowArg{"host", ""})
+	test("host|h, port|p = 4000", flow_file.FlowArg{"host|h", ""}, flow_file.FlowArg{"port|p", "4000"})
+	// Default values
+	test("a=", flow_file.FlowArg{"a", ""})
+	test("a = x=y ", flow_file.FlowArg{"a", "x=y"})
+	test(" a | b |c=1", flow_file.FlowArg{"a|b|c", "1"})
+
+	// Empty names
+	fail("=1", "empty arg name")
+	fail("a|", "empty arg name")
+	fail("a||b", "empty arg name")
+	fail("a,|b=1", "empty arg name")
+	// Duplicated names or abbrs
+	fail("a,a", "'a' is used more than once")
+	fail("a|a", "'a' is used more than once")
+	fail("host|h,help|h", "'h' is used more than once")
+	fail("host|h=1,h=2", "'h' is used more than once")
+}
+
+func TestPrintFlowArgs(t *testing.T) {
+	print := func(args ...flow_file.FlowArg) string {
+		screen := display.NewCacheScreen()
+		printFlowArgs(screen, args, newFlowEnvForTest())
+		var texts []string
+		screen.WriteToEx(&core.QuietScreen{}, func(text string, isError bool, textLen int) (string, bool) {
+			texts = append(texts, text)
+			return text, isError
+		})
+		return strings.Join(texts, "")
+	}
+
+	if output := print(); len(output) != 0 {
+		t.Fatalf("nothing should be printed without args: %#v\n", output)
+	}
+	output := print(flow_file.FlowArg{"host|h", ""}, flow_file.FlowArg{"port|p", "4000"})
+	expected := "    - args:\n        host|h = ''\n        port|p = 4000\n"
+	if output != expected {
+		t.Fatalf("%#v != %#v\n", output, expected)
+	}
+}
@@ -0,0 +1,283 @@
+package builtin
+
+import (
+	"strings"
+)
+
+// The raw text of a saved flow, for editing steps without re-generating the whole flow,
+// so the comments, the layout and the untouched steps stay as they are.
+//
+// The steps are seperated by sequence-seps or line ends, same as executing.
+// The leading env of a flow (eg: "{a=1} : cmd" or "{a=1} cmd") is the global env, it's not a step.
+type flowText struct {
+	lines     []string
+	strs      flowTextStrs
+	globalEnv *flowTextSpan
+	steps     []flowTextSpan
+}
+
+type flowTextStrs struct {
+	seqSep       string
+	bracketLeft  string
+	bracketRight string
+	kvSep        string
+}
+
+// A piece of text in a line, [start, end) are the offsets without the spaces around
+type flowTextSpan struct {
+	line  int
+	start int
+	end   int
+}
+
+func newFlowText(lines []string, strs flowTextStrs) *flowText {
+	flow := &flowText{lines: lines, strs: strs}
+	first := true
+	for i, line := range lines {
+		if isFlowTextComment(line) {
+			continue
+		}
+		start := 0
+		for _, pos := range flowTextSeps(line, strs) {
+			flow.addSpan(i, start, pos, first)
+			first = false
+			start = pos + len(strs.seqSep)
+		}
+		flow.addSpan(i, start, len(line), first)
+		first = false
+	}
+	return flow
+}
+
+func (self *flowText) addSpan(line int, start int, end int, first bool) {
+	span, ok := trimFlowTextSpan(self.lines[line], line, start, end)
+	if !ok {
+		return
+	}
+	if first {
+		envEnd := flowTextEnvEnd(self.lines[line], span, self.strs)
+		if envEnd > span.start {
+			self.globalEnv = &flowTextSpan{line, span.start, envEnd}
+			span, ok = trimFlowTextSpan(self.lines[line], line, envEnd, span.end)
+			if !ok {
+				return
+			}
+		}
+	}
+	self.steps = append(self.steps, span)
+}
+
+func (self *flowText) StepCount() int {
+	return len(self.steps)
+}
+
+// The step indexes start from 1
+func (self *flowText) Step(idx int) string {
+	return self.spanStr(self.steps[idx-1])
+}
+
+func (self *flowText) GlobalEnv() string {
+	if self.globalEnv == nil {
+		return ""
+	}
+	return self.spanStr(*self.globalEnv)
+}
+
+// Insert before the Nth step, append to the end if the index is out of range
+func (self *flowText) Insert(idx int, step string) []string {
+	lines := append([]string{}, self.lines...)
+	if idx < 1 || idx > len(self.steps) {
+		return append(lines, step)
+	}
+	span := self.steps[idx-1]
+	line := lines[span.line]
+	// Put it in a new line if the Nth step is the head of its line, the comments above belong to the Nth step
+	if len(strings.TrimSpace(line[:span.start])) == 0 {
+		i := span.line
+		for i > 0 && isFlowTextComment(lines[i-1]) {
+			i -= 1
+		}
+		return append(lines[:i], append([]string{step}, lines[i:]...)...)
+	}
+	lines[span.line] = line[:span.start] + step + " " + self.strs.seqSep + " " + line[span.start:]
+	return lines
+}
+
+func (self *flowText) Replace(idx int, step string) []string {
+	lines := append([]string{}, self.lines...)
+	span := self.steps[idx-1]
+	line := lines[span.line]
+	lines[span.line] = line[:span.start] + step + line[span.end:]
+	return lines
+}
+
+// Remove the step and a sequence-sep next to it, the line is removed if nothing left
+func (self *flowText) Remove(idx int) []string {
+	lines := append([]string{}, self.lines...)
+	span := self.steps[idx-1]
+	line := lines[span.line]
+
+	before := line[:span.start]
+	after := line[span.end:]
+	seqSep := self.strs.seqSep
+	if rest := strings.TrimLeft(after, " \t"); strings.HasPrefix(rest, seqSep) {
+		line = before + strings.TrimLeft(rest[len(seqSep):], " \t")
+	} else if head := strings.TrimRight(before, " \t"); strings.HasSuffix(head, seqSep) {
+		line = strings.TrimRight(head[:len(head)-len(seqSep)], " \t") + after
+	} else {
+		line = strings.TrimRight(before, " \t") + after
+	}
+
+	if len(strings.TrimSpace(line)) == 0 {
+		lines = append(lines[:span.line], lines[span.line+1:]...)
+	} else {
+		lines[span.line] = line
+	}
+	return trimFlowTextTailSep(lines, self.strs)
+}
+
+func (self *flowText) spanStr(span flowTextSpan) string {
+	return self.lines[span.line][span.start:span.end]
+}
+
+// A sequence-sep at the end of the flow makes an empty step, remove it
+func trimFlowTextTailSep(lines []string, strs flowTextStrs) []string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if isFlowTextComment(lines[i]) {
+			continue
+		}
+		line := strings.TrimRight(lines[i], " \t")
+		seps := flowTextSeps(line, strs)
+		if len(seps) != 0 && seps[len(seps)-1] == len(line)-len(strs.seqSep) {
+			lines[i] = strings.TrimRight(line[:len(line)-len(strs.seqSep)], " \t")
+		}
+		break
+	}
+	return lines
+}
+
+func trimFlowTextSpan(line string, lineIdx int, start int, end int) (span flowTextSpan, ok bool) {
+	text := line[start:end]
+	trimmed := strings.TrimLeft(text, " \t")
+	start += len(text) - len(trimmed)
+	end = start + len(strings.TrimRight(trimmed, " \t"))
+	return flowTextSpan{lineIdx, start, end}, end > start
+}
+
+func isFlowTextComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) == 0 || line[0] == '#'
+}
+
+// A flow is parsed by two layers: split into args like a shell command line (quotes and '\' are removed),
+// then each arg is tokenized (quotes and '\' are handled again, quotes only open at the head or after syntax chars),
+// so a char is syntax char only if it's not quoted or escaped in the second layer.
+func flowTextSyntax(line string, strs flowTextStrs) []bool {
+	quoteOpenAfter := strs.seqSep + strs.bracketLeft + strs.kvSep + " \t"
+	syntax := make([]bool, len(line))
+
+	// The positions of the chars in the current arg
+	var arg []int
+	tokenize := func() {
+		var quote byte
+		for i := 0; i < len(arg); i++ {
+			c := line[arg[i]]
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '\\' {
+				i += 1
+				continue
+			}
+			if (c == '"' || c == '\'') &&
+				(i == 0 || strings.IndexByte(quoteOpenAfter, line[arg[i-1]]) >= 0) {
+				quote = c
+				continue
+			}
+			syntax[arg[i]] = true
+		}
+		arg = nil
+	}
+
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == quote {
+				quote = 0
+			} else {
+				arg = append(arg, i)
+			}
+		case c == '\\' && i+1 < len(line):
+			i += 1
+			arg = append(arg, i)
+		case quote == '"':
+			if c == quote {
+				quote = 0
+			} else {
+				arg = append(arg, i)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ' ' || c == '\t':
+			tokenize()
+		default:
+			arg = append(arg, i)
+		}
+	}
+	tokenize()
+	return syntax
+}
+
+// Find the syntax chars str in line, from 'start' to 'end'
+func flowTextFind(line string, syntax []bool, str string, start int, end int) int {
+	for i := start; i+len(str) <= end; i++ {
+		if !strings.HasPrefix(line[i:], str) {
+			continue
+		}
+		matched := true
+		for j := i; j < i+len(str); j++ {
+			matched = matched && syntax[j]
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
+
+// The sequence-seps followed by "//" are not counted, they are in URLs
+func flowTextSeps(line string, strs flowTextStrs) (seps []int) {
+	syntax := flowTextSyntax(line, strs)
+	for start := 0; ; {
+		i := flowTextFind(line, syntax, strs.seqSep, start, len(line))
+		if i < 0 {
+			return
+		}
+		start = i + len(strs.seqSep)
+		if !strings.HasPrefix(line[start:], "//") {
+			seps = append(seps, i)
+		}
+	}
+}
+
+// Find the end of the leading env brackets of a span, return the span start if there are none
+func flowTextEnvEnd(line string, span flowTextSpan, strs flowTextStrs) int {
+	syntax := flowTextSyntax(line, strs)
+	end := span.start
+	for {
+		pos := span.end - len(strings.TrimLeft(line[end:span.end], " \t"))
+		if flowTextFind(line, syntax, strs.bracketLeft, pos, pos+len(strs.bracketLeft)) != pos {
+			return end
+		}
+		closed := flowTextFind(line, syntax, strs.bracketRight, pos+len(strs.bracketLeft), span.end)
+		if closed < 0 {
+			return end
+		}
+		end = closed + len(strs.bracketRight)
+	}
+}
@@ -0,0 +1,98 @@
+package builtin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlowTextSteps(t *testing.T) {
+	test := func(flow []string, globalEnv string, steps ...string) {
+		text := newFlowText(flow, flowTextStrs{":", "{", "}", "="})
+		if text.GlobalEnv() != globalEnv {
+			t.Fatalf("%#v: global env %#v != %#v\n", flow, text.GlobalEnv(), globalEnv)
+		}
+		if text.StepCount() != len(steps) {
+			t.Fatalf("%#v: step count %#v != %#v\n", flow, text.StepCount(), len(steps))
+		}
+		for i, step := range steps {
+			if text.Step(i+1) != step {
+				t.Fatalf("%#v: step %d %#v != %#v\n", flow, i+1, text.Step(i+1), step)
+			}
+		}
+	}
+
+	test([]string{"a"}, "", "a")
+	test([]string{"a : b:c"}, "", "a", "b", "c")
+	test([]string{"a :", "b", "# c : d", "", "e f=1"}, "", "a", "b", "e f=1")
+	test([]string{`echo '"x : y"' : echo "'p:q'" : echo x\\:y : echo 'x\:y'`}, "",
+		`echo '"x : y"'`, `echo "'p:q'"`, `echo x\\:y`, `echo 'x\:y'`)
+	test([]string{`echo "msg='p:q'" : b`}, "", `echo "msg='p:q'"`, `b`)
+	// The quotes are removed in the first layer, so they don't protect the sequence-seps
+	test([]string{`echo "x:y"`}, "", `echo "x`, `y"`)
+	test([]string{`echo msg='x : y'`}, "", `echo msg='x`, `y'`)
+	test([]string{`echo x\:y`}, "", `echo x\`, `y`)
+	test([]string{"curl url=http://x.com : b"}, "", "curl url=http://x.com", "b")
+	test([]string{"{a=1} : b : c"}, "{a=1}", "b", "c")
+	test([]string{"{a=1}{b=2} b : c"}, "{a=1}{b=2}", "b", "c")
+	test([]string{"{a=1}", "b"}, "{a=1}", "b")
+	test([]string{`{a="':}'"} b`}, `{a="':}'"}`, "b")
+	test([]string{"{a=1} {b=2} c"}, "{a=1} {b=2}", "c")
+	test([]string{": {a=1} : b"}, "", "{a=1}", "b")
+	test([]string{"b : {a=1}"}, "", "b", "{a=1}")
+}
+
+func TestFlowTextInsert(t *testing.T) {
+	test := func(flow []string, idx int, step string, expected ...string) {
+		text := newFlowText(flow, flowTextStrs{":", "{", "}", "="})
+		res := text.Insert(idx, step)
+		if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("%#v: insert %#v at %d: %#v != %#v\n", flow, step, idx, res, expected)
+		}
+	}
+
+	test([]string{"a : b"}, 1, "x", "x", "a : b")
+	test([]string{"a : b"}, 2, "x", "a : x : b")
+	test([]string{"a : b"}, 3, "x", "a : b", "x")
+	test([]string{"# head", "a", "# mid", "b"}, 2, "x", "# head", "a", "x", "# mid", "b")
+	test([]string{"# head", "a"}, 1, "x", "x", "# head", "a")
+	test([]string{"{a=1} : b"}, 1, "x", "{a=1} : x : b")
+	test([]string{"{a=1} b"}, 1, "x", "{a=1} x : b")
+	test([]string{"{a=1}", "b"}, 1, "x", "{a=1}", "x", "b")
+	test([]string{`a : echo '"p : q"'`}, 2, "x", `a : x : echo '"p : q"'`)
+}
+
+func TestFlowTextReplace(t *testing.T) {
+	test := func(flow []string, idx int, step string, expected ...string) {
+		text := newFlowText(flow, flowTextStrs{":", "{", "}", "="})
+		res := text.Replace(idx, step)
+		if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("%#v: replace %d with %#v: %#v != %#v\n", flow, idx, step, res, expected)
+		}
+	}
+
+	test([]string{"a : b : c"}, 2, "x y=1", "a : x y=1 : c")
+	test([]string{"a  :  b", "# c", "d"}, 3, "x", "a  :  b", "# c", "x")
+	test([]string{"{a=1} b : c"}, 1, "x", "{a=1} x : c")
+	test([]string{`a : echo '"p : q"'`}, 2, "x", "a : x")
+}
+
+func TestFlowTextRemove(t *testing.T) {
+	test := func(flow []string, idx int, expected ...string) {
+		text := newFlowText(flow, flowTextStrs{":", "{", "}", "="})
+		res := text.Remove(idx)
+		if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("%#v: remove %d: %#v != %#v\n", flow, idx, res, expected)
+		}
+	}
+
+	test([]string{"a : b : c"}, 1, "b : c")
+	test([]string{"a : b : c"}, 2, "a : c")
+	test([]string{"a : b : c"}, 3, "a : b")
+	test([]string{"a :", "# b", "c"}, 1, "# b", "c")
+	test([]string{"a :", "b"}, 2, "a")
+	test([]string{"a", "b", "# tail"}, 2, "a", "# tail")
+	test([]string{"{a=1} : b : c"}, 1, "{a=1} : c")
+	test([]string{"{a=1} b : c"}, 1, "{a=1} c")
+	test([]string{"{a=1} b", "c"}, 1, "{a=1}", "c")
+	test([]string{`echo "msg='x:y'" : b`}, 1, "b")
+}
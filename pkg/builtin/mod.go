@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/proto/hub_meta"
 	"github.com/pingcap/ticat/pkg/proto/mod_meta"
 )
 
@@ -53,6 +54,7 @@ func loadLocalMods(
 			return nil
 		}
 		if filepath.Base(metaPath) == reposFileName {
+			loadOsEnvImportRules(cc.GlobalEnv, metaPath)
 			return nil
 		}
 
@@ -100,3 +102,12 @@ func loadLocalMods(
 		return nil
 	})
 }
+
+// The rules from repos are put into the default layer, so the user could overwrite them
+func loadOsEnvImportRules(env *core.Env, path string) {
+	keys, names := hub_meta.ReadOsEnvImportRulesFromFile(path)
+	env = env.GetLayer(core.EnvLayerDefault)
+	for i, key := range keys {
+		env.Set("sys.env.from-os."+key, names[i])
+	}
+}
@@ -0,0 +1,58 @@
+package builtin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+func ListReplayBundle(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	cmd := flow.Cmds[currCmdIdx]
+
+	bundle := argv.GetRaw("dir")
+	if len(bundle) == 0 {
+		bundle = env.GetRaw("sys.replay.from")
+	}
+	if len(bundle) == 0 {
+		bundle = env.GetRaw("sys.replay.record-to")
+	}
+	if len(bundle) == 0 {
+		panic(core.NewCmdError(cmd, "arg 'dir' is empty, and not in record or replay mode"))
+	}
+
+	dirs, err := core.ReplayStepDirs(bundle)
+	if err != nil {
+		panic(core.WrapCmdError(cmd, err))
+	}
+	if len(dirs) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no recorded steps in replay bundle '"+bundle+"'")
+		return currCmdIdx, true
+	}
+
+	for i, dir := range dirs {
+		step, err := core.LoadReplayStep(dir)
+		if err != nil {
+			panic(core.WrapCmdError(cmd, err))
+		}
+		status := display.ColorTip("OK", env)
+		if len(step.Err) != 0 {
+			status = display.ColorError(fmt.Sprintf("exit %d", step.ExitCode), env)
+		}
+		cc.Screen.Print(fmt.Sprintf("%s %s %s %dms\n", display.ColorSymbol(fmt.Sprintf("[%d]", i), env),
+			display.ColorCmd("["+step.CmdPath+"]", env), status, step.DurationMs))
+		cc.Screen.Print(fmt.Sprintf("    %s %s\n", step.Bin, strings.Join(step.Args, " ")))
+		if len(step.Err) != 0 {
+			cc.Screen.Print("    " + display.ColorError(step.Err, env) + "\n")
+		}
+	}
+	return currCmdIdx, true
+}
@@ -0,0 +1,263 @@
+package builtin
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+type selfTestResult struct {
+	cmdPath  string
+	source   string
+	passed   bool
+	err      error
+	output   string
+	duration time.Duration
+}
+
+func SelfTest(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	cmd := flow.Cmds[currCmdIdx]
+
+	tag := env.GetRaw("strs.tag-self-test")
+	findStrs := getFindStrsFromArgv(argv)
+	repo := argv.GetRaw("repo")
+	tests := collectSelfTestCmds(cc.Cmds, tag, cc.Cmds.Strs.TagMark, repo, findStrs)
+	if len(tests) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no commands with tag '"+tag+"' found.")
+		return currCmdIdx, true
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		panic(core.WrapCmdError(cmd, fmt.Errorf("get executable path of self failed: %v", err)))
+	}
+
+	envArgs := globalEnvArgs(env, selfTestEnvKvs(flow, cmd))
+
+	var results []selfTestResult
+	for _, test := range tests {
+		cmdPath := strings.Join(test.Path(), cc.Cmds.Strs.PathSep)
+		cc.Screen.Print(display.ColorTip("[selftest]", env) + " " + display.ColorCmd("["+cmdPath+"]", env) + "\n")
+		results = append(results, runSelfTestCmd(bin, envArgs, cmdPath, test.Source()))
+	}
+
+	dumpSelfTestResults(cc.Screen, env, results)
+
+	junitPath := argv.GetRaw("junit")
+	if len(junitPath) != 0 {
+		err = writeSelfTestJUnit(junitPath, results)
+		if err != nil {
+			panic(core.WrapCmdError(cmd, err))
+		}
+		cc.Screen.Print(display.ColorTip("[selftest]", env) + " junit report saved to '" + junitPath + "'\n")
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.passed {
+			failed += 1
+		}
+	}
+	if failed != 0 {
+		panic(core.NewCmdError(cmd, fmt.Sprintf("%d of %d self-tests failed", failed, len(results))))
+	}
+	return currCmdIdx, true
+}
+
+func collectSelfTestCmds(
+	tree *core.CmdTree,
+	tag string,
+	tagMark string,
+	repo string,
+	findStrs []string) (tests []*core.CmdTree) {
+
+	if !tree.IsNoExecutableCmd() &&
+		(tree.MatchTags(tag) || tree.MatchTags(strings.TrimPrefix(tag, tagMark))) &&
+		strings.Index(tree.Source(), repo) >= 0 &&
+		tree.MatchFind(findStrs...) {
+		tests = append(tests, tree)
+	}
+	names := tree.SubNames()
+	sort.Strings(names)
+	for _, name := range names {
+		tests = append(tests, collectSelfTestCmds(tree.GetSub(name), tag, tagMark, repo, findStrs)...)
+	}
+	return
+}
+
+// The env key-values in the command line, they are passed to the tests
+func selfTestEnvKvs(flow *core.ParsedCmds, cmd core.ParsedCmd) map[string]string {
+	kvs := map[string]string{}
+	envs := []core.ParsedEnv{flow.GlobalEnv}
+	for _, seg := range cmd.Segments {
+		envs = append(envs, seg.Env)
+	}
+	for _, it := range envs {
+		for k, v := range it {
+			if !v.IsArg {
+				kvs[k] = v.Val
+			}
+		}
+	}
+	return kvs
+}
+
+// Run the test in a new process, so it has an isolated session
+func runSelfTestCmd(bin string, envArgs []string, cmdPath string, source string) (result selfTestResult) {
+	result.cmdPath = cmdPath
+	result.source = source
+
+	output := bytes.NewBuffer(nil)
+	c := exec.Command(bin, append(envArgs, cmdPath)...)
+	c.Stdout = io.MultiWriter(os.Stdout, output)
+	c.Stderr = io.MultiWriter(os.Stderr, output)
+
+	start := time.Now()
+	result.err = c.Run()
+	result.duration = time.Since(start)
+	result.passed = (result.err == nil)
+	result.output = output.String()
+	return
+}
+
+func dumpSelfTestResults(screen core.Screen, env *core.Env, results []selfTestResult) {
+	width := 0
+	for _, result := range results {
+		if len(result.cmdPath) > width {
+			width = len(result.cmdPath)
+		}
+	}
+
+	failed := 0
+	var total time.Duration
+	var lines []string
+	for _, result := range results {
+		status := "PASS"
+		if !result.passed {
+			status = "FAIL"
+			failed += 1
+		}
+		total += result.duration
+		line := fmt.Sprintf("[%s] %s%s  %s", status, result.cmdPath,
+			strings.Repeat(" ", width-len(result.cmdPath)), formatDuration(result.duration))
+		lines = append(lines, line)
+	}
+
+	summary := fmt.Sprintf("self-tests: %d, passed: %d, failed: %d, elapsed: %s",
+		len(results), len(results)-failed, failed, formatDuration(total))
+	if failed != 0 {
+		display.PrintErrTitle(screen, env, summary, "", lines)
+	} else {
+		display.PrintTipTitle(screen, env, summary, "", lines)
+	}
+}
+
+func formatDuration(dur time.Duration) string {
+	return dur.Round(time.Millisecond).String()
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+// One test suite for each repo
+func writeSelfTestJUnit(path string, results []selfTestResult) error {
+	suites := map[string]*junitTestSuite{}
+	var sources []string
+	durations := map[string]time.Duration{}
+	for _, result := range results {
+		source := result.source
+		if len(source) == 0 {
+			source = "builtin"
+		}
+		suite, ok := suites[source]
+		if !ok {
+			suite = &junitTestSuite{Name: source}
+			suites[source] = suite
+			sources = append(sources, source)
+		}
+		testCase := junitTestCase{
+			Name:      result.cmdPath,
+			ClassName: source,
+			Time:      formatJUnitSeconds(result.duration),
+			SystemOut: result.output,
+		}
+		if !result.passed {
+			suite.Failures += 1
+			testCase.Failure = &junitFailure{fmt.Sprintf("%v", result.err), result.output}
+		}
+		suite.Tests += 1
+		suite.Cases = append(suite.Cases, testCase)
+		durations[source] += result.duration
+	}
+
+	report := junitTestSuites{}
+	for _, source := range sources {
+		suite := suites[source]
+		suite.Time = formatJUnitSeconds(durations[source])
+		report.Suites = append(report.Suites, *suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal junit report failed: %v", err)
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("create dir '%s' for junit report failed: %v", dir, err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("open junit report file '%s' failed: %v", path, err)
+	}
+	defer file.Close()
+	_, err = file.Write(append([]byte(xml.Header), data...))
+	if err != nil {
+		return fmt.Errorf("write junit report to '%s' failed: %v", path, err)
+	}
+	return nil
+}
+
+func formatJUnitSeconds(dur time.Duration) string {
+	return fmt.Sprintf("%.3f", dur.Seconds())
+}
@@ -0,0 +1,111 @@
+package builtin
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+func newSelfTestEnvForTest() *core.Env {
+	env := core.NewEnv().NewLayers(core.EnvLayerDefault, core.EnvLayerSession)
+	LoadDefaultEnv(env)
+	def := env.GetLayer(core.EnvLayerDefault)
+	def.SetBool("display.color", false)
+	def.Set("strs.env-kv-sep", "=")
+	def.Set("strs.env-bracket-left", "{")
+	def.Set("strs.env-bracket-right", "}")
+	def.Set("strs.seq-sep", ":")
+	return env
+}
+
+func newSelfTestResultsForTest() []selfTestResult {
+	return []selfTestResult{
+		{"x.a", "repo-x", true, nil, "a ok\n", 1500 * time.Millisecond},
+		{"x.bb", "repo-x", false, fmt.Errorf("exit status 1"), "bb failed\n", 500 * time.Millisecond},
+		{"y", "", true, nil, "", 0},
+	}
+}
+
+func TestDumpSelfTestResults(t *testing.T) {
+	screen := display.NewCacheScreen()
+	dumpSelfTestResults(screen, newSelfTestEnvForTest(), newSelfTestResultsForTest())
+	var texts []string
+	screen.WriteToEx(&core.QuietScreen{}, func(text string, isError bool, textLen int) (string, bool) {
+		texts = append(texts, text)
+		return text, isError
+	})
+	output := strings.Join(texts, "")
+
+	for _, expected := range []string{
+		"self-tests: 3, passed: 2, failed: 1, elapsed: 2s",
+		"[PASS] x.a   1.5s",
+		"[FAIL] x.bb  500ms",
+		"[PASS] y     0s",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("%#v not in the summary:\n%s\n", expected, output)
+		}
+	}
+}
+
+func TestWriteSelfTestJUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "junit.xml")
+	err := writeSelfTestJUnit(path, newSelfTestResultsForTest())
+	if err != nil {
+		t.Fatalf("write junit report failed: %v\n", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read junit report failed: %v\n", err)
+	}
+	var report junitTestSuites
+	err = xml.Unmarshal(data, &report)
+	if err != nil {
+		t.Fatalf("bad junit report: %v\n%s\n", err, data)
+	}
+
+	if len(report.Suites) != 2 {
+		t.Fatalf("suites count %#v != %#v\n", len(report.Suites), 2)
+	}
+	x := report.Suites[0]
+	if x.Name != "repo-x" || x.Tests != 2 || x.Failures != 1 || x.Time != "2.000" {
+		t.Fatalf("suite %#v: tests %d, failures %d, time %#v\n", x.Name, x.Tests, x.Failures, x.Time)
+	}
+	if x.Cases[0].Name != "x.a" || x.Cases[0].Failure != nil || x.Cases[0].SystemOut != "a ok\n" {
+		t.Fatalf("passed case %#v\n", x.Cases[0])
+	}
+	failure := x.Cases[1].Failure
+	if failure == nil || failure.Message != "exit status 1" || failure.Content != "bb failed\n" {
+		t.Fatalf("failed case %#v\n", x.Cases[1])
+	}
+	builtin := report.Suites[1]
+	if builtin.Name != "builtin" || builtin.Tests != 1 || builtin.Failures != 0 || builtin.Cases[0].ClassName != "builtin" {
+		t.Fatalf("suite %#v: tests %d, failures %d\n", builtin.Name, builtin.Tests, builtin.Failures)
+	}
+}
+
+func TestSelfTestEnvArgs(t *testing.T) {
+	flow := &core.ParsedCmds{GlobalEnv: core.ParsedEnv{
+		"b":       core.ParsedEnvVal{Val: "2"},
+		"a.x":     core.ParsedEnvVal{Val: "hello world"},
+		"display": core.ParsedEnvVal{Val: "p:q"},
+	}}
+	cmd := core.ParsedCmd{Segments: []core.ParsedCmdSeg{
+		{Env: core.ParsedEnv{"b": core.ParsedEnvVal{Val: "3"}}},
+		{Env: core.ParsedEnv{"repo": core.ParsedEnvVal{Val: "x", IsArg: true}}},
+	}}
+
+	args := globalEnvArgs(newSelfTestEnvForTest(), selfTestEnvKvs(flow, cmd))
+	expected := []string{`{a.x=hello\ world}`, `{b=3}`, `{display=p\:q}`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("env args %#v != %#v\n", args, expected)
+	}
+}
@@ -0,0 +1,503 @@
+package builtin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-shellwords"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/cli/parser"
+)
+
+// The server mode API, all results are in json:
+//   GET  /cmds[?find=<str>&find=<str>]   : list commands
+//   POST /desc {"flow": "<flow>", "env": {"<key>": "<val>"}}
+//                                         : describe a flow
+//   POST /run  {"flow": "<flow>", "env": {"<key>": "<val>"}, "stream": false}
+//                                         : execute a flow with env overlay,
+//                                           in stream mode the output is sent line by line as json events,
+//                                           the last event is the result
+// The flow string is split into args the same way as a shell command line.
+// Each flow is executed in a new process, so it has an isolated session.
+//
+// Flows could do anything, so the server is only for local use:
+//   - tcp address must be loopback, the requests must have a loopback or "localhost" Host header
+//   - tcp requests must have the header "Authorization: Bearer <token>",
+//     the token is from arg 'token', or randomly generated and printed on starting
+//   - the unix socket file is only accessible by the owner
+//   - POST requests must be "Content-Type: application/json"
+
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 60 * time.Second
+)
+
+type serverFlowRequest struct {
+	Flow   string            `json:"flow"`
+	Env    map[string]string `json:"env"`
+	Stream bool              `json:"stream"`
+}
+
+type serverFlowResult struct {
+	Succeeded  bool   `json:"succeeded"`
+	ExitCode   int    `json:"exit-code"`
+	Err        string `json:"error,omitempty"`
+	Output     string `json:"output,omitempty"`
+	DurationMs int64  `json:"duration-ms"`
+}
+
+type serverStreamEvent struct {
+	Stream string            `json:"stream,omitempty"`
+	Data   string            `json:"data,omitempty"`
+	Result *serverFlowResult `json:"result,omitempty"`
+}
+
+type serverCmdArg struct {
+	Name   string   `json:"name"`
+	DefVal string   `json:"default"`
+	Abbrs  []string `json:"abbrs,omitempty"`
+}
+
+type serverCmdInfo struct {
+	Path   string         `json:"path"`
+	Abbrs  []string       `json:"abbrs,omitempty"`
+	Help   string         `json:"help,omitempty"`
+	Type   string         `json:"type"`
+	Source string         `json:"source,omitempty"`
+	Tags   []string       `json:"tags,omitempty"`
+	Args   []serverCmdArg `json:"args,omitempty"`
+	Flow   []string       `json:"flow,omitempty"`
+}
+
+type flowServer struct {
+	cc    *core.Cli
+	env   *core.Env
+	bin   string
+	token string
+}
+
+func Serve(
+	argv core.ArgVals,
+	cc *core.Cli,
+	env *core.Env,
+	flow *core.ParsedCmds,
+	currCmdIdx int) (int, bool) {
+
+	assertNotTailMode(flow, currCmdIdx)
+	cmd := flow.Cmds[currCmdIdx]
+
+	bin, err := os.Executable()
+	if err != nil {
+		panic(core.WrapCmdError(cmd, fmt.Errorf("get executable path of self failed: %v", err)))
+	}
+
+	network := "tcp"
+	addr := argv.GetRaw("listen")
+	socket := argv.GetRaw("unix-socket")
+	if len(socket) != 0 {
+		network = "unix"
+		addr = socket
+		err = removeStaleSocket(socket)
+		if err != nil {
+			panic(core.WrapCmdError(cmd, err))
+		}
+	}
+	if len(addr) == 0 {
+		panic(core.NewCmdError(cmd, "arg 'listen' and 'unix-socket' are both empty"))
+	}
+
+	token := ""
+	if network == "tcp" {
+		err = checkServerListenAddr(addr)
+		if err != nil {
+			panic(core.WrapCmdError(cmd, err))
+		}
+		token = argv.GetRaw("token")
+		if len(token) == 0 {
+			token = newServerToken()
+		}
+	}
+
+	// The socket file is created by the umask, make it only accessible by the owner from the beginning
+	var listener net.Listener
+	if network == "unix" {
+		umask := syscall.Umask(0077)
+		listener, err = net.Listen(network, addr)
+		syscall.Umask(umask)
+	} else {
+		listener, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		panic(core.WrapCmdError(cmd, fmt.Errorf("listen on %s '%s' failed: %v", network, addr, err)))
+	}
+	defer listener.Close()
+	if network == "unix" {
+		err = os.Chmod(addr, 0600)
+		if err != nil {
+			panic(core.WrapCmdError(cmd, fmt.Errorf("change mode of unix socket '%s' failed: %v", addr, err)))
+		}
+	}
+
+	server := &flowServer{cc, env.Clone(), bin, token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cmds", server.handleCmds)
+	mux.HandleFunc("/desc", server.handleDesc)
+	mux.HandleFunc("/run", server.handleRun)
+
+	lines := []interface{}{
+		fmt.Sprintf("serving on %s '%s', press ctrl-c to stop.", network, addr),
+		"",
+		"GET  /cmds[?find=<str>]",
+		"POST /desc {\"flow\": \"<flow>\", \"env\": {...}}",
+		"POST /run  {\"flow\": \"<flow>\", \"env\": {...}, \"stream\": true}",
+	}
+	if len(token) != 0 {
+		lines = append(lines, "", "requests need the header:", "Authorization: Bearer "+token)
+	}
+	display.PrintTipTitle(cc.Screen, env, lines...)
+
+	// No write timeout, a flow may run for a long time
+	httpServer := &http.Server{
+		Handler:           server.guard(mux),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+	}
+	err = httpServer.Serve(listener)
+	if err != nil {
+		panic(core.WrapCmdError(cmd, fmt.Errorf("serve on %s '%s' failed: %v", network, addr, err)))
+	}
+	return currCmdIdx, true
+}
+
+// Remove the socket file left by the last run, a socket with a live server or other files are kept
+func removeStaleSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if err != nil {
+		return nil
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("'%s' exists and is not a unix socket", socket)
+	}
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket '%s' is in use by another server", socket)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("unix socket '%s' exists and can't tell if it's in use: %v", socket, err)
+	}
+	return os.Remove(socket)
+}
+
+// Reject the requests which may come from other hosts or from browsers (cross-site or dns-rebinding)
+func (self *flowServer) guard(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(self.token) != 0 {
+			if !isLoopbackHost(r.Host) {
+				http.Error(w, "forbidden: host '"+r.Host+"' is not loopback", http.StatusForbidden)
+				return
+			}
+			auth := r.Header.Get("Authorization")
+			expected := "Bearer " + self.token
+			if subtle.ConstantTimeCompare([]byte(auth), []byte(expected)) != 1 {
+				http.Error(w, "unauthorized: bad or missed token", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (self *flowServer) handleCmds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	findStrs := r.URL.Query()["find"]
+	cmds := collectServerCmdInfos(self.cc.Cmds, findStrs)
+	writeServerJson(w, cmds)
+}
+
+func (self *flowServer) handleDesc(w http.ResponseWriter, r *http.Request) {
+	req, ok := readServerFlowRequest(w, r)
+	if !ok {
+		return
+	}
+	req.Stream = false
+	self.runFlow(w, r, req, self.env.GetRaw("strs.seq-sep"), "desc")
+}
+
+func (self *flowServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	req, ok := readServerFlowRequest(w, r)
+	if !ok {
+		return
+	}
+	self.runFlow(w, r, req)
+}
+
+// Run the flow in a new process, the process will be killed if the request is canceled
+func (self *flowServer) runFlow(w http.ResponseWriter, r *http.Request, req serverFlowRequest, extra ...string) {
+	flow, err := shellwords.Parse(req.Flow)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: parse flow failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	args := append(self.envOverlayArgs(req.Env), flow...)
+	args = append(args, extra...)
+	c := exec.CommandContext(r.Context(), self.bin, args...)
+
+	var output *serverOutput
+	if req.Stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		output = newServerStreamOutput(w)
+	} else {
+		output = newServerOutput()
+	}
+	stdout := output.Writer("stdout")
+	stderr := output.Writer("stderr")
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	start := time.Now()
+	err = c.Run()
+	result := &serverFlowResult{
+		Succeeded:  err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Err = err.Error()
+		result.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	if req.Stream {
+		stdout.Flush()
+		stderr.Flush()
+		output.WriteEvent(serverStreamEvent{Result: result})
+	} else {
+		result.Output = output.String()
+		writeServerJson(w, result)
+	}
+}
+
+// The overlay is passed as the global env of the flow, one arg for each key,
+// the display settings are added because there is no terminal for the new process
+func (self *flowServer) envOverlayArgs(overlay map[string]string) (args []string) {
+	width := self.env.GetInt("display.width")
+	if width <= 0 {
+		width = 120
+	}
+	kvs := map[string]string{
+		"display.width": strconv.Itoa(width),
+		"display.color": "false",
+		"sys.interact":  "false",
+	}
+	for k, v := range overlay {
+		kvs[k] = v
+	}
+	return globalEnvArgs(self.env, kvs)
+}
+
+// Pass key-values to a new ticat process as global env, one arg for each key
+func globalEnvArgs(env *core.Env, kvs map[string]string) (args []string) {
+	kvSep := env.GetRaw("strs.env-kv-sep")
+	bracketLeft := env.GetRaw("strs.env-bracket-left")
+	bracketRight := env.GetRaw("strs.env-bracket-right")
+	specials := env.GetRaw("strs.seq-sep") + bracketLeft + bracketRight + kvSep + " \t"
+
+	var keys []string
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, bracketLeft+parser.EscapeLiterals(k, specials)+kvSep+
+			parser.EscapeLiterals(kvs[k], specials)+bracketRight)
+	}
+	return
+}
+
+func readServerFlowRequest(w http.ResponseWriter, r *http.Request) (req serverFlowRequest, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "unsupported media type: need 'application/json'", http.StatusUnsupportedMediaType)
+		return req, false
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return req, false
+	}
+	if len(strings.TrimSpace(req.Flow)) == 0 {
+		http.Error(w, "bad request: empty flow", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// The server could execute any flow, so it only listens on loopback addresses
+func checkServerListenAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("bad listen address '%s': %v", addr, err)
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("listen address '%s' is not loopback, only local access is allowed", addr)
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.ToLower(host) == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func newServerToken() string {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		panic(fmt.Errorf("generate server token failed: %v", err))
+	}
+	return hex.EncodeToString(data)
+}
+
+func writeServerJson(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	data, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal result failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Write(append(data, '\n'))
+}
+
+func collectServerCmdInfos(tree *core.CmdTree, findStrs []string) (cmds []serverCmdInfo) {
+	if tree.IsHidden() {
+		return
+	}
+	cmd := tree.Cmd()
+	if cmd != nil && !tree.IsRoot() && tree.MatchFind(findStrs...) {
+		info := serverCmdInfo{
+			Path:   tree.DisplayPath(),
+			Abbrs:  tree.Abbrs(),
+			Help:   cmd.Help(),
+			Type:   string(cmd.Type()),
+			Source: tree.Source(),
+			Tags:   tree.Tags(),
+			Flow:   cmd.FlowStrs(),
+		}
+		args := cmd.Args()
+		for _, name := range args.Names() {
+			info.Args = append(info.Args, serverCmdArg{name, args.DefVal(name), args.Abbrs(name)})
+		}
+		cmds = append(cmds, info)
+	}
+	names := tree.SubNames()
+	sort.Strings(names)
+	for _, name := range names {
+		cmds = append(cmds, collectServerCmdInfos(tree.GetSub(name), findStrs)...)
+	}
+	return
+}
+
+// Collect the output of a flow, or send it line by line as json events
+type serverOutput struct {
+	lock    sync.Mutex
+	stream  http.ResponseWriter
+	flusher http.Flusher
+	buf     strings.Builder
+}
+
+func newServerOutput() *serverOutput {
+	return &serverOutput{}
+}
+
+func newServerStreamOutput(w http.ResponseWriter) *serverOutput {
+	flusher, _ := w.(http.Flusher)
+	return &serverOutput{stream: w, flusher: flusher}
+}
+
+func (self *serverOutput) Writer(name string) *serverOutputWriter {
+	return &serverOutputWriter{self, name, nil}
+}
+
+func (self *serverOutput) String() string {
+	return self.buf.String()
+}
+
+func (self *serverOutput) WriteEvent(event serverStreamEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	self.stream.Write(append(data, '\n'))
+	if self.flusher != nil {
+		self.flusher.Flush()
+	}
+}
+
+type serverOutputWriter struct {
+	output  *serverOutput
+	name    string
+	pending []byte
+}
+
+// In stream mode each event is a line, the unfinished line is kept until the next write or flushing
+func (self *serverOutputWriter) Write(data []byte) (int, error) {
+	if self.output.stream != nil {
+		self.pending = append(self.pending, data...)
+		for {
+			i := bytes.IndexByte(self.pending, '\n')
+			if i < 0 {
+				break
+			}
+			self.output.WriteEvent(serverStreamEvent{Stream: self.name, Data: string(self.pending[:i+1])})
+			self.pending = self.pending[i+1:]
+		}
+	} else {
+		self.output.lock.Lock()
+		self.output.buf.Write(data)
+		self.output.lock.Unlock()
+	}
+	return len(data), nil
+}
+
+func (self *serverOutputWriter) Flush() {
+	if len(self.pending) != 0 {
+		self.output.WriteEvent(serverStreamEvent{Stream: self.name, Data: string(self.pending)})
+		self.pending = nil
+	}
+}
@@ -0,0 +1,190 @@
+package builtin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServerStreamOutput(t *testing.T) {
+	test := func(writes []string, expected ...string) {
+		w := httptest.NewRecorder()
+		writer := newServerStreamOutput(w).Writer("stdout")
+		for _, data := range writes {
+			writer.Write([]byte(data))
+		}
+		writer.Flush()
+
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+			if len(line) == 0 {
+				continue
+			}
+			var event serverStreamEvent
+			err := json.Unmarshal([]byte(line), &event)
+			if err != nil {
+				t.Fatalf("%#v: bad event %#v: %v\n", writes, line, err)
+			}
+			lines = append(lines, event.Data)
+		}
+		if !reflect.DeepEqual(lines, expected) {
+			t.Fatalf("%#v: events %#v != %#v\n", writes, lines, expected)
+		}
+	}
+
+	test([]string{"a\n", "b\n"}, "a\n", "b\n")
+	test([]string{"a", "b\nc", "\n"}, "ab\n", "c\n")
+	test([]string{"a\nb\n\n"}, "a\n", "b\n", "\n")
+	// The unfinished line is sent on flushing
+	test([]string{"a\nb"}, "a\n", "b")
+	test([]string{})
+}
+
+func TestReadServerFlowRequest(t *testing.T) {
+	test := func(body string, stream bool) {
+		r := httptest.NewRequest("POST", "/run", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		req, ok := readServerFlowRequest(httptest.NewRecorder(), r)
+		if !ok || req.Stream != stream {
+			t.Fatalf("%#v: stream %#v != %#v\n", body, req.Stream, stream)
+		}
+	}
+
+	test(`{"flow": "dbg.echo hi"}`, false)
+	test(`{"flow": "dbg.echo hi", "stream": true}`, true)
+	test(`{"flow": "dbg.echo hi", "stream": false}`, false)
+}
+
+func TestReadServerFlowRequestRejected(t *testing.T) {
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"GET", "application/json", `{"flow": "dbg.echo hi"}`, http.StatusMethodNotAllowed},
+		{"POST", "", `{"flow": "dbg.echo hi"}`, http.StatusUnsupportedMediaType},
+		{"POST", "text/plain", `{"flow": "dbg.echo hi"}`, http.StatusUnsupportedMediaType},
+		{"POST", "application/x-www-form-urlencoded", `{"flow": "dbg.echo hi"}`, http.StatusUnsupportedMediaType},
+		{"POST", "application/json", `{"flow": `, http.StatusBadRequest},
+		{"POST", "application/json", `{"flow": "  "}`, http.StatusBadRequest},
+	}
+	for _, it := range tests {
+		r := httptest.NewRequest(it.method, "/run", strings.NewReader(it.body))
+		if len(it.contentType) != 0 {
+			r.Header.Set("Content-Type", it.contentType)
+		}
+		w := httptest.NewRecorder()
+		_, ok := readServerFlowRequest(w, r)
+		if ok || w.Code != it.code {
+			t.Fatalf("%#v: code %#v != %#v\n", it, w.Code, it.code)
+		}
+	}
+}
+
+func TestServerGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		token string
+		host  string
+		auth  string
+		code  int
+	}{
+		{"t0k", "127.0.0.1:8080", "Bearer t0k", http.StatusOK},
+		{"t0k", "localhost:8080", "Bearer t0k", http.StatusOK},
+		{"t0k", "[::1]:8080", "Bearer t0k", http.StatusOK},
+		{"t0k", "evil.com:8080", "Bearer t0k", http.StatusForbidden},
+		{"t0k", "192.168.1.2:8080", "Bearer t0k", http.StatusForbidden},
+		{"t0k", "127.0.0.1:8080", "", http.StatusUnauthorized},
+		{"t0k", "127.0.0.1:8080", "Bearer bad", http.StatusUnauthorized},
+		{"t0k", "127.0.0.1:8080", "t0k", http.StatusUnauthorized},
+		{"t0k", "127.0.0.1:8080", "Bearer t0k0", http.StatusUnauthorized},
+		// Unix socket, protected by the file mode
+		{"", "evil.com", "", http.StatusOK},
+	}
+	for _, it := range tests {
+		server := &flowServer{token: it.token}
+		r := httptest.NewRequest("GET", "/cmds", nil)
+		r.Host = it.host
+		if len(it.auth) != 0 {
+			r.Header.Set("Authorization", it.auth)
+		}
+		w := httptest.NewRecorder()
+		server.guard(ok).ServeHTTP(w, r)
+		if w.Code != it.code {
+			t.Fatalf("%#v: code %#v != %#v\n", it, w.Code, it.code)
+		}
+	}
+}
+
+func TestCheckServerListenAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"127.0.0.1:8080", true},
+		{"localhost:8080", true},
+		{"[::1]:8080", true},
+		{"127.0.0.2:8080", true},
+		{"0.0.0.0:8080", false},
+		{":8080", false},
+		{"192.168.1.2:8080", false},
+		{"example.com:8080", false},
+		{"127.0.0.1", false},
+	}
+	for _, it := range tests {
+		err := checkServerListenAddr(it.addr)
+		if (err == nil) != it.ok {
+			t.Fatalf("%#v: ok should be %v, error: %v\n", it.addr, it.ok, err)
+		}
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	missed := filepath.Join(dir, "missed.sock")
+	if err := removeStaleSocket(missed); err != nil {
+		t.Fatalf("missed socket: unexpected error: %v\n", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, nil, 0644)
+	if err := removeStaleSocket(file); err == nil {
+		t.Fatalf("a normal file should not be removed\n")
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatalf("listen failed: %v\n", err)
+	}
+	defer listener.Close()
+	if err := removeStaleSocket(live); err == nil {
+		t.Fatalf("a socket with a live server should not be removed\n")
+	}
+	if _, err := os.Lstat(live); err != nil {
+		t.Fatalf("the live socket should be kept: %v\n", err)
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	staleListener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("listen failed: %v\n", err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	staleListener.Close()
+	if err := removeStaleSocket(stale); err != nil {
+		t.Fatalf("stale socket: unexpected error: %v\n", err)
+	}
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Fatalf("the stale socket should be removed\n")
+	}
+}
@@ -157,19 +157,15 @@ func getCmdPath(path string, flowExt string, cmd core.ParsedCmd) string {
 	return base[:len(base)-len(flowExt)]
 }
 
-func quoteIfHasSpace(str string) string {
-	if strings.IndexAny(str, " \t\r\n") < 0 {
+// Quote the str if it has spaces or shell special chars, the result will be split by shellwords
+// as one word and the origin str will be returned
+func quoteIfNeeded(str string) string {
+	if strings.IndexAny(str, " \t\r\n\\\"'`$;&|<>()") < 0 {
 		return str
 	}
-	i := strings.Index(str, "\"")
-	if i < 0 {
-		return "\"" + str + "\""
-	}
-	i = strings.Index(str, "'")
-	if i < 0 {
-		return "'" + str + "'"
-	}
-	return str
+	str = strings.ReplaceAll(str, "\\", "\\\\")
+	str = strings.ReplaceAll(str, "\"", "\\\"")
+	return "\"" + str + "\""
 }
 
 func getAndCheckArg(argv core.ArgVals, cmd core.ParsedCmd, arg string) string {
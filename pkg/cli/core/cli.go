@@ -36,6 +36,9 @@ type Cli struct {
 	TolerableErrs *TolerableErrs
 	Executor      Executor
 	Helps         *Helps
+	RpcHelpers    *RpcHelpers
+	ModWorkers    *ModWorkers
+	VersionProbes *VersionProbes
 }
 
 func NewCli(env *Env, screen Screen, cmds *CmdTree, parser CliParser, abbrs *EnvAbbrs) *Cli {
@@ -48,6 +51,9 @@ func NewCli(env *Env, screen Screen, cmds *CmdTree, parser CliParser, abbrs *Env
 		NewTolerableErrs(),
 		nil,
 		NewHelps(),
+		NewRpcHelpers(),
+		NewModWorkers(),
+		NewVersionProbes(),
 	}
 }
 
@@ -61,5 +67,8 @@ func (self *Cli) Clone() *Cli {
 		self.TolerableErrs,
 		nil,
 		self.Helps,
+		self.RpcHelpers,
+		self.ModWorkers,
+		self.VersionProbes,
 	}
 }
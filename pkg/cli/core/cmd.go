@@ -23,6 +23,7 @@ const (
 	CmdTypeFile       CmdType = "executable-file"
 	CmdTypeEmptyDir   CmdType = "dir-with-no-executable"
 	CmdTypeDirWithCmd CmdType = "dir-with-executable-file"
+	CmdTypeRpc        CmdType = "rpc-helper"
 )
 
 type NormalCmd func(argv ArgVals, cc *Cli, env *Env, flow []ParsedCmd) (succeeded bool)
@@ -30,8 +31,33 @@ type PowerCmd func(argv ArgVals, cc *Cli, env *Env, flow *ParsedCmds,
 	currCmdIdx int) (newCurrCmdIdx int, succeeded bool)
 
 type Depend struct {
-	OsCmd  string
-	Reason string
+	OsCmd    string
+	Reason   string
+	Installs []DependInstall
+	// Version constraint, eg: ">= 2.20", ">= 5.7, < 8.0"
+	Version string
+	// The command to print the version, default: "<os-cmd> --version"
+	VersionProbe string
+	// The regexp to extract the version from the probe output, default: the most specific dotted numbers
+	VersionPattern string
+}
+
+// How to install an os-command, eg: {"apt", "mysql-client"}, {"cmd", "install.tiup"}
+type DependInstall struct {
+	Installer string
+	Target    string
+}
+
+// The installers could be used in "[install.<installer>]" sections, "cmd" means installing by a ticat command
+var DependInstallers = []string{"brew", "apt", "dnf", "yum", "cmd"}
+
+func IsDependInstaller(name string) bool {
+	for _, it := range DependInstallers {
+		if it == name {
+			return true
+		}
+	}
+	return false
 }
 
 type Cmd struct {
@@ -45,7 +71,15 @@ type Cmd struct {
 	normal            NormalCmd
 	power             PowerCmd
 	cmdLine           string
+	rpcMethod         string
+	worker            bool
 	flow              []string
+	scoped            bool
+	exports           []string
+	deprecated        bool
+	deprecatedMsg     string
+	redirect          string
+	alias             bool
 	envOps            EnvOps
 	depends           []Depend
 	metaFilePath      string
@@ -65,7 +99,15 @@ func defaultCmd(owner *CmdTree, help string) *Cmd {
 		normal:            nil,
 		power:             nil,
 		cmdLine:           "",
+		rpcMethod:         "",
+		worker:            false,
 		flow:              nil,
+		scoped:            false,
+		exports:           nil,
+		deprecated:        false,
+		deprecatedMsg:     "",
+		redirect:          "",
+		alias:             false,
 		envOps:            newEnvOps(),
 		depends:           nil,
 		metaFilePath:      "",
@@ -123,6 +165,15 @@ func NewDirWithCmd(owner *CmdTree, help string, cmd string) *Cmd {
 	return c
 }
 
+// The cmd is served by a long-running helper process, see 'rpc.go'
+func NewRpcCmd(owner *CmdTree, help string, helper string, method string) *Cmd {
+	c := defaultCmd(owner, help)
+	c.ty = CmdTypeRpc
+	c.cmdLine = helper
+	c.rpcMethod = method
+	return c
+}
+
 func NewFlowCmd(owner *CmdTree, help string, flow []string) *Cmd {
 	c := defaultCmd(owner, help)
 	c.ty = CmdTypeFlow
@@ -182,6 +233,8 @@ func (self *Cmd) execute(
 		return currCmdIdx, self.executeFile(argv, cc, env, flow.Cmds[currCmdIdx])
 	case CmdTypeFlow:
 		return currCmdIdx, self.executeFlow(argv, cc, env)
+	case CmdTypeRpc:
+		return currCmdIdx, self.executeRpc(argv, cc, env, flow.Cmds[currCmdIdx])
 	case CmdTypeFileNFlow:
 		succeeded := self.executeFlow(argv, cc, env)
 		if succeeded {
@@ -276,15 +329,70 @@ func (self *Cmd) SetMetaFile(path string) *Cmd {
 }
 
 func (self *Cmd) AddDepend(dep string, reason string) *Cmd {
-	self.depends = append(self.depends, Depend{dep, reason})
+	self.depends = append(self.depends, Depend{dep, reason, nil, "", "", ""})
 	return self
 }
 
+func (self *Cmd) AddDependInstall(dep string, installer string, target string) *Cmd {
+	for i, it := range self.depends {
+		if it.OsCmd == dep {
+			self.depends[i].Installs = append(it.Installs, DependInstall{installer, target})
+			return self
+		}
+	}
+	panic(fmt.Errorf("[AddDependInstall] os-command '%s' is not in depends", dep))
+}
+
+func (self *Cmd) SetDependVersion(dep string, constraint string, probe string, pattern string) *Cmd {
+	for i, it := range self.depends {
+		if it.OsCmd == dep {
+			self.depends[i].Version = constraint
+			self.depends[i].VersionProbe = probe
+			self.depends[i].VersionPattern = pattern
+			return self
+		}
+	}
+	panic(fmt.Errorf("[SetDependVersion] os-command '%s' is not in depends", dep))
+}
+
 func (self *Cmd) SetQuiet() *Cmd {
 	self.quiet = true
 	return self
 }
 
+// Keep the executable file running in the session, see 'worker.go'
+func (self *Cmd) SetWorker() *Cmd {
+	self.worker = true
+	return self
+}
+
+// The env changes in a scoped flow are discarded when it finishes, except the exported keys
+func (self *Cmd) SetScoped(exports ...string) *Cmd {
+	self.scoped = true
+	self.exports = exports
+	return self
+}
+
+// A deprecated command still works, a banner with the message is shown when it runs
+func (self *Cmd) SetDeprecated(msg string) *Cmd {
+	self.deprecated = true
+	self.deprecatedMsg = msg
+	return self
+}
+
+// The parser resolves this command to the redirected path, used when a command is renamed
+func (self *Cmd) SetRedirect(cmdPath string) *Cmd {
+	self.redirect = cmdPath
+	return self
+}
+
+// An alias is a redirect defined by users, it's not an outdated path so no warnings when using it
+func (self *Cmd) SetAlias(cmdPath string) *Cmd {
+	self.redirect = cmdPath
+	self.alias = true
+	return self
+}
+
 func (self *Cmd) SetAllowTailModeCall() *Cmd {
 	self.allowTailModeCall = true
 	return self
@@ -358,6 +466,34 @@ func (self *Cmd) IsQuiet() bool {
 	return self.quiet
 }
 
+func (self *Cmd) IsWorker() bool {
+	return self.worker
+}
+
+func (self *Cmd) IsScoped() bool {
+	return self.scoped
+}
+
+func (self *Cmd) ScopeExports() []string {
+	return self.exports
+}
+
+func (self *Cmd) IsDeprecated() bool {
+	return self.deprecated
+}
+
+func (self *Cmd) DeprecatedMsg() string {
+	return self.deprecatedMsg
+}
+
+func (self *Cmd) Redirect() string {
+	return self.redirect
+}
+
+func (self *Cmd) IsAlias() bool {
+	return self.alias
+}
+
 func (self *Cmd) IsPriority() bool {
 	return self.priority
 }
@@ -370,6 +506,15 @@ func (self *Cmd) CmdLine() string {
 	return self.cmdLine
 }
 
+// The runner to execute the file and its args, from env "sys.ext.exec.<ext>"
+func (self *Cmd) FileRunner(env *Env) (bin string, args []string) {
+	return extRunner(env, self.cmdLine)
+}
+
+func (self *Cmd) RpcMethod() string {
+	return self.rpcMethod
+}
+
 func (self *Cmd) Args() Args {
 	return self.args
 }
@@ -455,20 +600,44 @@ func (self *Cmd) Flow(argv ArgVals, env *Env, allowFlowTemplateRenderError bool)
 // TODO:
 //
 // The env in the sub flow is cc.GlobalEnv:
-//   1. which will loss values in EnvLayerCmd, currently we think is OK
+//   1. which will loss values in EnvLayerCmd (except scoped flows), currently we think is OK
 //      (also consider remove the concept of EnvLayerCmd)
 //   2. if we support async or parallel commands one day, this is not fit
 //   3. (consider remove concept cc.GlobalEnv)
 //
 func (self *Cmd) executeFlow(argv ArgVals, cc *Cli, env *Env) bool {
 	flow, _ := self.Flow(argv, env, false)
-	return cc.Executor.Execute(self.owner.DisplayPath(), cc, flow...)
+	if !self.scoped {
+		return cc.Executor.Execute(self.owner.DisplayPath(), cc, flow...)
+	}
+
+	// The sub flow runs on a child layer of the session, only the exported keys are written back.
+	// The values in EnvLayerCmd are visible in a scoped flow, they are discarded with the others
+	sessionEnv := cc.GlobalEnv.GetLayer(EnvLayerSession)
+	scope := sessionEnv.BeginScope(env.getLayer(EnvLayerCmd))
+	defer func() {
+		if journal := sessionEnv.Journal(); journal != nil {
+			journal.SetWriter(self.owner.DisplayPath())
+		}
+		scope.End(self.exports, self.owner.Strs.EnvPathSep)
+	}()
+	scoped := cc.Clone()
+	scoped.GlobalEnv = scope.Env()
+	scoped.Executor = cc.Executor
+	return cc.Executor.Execute(self.owner.DisplayPath(), scoped, flow...)
 }
 
 func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCmd) bool {
 	if len(self.cmdLine) == 0 {
 		return true
 	}
+	replayFrom := env.GetRaw("sys.replay.from")
+	if len(replayFrom) != 0 {
+		return self.executeReplay(argv, cc, env, parsedCmd, replayFrom)
+	}
+	if env.GetBool("sys.mock") {
+		return self.executeMock(argv, cc, env, parsedCmd)
+	}
 
 	for _, dep := range self.depends {
 		_, err := exec.LookPath(dep.OsCmd)
@@ -479,26 +648,22 @@ func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCm
 		}
 	}
 
-	var bin string
-	var args []string
-	ext := filepath.Ext(self.cmdLine)
+	bin, args := extRunner(env, self.cmdLine)
 
-	// TODO: move this code block out?
-	runner := env.Get("sys.ext.exec" + ext).Raw
-	if len(runner) != 0 {
-		fields := strings.Fields(runner)
-		if len(fields) == 1 {
-			bin = runner
-		} else {
-			bin = fields[0]
-			args = append(args, fields[1:]...)
-		}
-	} else {
-		bin = "bash"
+	// No need to save env to session file for workers, but recording needs it
+	if self.worker && len(env.GetRaw("sys.replay.record-to")) == 0 {
+		return self.executeWorker(argv, cc, env, parsedCmd, bin, args)
 	}
 
 	sep := cc.Cmds.Strs.EnvKeyValSep
 
+	// The step index should be picked before saving env, or it will be overwritten when loading back
+	recordTo := env.GetRaw("sys.replay.record-to")
+	recordIdx := 0
+	if len(recordTo) != 0 {
+		recordIdx = nextReplayRecordIdx(env, recordTo)
+	}
+
 	sessionDir, sessionPath := saveEnvToSessionFile(cc, env, parsedCmd)
 
 	args = append(args, self.cmdLine)
@@ -512,7 +677,17 @@ func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCm
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
+	var recorder *replayRecorder
+	if len(recordTo) != 0 {
+		recorder = newReplayRecorder(recordTo, recordIdx, self.owner.DisplayPath(), bin, args, env, sep)
+		cmd.Stdout = recorder.Stdout()
+		cmd.Stderr = recorder.Stderr()
+	}
+
 	err := cmd.Run()
+	if recorder != nil {
+		recorder.Finish(err, sessionPath)
+	}
 	if err != nil {
 		err = RunCmdFileFailed{
 			err.Error(),
@@ -525,5 +700,26 @@ func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCm
 	}
 
 	LoadEnvFromFile(env.GetLayer(EnvLayerSession), sessionPath, sep)
+	if env.GetBool("sys.mock.record") {
+		self.recordMockValues(argv, cc, env)
+	}
 	return true
 }
+
+// Get the runner of a file by its ext from env "sys.ext.exec.<ext>", default is bash
+func extRunner(env *Env, path string) (bin string, args []string) {
+	ext := filepath.Ext(path)
+	runner := env.Get("sys.ext.exec" + ext).Raw
+	if len(runner) != 0 {
+		fields := strings.Fields(runner)
+		if len(fields) == 1 {
+			bin = runner
+		} else {
+			bin = fields[0]
+			args = append(args, fields[1:]...)
+		}
+	} else {
+		bin = "bash"
+	}
+	return
+}
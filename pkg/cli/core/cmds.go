@@ -180,6 +180,12 @@ func (self *CmdTree) RegFlowCmd(flow []string, help string) *Cmd {
 	return self.cmd
 }
 
+func (self *CmdTree) RegRpcCmd(helper string, method string, help string) *Cmd {
+	self.cmdConflictCheck(help, "RegRpcCmd")
+	self.cmd = NewRpcCmd(self, help, helper, method)
+	return self.cmd
+}
+
 func (self *CmdTree) RegPowerCmd(cmd PowerCmd, help string) *Cmd {
 	self.cmdConflictCheck(help, "RegPowerCmd")
 	self.cmd = NewPowerCmd(self, help, cmd)
@@ -413,17 +419,7 @@ func (self *CmdTree) addSubAbbrs(name string, abbrs ...string) {
 			continue
 		}
 		if ok {
-			err := CmdTreeErrSubAbbrConflicted{
-				fmt.Sprintf("%s: sub command abbr name '%s' conflicted, "+
-					"old for '%s', new for '%s'",
-					self.DisplayPath(), abbr, old, name),
-				self.Path(),
-				abbr,
-				old,
-				name,
-				self.GetSub(old).Source(),
-			}
-			panic(err)
+			panic(self.SubAbbrConflicted(abbr, name))
 		}
 		self.subAbbrsRevIdx[abbr] = name
 		olds, _ := self.subAbbrs[name]
@@ -431,6 +427,37 @@ func (self *CmdTree) addSubAbbrs(name string, abbrs ...string) {
 	}
 }
 
+// The error of using an existing sub name or abbr for another sub command
+func (self *CmdTree) SubAbbrConflicted(abbr string, name string) CmdTreeErrSubAbbrConflicted {
+	old := self.subAbbrsRevIdx[abbr]
+	return CmdTreeErrSubAbbrConflicted{
+		fmt.Sprintf("%s: sub command abbr name '%s' conflicted, "+
+			"old for '%s', new for '%s'",
+			self.DisplayPath(), abbr, old, name),
+		self.Path(),
+		abbr,
+		old,
+		name,
+		self.GetSub(old).Source(),
+	}
+}
+
+// Add abbrs the same as AddAbbrs, but the conflicted error is returned instead of panic,
+// no abbr is added if any of them is conflicted
+func (self *CmdTree) TryAddAbbrs(abbrs ...string) error {
+	if self.parent == nil {
+		return fmt.Errorf("can't add abbrs %v to root", abbrs)
+	}
+	for _, abbr := range abbrs {
+		old, ok := self.parent.subAbbrsRevIdx[abbr]
+		if ok && old != self.name {
+			return self.parent.SubAbbrConflicted(abbr, self.name)
+		}
+	}
+	self.parent.addSubAbbrs(self.name, abbrs...)
+	return nil
+}
+
 func (self *CmdTree) getOrAddSub(source string, addIfNotExists bool, path ...string) *CmdTree {
 	if len(path) == 0 {
 		return self
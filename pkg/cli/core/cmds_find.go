@@ -0,0 +1,225 @@
+package core
+
+import (
+	"strings"
+)
+
+// The relevance of a search hit, higher is better, a fuzzy hit gets half of the score
+const (
+	FindScoreExact  = 100 // name or abbr equals the find-str
+	FindScorePrefix = 80  // name or abbr starts with the find-str
+	FindScorePath   = 60  // find-str is in name, abbrs or path
+	FindScoreTag    = 50
+	FindScoreHelp   = 40
+	FindScoreArg    = 30 // arg names, env keys and env ops
+	FindScoreOther  = 20 // cmd-line, type, depends, flags and source
+)
+
+// The best hit of a find-str in a command
+type FindMatch struct {
+	Field string // which field is matched: name, abbr, path, tag, help, arg, env, ...
+	Value string // the content of the matched field
+	Hit   string // the matched part of the value
+	Fuzzy bool
+	Score int
+}
+
+// Every find-str should be matched, return the sum of the scores and the best hit of each find-str
+func (self *CmdTree) MatchFindRank(findStrs ...string) (score int, matches []FindMatch) {
+	for _, str := range findStrs {
+		if len(str) == 0 {
+			continue
+		}
+		match := self.matchFindRank(str)
+		if match.Score <= 0 {
+			return 0, nil
+		}
+		score += match.Score
+		matches = append(matches, match)
+	}
+	return
+}
+
+func (self *CmdTree) matchFindRank(findStr string) FindMatch {
+	ranker := &findRanker{findStr, FindMatch{}}
+
+	names := []string{self.name}
+	if self.parent != nil {
+		names = append(names, self.parent.SubAbbrs(self.name)...)
+	}
+	for i, name := range names {
+		field := "abbr"
+		if i == 0 {
+			field = "name"
+		}
+		if name == findStr {
+			ranker.hit(field, name, name, FindScoreExact)
+		} else if strings.HasPrefix(name, findStr) {
+			ranker.hit(field, name, findStr, FindScorePrefix)
+		} else {
+			ranker.substr(field, name, FindScorePath)
+		}
+		ranker.fuzzy(field, name, FindScorePath)
+	}
+
+	path := self.DisplayPath()
+	ranker.substr("path", path, FindScorePath)
+	ranker.fuzzy("path", path, FindScorePath)
+
+	for _, tag := range self.tags {
+		ranker.substr("tag", self.Strs.TagMark+tag, FindScoreTag)
+		ranker.fuzzy("tag", self.Strs.TagMark+tag, FindScoreTag)
+	}
+
+	if self.cmd != nil {
+		self.cmd.matchFindRank(ranker)
+	}
+
+	source := self.source
+	if len(source) == 0 {
+		source = "builtin"
+	}
+	ranker.substr("source", source, FindScoreOther)
+	return ranker.best
+}
+
+func (self *Cmd) matchFindRank(ranker *findRanker) {
+	ranker.substr("help", self.help, FindScoreHelp)
+	ranker.fuzzy("help", self.help, FindScoreHelp)
+
+	for _, name := range self.args.orderedList {
+		for _, abbr := range self.args.Abbrs(name) {
+			ranker.substr("arg", abbr, FindScoreArg)
+			ranker.fuzzy("arg", abbr, FindScoreArg)
+		}
+	}
+
+	for _, key := range self.val2env.orderedKeys {
+		ranker.substr("env", key, FindScoreArg)
+	}
+	for name, key := range self.arg2env.nameKeys {
+		ranker.substr("arg", name, FindScoreArg)
+		ranker.substr("env", key, FindScoreArg)
+	}
+	for _, key := range self.envOps.orderedNames {
+		ranker.substr("env", key, FindScoreArg)
+		for _, op := range self.envOps.Ops(key) {
+			ranker.substr("env", key+" "+EnvOpStr(op), FindScoreArg)
+		}
+	}
+
+	ranker.substr("cmd-line", self.cmdLine, FindScoreOther)
+	ranker.substr("type", string(self.ty), FindScoreOther)
+	for _, dep := range self.depends {
+		ranker.substr("depend", dep.OsCmd, FindScoreOther)
+		ranker.substr("depend", dep.Reason, FindScoreOther)
+	}
+	if len(self.val2env.orderedKeys) != 0 || len(self.arg2env.nameKeys) != 0 {
+		ranker.substr("flag", "write", FindScoreOther)
+	}
+	if self.quiet {
+		ranker.substr("flag", "quiet", FindScoreOther)
+	}
+	if self.ty == CmdTypePower {
+		ranker.substr("flag", "power", FindScoreOther)
+	}
+	if self.priority {
+		ranker.substr("flag", "priority", FindScoreOther)
+	}
+}
+
+type findRanker struct {
+	findStr string
+	best    FindMatch
+}
+
+func (self *findRanker) hit(field string, value string, hit string, score int) {
+	if score > self.best.Score {
+		self.best = FindMatch{field, value, hit, false, score}
+	}
+}
+
+func (self *findRanker) substr(field string, value string, score int) {
+	if score > self.best.Score && strings.Index(value, self.findStr) >= 0 {
+		self.best = FindMatch{field, value, self.findStr, false, score}
+	}
+}
+
+// Typo tolerance: match the words of the value with a small edit distance, ignoring case
+func (self *findRanker) fuzzy(field string, value string, score int) {
+	score /= 2
+	if score <= self.best.Score {
+		return
+	}
+	word := FuzzyMatchWord(self.findStr, value)
+	if len(word) != 0 {
+		self.best = FindMatch{field, value, word, true, score}
+	}
+}
+
+// Return the first word in text similar to findStr, or empty if not found
+func FuzzyMatchWord(findStr string, text string) string {
+	maxDist := fuzzyMaxDistance(findStr)
+	if maxDist <= 0 {
+		return ""
+	}
+	findStr = strings.ToLower(findStr)
+	isSep := func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}
+	for _, word := range strings.FieldsFunc(text, isSep) {
+		if EditDistance(findStr, strings.ToLower(word), maxDist) <= maxDist {
+			return word
+		}
+	}
+	return ""
+}
+
+// Too short strs are not matched by fuzzy, it brings too much noise
+func fuzzyMaxDistance(findStr string) int {
+	if len(findStr) < 4 {
+		return 0
+	} else if len(findStr) < 8 {
+		return 1
+	}
+	return 2
+}
+
+// Edit distance with transpositions (eg: 'ecoh' to 'echo' is 1),
+// return maxDist+1 without calculating if the lengths differ too much
+func EditDistance(a string, b string, maxDist int) int {
+	if len(a)-len(b) > maxDist || len(b)-len(a) > maxDist {
+		return maxDist + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = minInt(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+func minInt(vals ...int) int {
+	res := vals[0]
+	for _, val := range vals[1:] {
+		if val < res {
+			res = val
+		}
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	test := func(a string, b string, maxDist int, expected int) {
+		dist := EditDistance(a, b, maxDist)
+		if dist != expected {
+			t.Fatalf("%#v vs %#v (max %d): distance %#v != %#v\n", a, b, maxDist, dist, expected)
+		}
+	}
+
+	test("echo", "echo", 2, 0)
+	test("", "", 1, 0)
+	test("ecoh", "echo", 2, 1)
+	test("eco", "echo", 2, 1)
+	test("echoo", "echo", 2, 1)
+	test("ekho", "echo", 2, 1)
+	test("ehco", "echo", 2, 1)
+	test("deploy", "dpeloy", 2, 1)
+	test("kitten", "sitting", 3, 3)
+	test("abc", "", 3, 3)
+	// Lengths differ too much, not calculated
+	test("a", "abcd", 2, 3)
+	test("abcdef", "a", 1, 2)
+}
+
+func TestFuzzyMatchWord(t *testing.T) {
+	test := func(findStr string, text string, expected string) {
+		word := FuzzyMatchWord(findStr, text)
+		if word != expected {
+			t.Fatalf("%#v in %#v: matched %#v != %#v\n", findStr, text, word, expected)
+		}
+	}
+
+	test("ecoh", "print message by echo", "echo")
+	test("ECOH", "echo", "echo")
+	test("ecoh", "Echo", "Echo")
+	test("deplyo", "cluster.deploy.full", "deploy")
+	test("clsuter", "cluster.deploy", "cluster")
+	test("enviroment", "dump the environment", "environment")
+	// Too short to be fuzzy matched
+	test("eco", "echo", "")
+	test("ab", "ac", "")
+	// Too far
+	test("ehoc", "echo", "")
+	test("xyzw", "echo", "")
+	test("environ", "dump the environment", "")
+}
+
+func TestMatchFindRank(t *testing.T) {
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	echo := tree.AddSub("echo", "e")
+	echo.RegEmptyCmd("print message")
+	dummy := tree.AddSub("dummy", "dmy")
+	dummy.RegEmptyCmd("dummy cmd, echo nothing")
+	deploy := tree.AddSub("cluster").AddSub("deploy", "dp")
+	deploy.RegEmptyCmd("deploy a cluster")
+	deploy.AddTags("ready")
+
+	test := func(cmd *CmdTree, findStrs []string, field string, hit string, fuzzy bool) {
+		score, matches := cmd.MatchFindRank(findStrs...)
+		if score <= 0 || len(matches) != len(findStrs) {
+			t.Fatalf("%#v: %#v should be matched\n", cmd.DisplayPath(), findStrs)
+		}
+		last := matches[len(matches)-1]
+		if last.Field != field || last.Hit != hit || last.Fuzzy != fuzzy {
+			t.Fatalf("%#v: %#v matched %#v != %#v\n", cmd.DisplayPath(), findStrs, last,
+				FindMatch{field, "", hit, fuzzy, 0})
+		}
+	}
+
+	test(echo, []string{"echo"}, "name", "echo", false)
+	test(echo, []string{"e"}, "abbr", "e", false)
+	test(echo, []string{"ech"}, "name", "ech", false)
+	test(echo, []string{"mess"}, "help", "mess", false)
+	test(echo, []string{"ecoh"}, "name", "echo", true)
+	test(dummy, []string{"echo"}, "help", "echo", false)
+	test(deploy, []string{"dp"}, "abbr", "dp", false)
+	test(deploy, []string{"clu"}, "path", "clu", false)
+	test(deploy, []string{"cluster", "ready"}, "tag", "ready", false)
+	test(deploy, []string{"clsuter"}, "path", "cluster", true)
+
+	noMatch := func(cmd *CmdTree, findStrs ...string) {
+		if score, _ := cmd.MatchFindRank(findStrs...); score != 0 {
+			t.Fatalf("%#v: %#v should not be matched, score %d\n", cmd.DisplayPath(), findStrs, score)
+		}
+	}
+
+	noMatch(echo, "xyz")
+	noMatch(echo, "echo", "xyz")
+	noMatch(deploy, "eco")
+
+	rank := func(findStr string, better *CmdTree, worse *CmdTree) {
+		betterScore, _ := better.MatchFindRank(findStr)
+		worseScore, _ := worse.MatchFindRank(findStr)
+		if betterScore <= worseScore {
+			t.Fatalf("%#v: %#v score %d should be higher than %#v score %d\n", findStr,
+				better.DisplayPath(), betterScore, worse.DisplayPath(), worseScore)
+		}
+	}
+
+	rank("echo", echo, dummy)
+	rank("ech", echo, dummy)
+	rank("ecoh", echo, dummy)
+	rank("deploy", deploy, echo)
+}
@@ -1,8 +1,16 @@
 package core
 
+import (
+	"sort"
+)
+
 type DependInfo struct {
-	Reason string
-	Cmd    ParsedCmd
+	Reason         string
+	Cmd            ParsedCmd
+	Installs       []DependInstall
+	Version        string
+	VersionProbe   string
+	VersionPattern string
 }
 
 type Depends map[string]map[*Cmd]DependInfo
@@ -50,10 +58,11 @@ func collectDepends(
 		deps := cic.GetDepends()
 		for _, dep := range deps {
 			cmds, ok := res[dep.OsCmd]
+			info := DependInfo{dep.Reason, it, dep.Installs, dep.Version, dep.VersionProbe, dep.VersionPattern}
 			if ok {
-				cmds[cic] = DependInfo{dep.Reason, it}
+				cmds[cic] = info
 			} else {
-				res[dep.OsCmd] = map[*Cmd]DependInfo{cic: DependInfo{dep.Reason, it}}
+				res[dep.OsCmd] = map[*Cmd]DependInfo{cic: info}
 			}
 		}
 
@@ -74,6 +83,66 @@ func collectDepends(
 	}
 }
 
+// Merge the install recipes of an os-command from all commands, the first one wins if installers are the same
+func (self Depends) Installs(osCmd string) (installs []DependInstall) {
+	cmds, ok := self[osCmd]
+	if !ok {
+		return
+	}
+	installers := map[string]bool{}
+	for _, info := range sortedDependInfos(cmds) {
+		for _, it := range info.Installs {
+			if installers[it.Installer] {
+				continue
+			}
+			installers[it.Installer] = true
+			installs = append(installs, it)
+		}
+	}
+	return
+}
+
+// Collect the version constraints of an os-command from all commands
+func (self Depends) VersionConstraints(osCmd string) (constraints []string) {
+	exists := map[string]bool{}
+	for _, info := range sortedDependInfos(self[osCmd]) {
+		if len(info.Version) == 0 || exists[info.Version] {
+			continue
+		}
+		exists[info.Version] = true
+		constraints = append(constraints, info.Version)
+	}
+	return
+}
+
+func (self Depends) VersionProbe(osCmd string) string {
+	for _, info := range sortedDependInfos(self[osCmd]) {
+		if len(info.VersionProbe) != 0 {
+			return info.VersionProbe
+		}
+	}
+	return osCmd + " --version"
+}
+
+func (self Depends) VersionPattern(osCmd string) string {
+	for _, info := range sortedDependInfos(self[osCmd]) {
+		if len(info.VersionPattern) != 0 {
+			return info.VersionPattern
+		}
+	}
+	return ""
+}
+
+func sortedDependInfos(cmds map[*Cmd]DependInfo) (infos []DependInfo) {
+	for _, info := range cmds {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Cmd.DisplayPath(".", false) < infos[j].Cmd.DisplayPath(".", false)
+	})
+	return
+}
+
 func TryExeEnvOpCmds(
 	argv ArgVals,
 	cc *Cli,
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// A version probe should return at once, it's killed if it takes longer than this
+const versionProbeTimeout = 5 * time.Second
+
+var (
+	versionDottedPattern = regexp.MustCompile(`[0-9]+(\.[0-9]+)+`)
+	versionNumberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+type versionProbeKey struct {
+	probe   string
+	pattern string
+}
+
+type versionProbeResult struct {
+	version string
+	err     error
+}
+
+// The probe results of a session, so each probe only runs once
+type VersionProbes struct {
+	lock    sync.Mutex
+	results map[versionProbeKey]versionProbeResult
+}
+
+func NewVersionProbes() *VersionProbes {
+	return &VersionProbes{results: map[versionProbeKey]versionProbeResult{}}
+}
+
+// Same as ProbeOsCmdVersion, but only run the probe command once
+func (self *VersionProbes) Probe(probe string, pattern string) (version string, err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	key := versionProbeKey{probe, pattern}
+	if res, ok := self.results[key]; ok {
+		return res.version, res.err
+	}
+	version, err = ProbeOsCmdVersion(probe, pattern)
+	self.results[key] = versionProbeResult{version, err}
+	return
+}
+
+// Drop the cached results of a probe, eg: the os-command is just installed or upgraded
+func (self *VersionProbes) Reset(probe string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for key := range self.results {
+		if key.probe == probe {
+			delete(self.results, key)
+		}
+	}
+}
+
+// Drop all cached results, called when a session ends
+func (self *VersionProbes) Clear() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.results = map[versionProbeKey]versionProbeResult{}
+}
+
+// Run the probe command and extract the version from the output(stdout and stderr),
+// by the pattern if it's not empty, see ExtractVersionByPattern
+func ProbeOsCmdVersion(probe string, pattern string) (version string, err error) {
+	return probeOsCmdVersion(probe, pattern, versionProbeTimeout)
+}
+
+func probeOsCmdVersion(probe string, pattern string, timeout time.Duration) (version string, err error) {
+	args, err := shellwords.Parse(probe)
+	if err != nil {
+		return "", fmt.Errorf("parse version probe '%s' failed: %v", probe, err)
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty version probe")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	// Read from the null device, so a probe asking for input won't wait for the user
+	cmd.Stdin = nil
+	output, runErr := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("run version probe '%s' timeout, killed after %v", probe, timeout)
+	}
+	if len(pattern) != 0 {
+		version, err = ExtractVersionByPattern(string(output), pattern)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		version = ExtractVersion(string(output))
+	}
+	if len(version) == 0 {
+		if runErr != nil {
+			return "", fmt.Errorf("run version probe '%s' failed: %v", probe, runErr)
+		}
+		return "", fmt.Errorf("no version found in output of '%s'", probe)
+	}
+	return version, nil
+}
+
+// Use the dotted numbers with the most segments as version, the first one if there are many,
+// eg: "git version 2.20.1" => "2.20.1", "mysql Ver 14.14 Distrib 5.7.36" => "5.7.36"
+func ExtractVersion(output string) string {
+	var version string
+	segs := 0
+	for _, it := range versionDottedPattern.FindAllString(output, -1) {
+		if n := strings.Count(it, ".") + 1; n > segs {
+			version = it
+			segs = n
+		}
+	}
+	if len(version) == 0 {
+		version = versionNumberPattern.FindString(output)
+	}
+	return version
+}
+
+// Use the first submatch of the pattern as version, or the whole match if the pattern has no group
+func ExtractVersionByPattern(output string, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("bad version pattern '%s': %v", pattern, err)
+	}
+	matched := re.FindStringSubmatch(output)
+	if len(matched) == 0 {
+		return "", nil
+	}
+	if len(matched) > 1 {
+		return matched[1], nil
+	}
+	return matched[0], nil
+}
+
+// The constraint format: "<op> <version>[, <op> <version>...]", op could be: >=, >, <=, <, =, ==, !=
+func CheckVersionConstraint(version string, constraint string) (ok bool, err error) {
+	for _, it := range strings.Split(constraint, ",") {
+		it = strings.TrimSpace(it)
+		if len(it) == 0 {
+			continue
+		}
+		op, required := splitVersionOp(it)
+		if len(required) == 0 {
+			return false, fmt.Errorf("bad version constraint '%s'", constraint)
+		}
+		cmp, err := CompareVersion(version, required)
+		if err != nil {
+			return false, err
+		}
+		var matched bool
+		switch op {
+		case ">=":
+			matched = cmp >= 0
+		case ">":
+			matched = cmp > 0
+		case "<=":
+			matched = cmp <= 0
+		case "<":
+			matched = cmp < 0
+		case "=", "==", "":
+			matched = cmp == 0
+		case "!=":
+			matched = cmp != 0
+		default:
+			return false, fmt.Errorf("bad operator '%s' in version constraint '%s'", op, constraint)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func splitVersionOp(str string) (op string, version string) {
+	i := strings.IndexAny(str, "0123456789vV")
+	if i < 0 {
+		return str, ""
+	}
+	return strings.TrimSpace(str[:i]), strings.TrimSpace(str[i:])
+}
+
+// Compare versions by numeric segments, the missed segments are 0, suffixes like "-rc1" are ignored
+func CompareVersion(a string, b string) (int, error) {
+	as, err := parseVersionSegs(a)
+	if err != nil {
+		return 0, err
+	}
+	bs, err := parseVersionSegs(b)
+	if err != nil {
+		return 0, err
+	}
+	for len(as) < len(bs) {
+		as = append(as, 0)
+	}
+	for len(bs) < len(as) {
+		bs = append(bs, 0)
+	}
+	for i := range as {
+		if as[i] < bs[i] {
+			return -1, nil
+		}
+		if as[i] > bs[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersionSegs(version string) (segs []int, err error) {
+	origin := version
+	version = strings.TrimLeft(version, "vV")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	for _, it := range strings.Split(version, ".") {
+		seg, err := strconv.Atoi(it)
+		if err != nil {
+			return nil, fmt.Errorf("bad version '%s'", origin)
+		}
+		segs = append(segs, seg)
+	}
+	return
+}
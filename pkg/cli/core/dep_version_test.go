@@ -0,0 +1,162 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareVersion(t *testing.T) {
+	test := func(a string, b string, expected int) {
+		cmp, err := CompareVersion(a, b)
+		if err != nil {
+			t.Fatalf("%#v vs %#v: unexpected error: %v\n", a, b, err)
+		}
+		if cmp != expected {
+			t.Fatalf("%#v vs %#v: result %#v != %#v\n", a, b, cmp, expected)
+		}
+	}
+
+	test("1.10", "1.9", 1)
+	test("1.9", "1.10", -1)
+	test("1.2", "1.2.0", 0)
+	test("1.2.1", "1.2", 1)
+	test("2", "1.99.99", 1)
+	test("v1.2.3", "1.2.3", 0)
+	test("V1.2.3", "v1.2.4", -1)
+	test("1.2.0-rc1", "1.2.0", 0)
+	test("1.2.0-rc1", "1.1.9", 1)
+	test("1.2.0+build.5", "1.2.0", 0)
+
+	fail := func(a string, b string) {
+		if _, err := CompareVersion(a, b); err == nil {
+			t.Fatalf("%#v vs %#v: should be failed\n", a, b)
+		}
+	}
+
+	fail("", "1.0")
+	fail("1.x", "1.0")
+	fail("1.0", "abc")
+	fail("1..2", "1.0")
+}
+
+func TestCheckVersionConstraint(t *testing.T) {
+	test := func(version string, constraint string, expected bool) {
+		ok, err := CheckVersionConstraint(version, constraint)
+		if err != nil {
+			t.Fatalf("%#v, %#v: unexpected error: %v\n", version, constraint, err)
+		}
+		if ok != expected {
+			t.Fatalf("%#v, %#v: result %#v != %#v\n", version, constraint, ok, expected)
+		}
+	}
+
+	test("1.10", ">= 1.9", true)
+	test("1.10", "> 1.10", false)
+	test("1.10", "<= 1.10.0", true)
+	test("1.10", "< 1.9", false)
+	test("1.10", "= 1.10", true)
+	test("1.10", "== 1.10.1", false)
+	test("1.10", "1.10", true)
+	test("1.10", "!= 1.10", false)
+	test("v2.20.1", ">= 2.0, < 3.0", true)
+	test("3.0.0", ">= 2.0, < 3.0", false)
+	test("2.5", ">=v2.0,<v3", true)
+	test("1.2.0-rc1", ">= 1.2", true)
+	test("1.0", "", true)
+
+	fail := func(version string, constraint string) {
+		if _, err := CheckVersionConstraint(version, constraint); err == nil {
+			t.Fatalf("%#v, %#v: should be failed\n", version, constraint)
+		}
+	}
+
+	fail("1.0", ">=")
+	fail("1.0", "~> 1.0")
+	fail("1.0", ">= x")
+	fail("abc", ">= 1.0")
+}
+
+func TestExtractVersion(t *testing.T) {
+	test := func(output string, version string) {
+		if ExtractVersion(output) != version {
+			t.Fatalf("%#v: version %#v != %#v\n", output, ExtractVersion(output), version)
+		}
+	}
+
+	test("git version 2.20.1", "2.20.1")
+	test("mysql  Ver 8.0.28 for Linux on x86_64", "8.0.28")
+	test("mysql  Ver 14.14 Distrib 5.7.36, for Linux (x86_64)", "5.7.36")
+	test("Python 3.9.7 (default, GCC 9.4.0)", "3.9.7")
+	test("jq-1.6", "1.6")
+	test("version 3", "3")
+	test("no version", "")
+}
+
+func TestExtractVersionByPattern(t *testing.T) {
+	test := func(output string, pattern string, version string) {
+		res, err := ExtractVersionByPattern(output, pattern)
+		if err != nil {
+			t.Fatalf("%#v, %#v: unexpected error: %v\n", output, pattern, err)
+		}
+		if res != version {
+			t.Fatalf("%#v, %#v: version %#v != %#v\n", output, pattern, res, version)
+		}
+	}
+
+	mysql := "mysql  Ver 14.14 Distrib 5.7.36, for Linux (x86_64)"
+	test(mysql, `Distrib ([0-9.]+)`, "5.7.36")
+	test(mysql, `Ver [0-9.]+`, "Ver 14.14")
+	test(mysql, `Distrib ([0-9.]+)-ubuntu`, "")
+
+	if _, err := ExtractVersionByPattern(mysql, `(`); err == nil {
+		t.Fatalf("bad pattern should be failed\n")
+	}
+}
+
+func TestVersionProbes(t *testing.T) {
+	probes := NewVersionProbes()
+	probe := "echo Ver 14.14 Distrib 1.2.3"
+
+	version, err := probes.Probe(probe, "")
+	if err != nil || version != "1.2.3" {
+		t.Fatalf("%#v: probed %#v, %v\n", probe, version, err)
+	}
+	version, err = probes.Probe(probe, `Ver ([0-9.]+)`)
+	if err != nil || version != "14.14" {
+		t.Fatalf("%#v: probed by pattern %#v, %v\n", probe, version, err)
+	}
+
+	probes.results[versionProbeKey{probe, ""}] = versionProbeResult{"9.9.9", nil}
+	version, _ = probes.Probe(probe, "")
+	if version != "9.9.9" {
+		t.Fatalf("%#v: probe result is not cached, got %#v\n", probe, version)
+	}
+	probes.Reset(probe)
+	version, _ = probes.Probe(probe, "")
+	if version != "1.2.3" {
+		t.Fatalf("%#v: cache is not reset, got %#v\n", probe, version)
+	}
+
+	probes.Clear()
+	if len(probes.results) != 0 {
+		t.Fatalf("probe results should be cleared\n")
+	}
+}
+
+func TestProbeOsCmdVersionTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := probeOsCmdVersion("sleep 10", "", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("the probe should be timeout, got: %v\n", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the probe should be killed, elapsed: %v\n", elapsed)
+	}
+
+	// The probe reading stdin gets EOF at once
+	_, err = probeOsCmdVersion("cat", "", 5*time.Second)
+	if err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("the probe should be failed without waiting for input, got: %v\n", err)
+	}
+}
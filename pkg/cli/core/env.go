@@ -10,6 +10,7 @@ type EnvLayerType string
 const (
 	EnvLayerDefault   EnvLayerType = "default"
 	EnvLayerPersisted              = "persisted"
+	EnvLayerOs                     = "os"
 	EnvLayerSession                = "session"
 	EnvLayerCmd                    = "command"
 	EnvLayerTmp                    = "temporary"
@@ -20,13 +21,14 @@ func EnvLayerName(ty EnvLayerType) string {
 }
 
 type Env struct {
-	pairs  map[string]EnvVal
-	parent *Env
-	ty     EnvLayerType
+	pairs   map[string]EnvVal
+	parent  *Env
+	ty      EnvLayerType
+	journal *EnvJournal
 }
 
 func NewEnv() *Env {
-	return &Env{map[string]EnvVal{}, nil, EnvLayerDefault}
+	return &Env{map[string]EnvVal{}, nil, EnvLayerDefault, nil}
 }
 
 // TODO: COW ?
@@ -39,7 +41,8 @@ func (self *Env) Clone() (env *Env) {
 	if self.parent != nil {
 		parent = self.parent.Clone()
 	}
-	return &Env{pairs, parent, self.ty}
+	// The journal is not cloned, changes on a cloned env should not be recorded
+	return &Env{pairs, parent, self.ty, nil}
 }
 
 func (self *Env) Clear(recursive bool) {
@@ -48,6 +51,8 @@ func (self *Env) Clear(recursive bool) {
 		// TODO: put all these special key path in one place
 		if strings.HasPrefix(k, "sys.") || k == "session" {
 			pairs[k] = EnvVal{v.Raw, v.IsArg}
+		} else {
+			self.record(k, "", true)
 		}
 	}
 	self.pairs = pairs
@@ -109,10 +114,12 @@ func (self Env) Has(name string) bool {
 }
 
 func (self Env) DeleteInSelfLayer(name string) {
+	self.record(name, "", true)
 	delete(self.pairs, name)
 }
 
 func (self Env) Delete(name string) {
+	self.record(name, "", true)
 	delete(self.pairs, name)
 	if self.parent != nil {
 		self.parent.Delete(name)
@@ -123,6 +130,7 @@ func (self Env) DeleteEx(name string, stopLayer EnvLayerType) {
 	if self.ty == stopLayer {
 		return
 	}
+	self.record(name, "", true)
 	delete(self.pairs, name)
 	if self.parent != nil {
 		self.parent.DeleteEx(name, stopLayer)
@@ -131,6 +139,7 @@ func (self Env) DeleteEx(name string, stopLayer EnvLayerType) {
 
 func (self *Env) Merge(x *Env) {
 	for k, v := range x.pairs {
+		self.record(k, v.Raw, false)
 		self.pairs[k] = EnvVal{v.Raw, false}
 	}
 }
@@ -157,6 +166,7 @@ func (self *Env) SetIfEmpty(name string, val string) (old EnvVal) {
 	if exists {
 		return
 	}
+	self.record(name, val, false)
 	self.pairs[name] = EnvVal{val, false}
 	return
 }
@@ -171,6 +181,7 @@ func (self *Env) SetEx(name string, val string, isArg bool) (old EnvVal) {
 	if exists && old.Raw == val {
 		return
 	}
+	self.record(name, val, false)
 	self.pairs[name] = EnvVal{val, isArg}
 	return
 }
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+type EnvChange struct {
+	Key       string
+	Old       string
+	OldExists bool
+	New       string
+	Deleted   bool
+	Writer    string
+	Step      int
+	Time      time.Time
+
+	// The value in the journaled layer before changing, for rolling back
+	layerOld       EnvVal
+	layerOldExists bool
+}
+
+// The change journal of an env layer (normally the session layer)
+type EnvJournal struct {
+	Changes []EnvChange
+	writer  string
+	step    int
+}
+
+func NewEnvJournal() *EnvJournal {
+	return &EnvJournal{nil, "", 0}
+}
+
+// Called before executing a command, all changes after this belong to this step
+func (self *EnvJournal) BeginStep(writer string) int {
+	self.step += 1
+	self.writer = writer
+	return self.step
+}
+
+// Change the writer without starting a new step
+func (self *EnvJournal) SetWriter(writer string) {
+	self.writer = writer
+}
+
+func (self *EnvJournal) CurrStep() int {
+	return self.step
+}
+
+func (self *EnvJournal) KeyHistory(key string) (changes []EnvChange) {
+	for _, it := range self.Changes {
+		if it.Key == key {
+			changes = append(changes, it)
+		}
+	}
+	return
+}
+
+// TODO: put all these special key path in one place
+func isEnvJournalIgnoredKey(key string) bool {
+	return key == "session" || strings.HasPrefix(key, "sys.stack")
+}
+
+func (self *Env) EnableJournal() *Env {
+	if self.journal == nil {
+		self.journal = NewEnvJournal()
+	}
+	return self
+}
+
+// Get the journal of the nearest journaled layer
+func (self *Env) Journal() *EnvJournal {
+	if self.journal != nil {
+		return self.journal
+	}
+	if self.parent == nil {
+		return nil
+	}
+	return self.parent.Journal()
+}
+
+// Roll the journaled layer back to the state before the specified step,
+// return the count of reverted changes
+func (self *Env) RollbackJournal(step int) (reverted int) {
+	env := self
+	for env != nil && env.journal == nil {
+		env = env.parent
+	}
+	if env == nil {
+		return
+	}
+	journal := env.journal
+	changes := journal.Changes
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if change.Step < step {
+			break
+		}
+		if change.layerOldExists {
+			env.record(change.Key, change.layerOld.Raw, false)
+			env.pairs[change.Key] = change.layerOld
+		} else {
+			env.record(change.Key, "", true)
+			delete(env.pairs, change.Key)
+		}
+		reverted += 1
+	}
+	return
+}
+
+// Clone the env, the journaled layer of the cloned one is in the state before the specified step
+func (self *Env) CloneBeforeStep(step int) *Env {
+	env := self.Clone()
+	src := self
+	dest := env
+	for src != nil && src.journal == nil {
+		src = src.parent
+		dest = dest.parent
+	}
+	if src == nil {
+		return env
+	}
+	changes := src.journal.Changes
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if change.Step < step {
+			break
+		}
+		if change.layerOldExists {
+			dest.pairs[change.Key] = change.layerOld
+		} else {
+			delete(dest.pairs, change.Key)
+		}
+	}
+	return env
+}
+
+func (self *Env) record(name string, val string, deleted bool) {
+	if self.journal == nil || isEnvJournalIgnoredKey(name) {
+		return
+	}
+	layerOld, layerOldExists := self.pairs[name]
+	if deleted && !layerOldExists {
+		return
+	}
+	old, oldExists := self.GetEx(name)
+	self.journal.Changes = append(self.journal.Changes, EnvChange{
+		name,
+		old.Raw,
+		oldExists,
+		val,
+		deleted,
+		self.journal.writer,
+		self.journal.step,
+		time.Now(),
+		layerOld,
+		layerOldExists,
+	})
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newJournaledEnvForTest() *Env {
+	env := NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+	env.GetLayer(EnvLayerDefault).Set("p", "def")
+	env.EnableJournal()
+	return env
+}
+
+func TestEnvJournalRecord(t *testing.T) {
+	type change struct {
+		key       string
+		old       string
+		oldExists bool
+		new       string
+		deleted   bool
+	}
+
+	tests := []struct {
+		name     string
+		prepare  func(env *Env)
+		op       func(env *Env)
+		expected []change
+	}{
+		{
+			"set new key",
+			nil,
+			func(env *Env) { env.Set("a", "1") },
+			[]change{{"a", "", false, "1", false}},
+		},
+		{
+			"set existing key",
+			func(env *Env) { env.Set("a", "1") },
+			func(env *Env) { env.Set("a", "2") },
+			[]change{{"a", "1", true, "2", false}},
+		},
+		{
+			"set key of parent layer",
+			nil,
+			func(env *Env) { env.Set("p", "1") },
+			[]change{{"p", "def", true, "1", false}},
+		},
+		{
+			"set the same value",
+			func(env *Env) { env.Set("a", "1") },
+			func(env *Env) { env.Set("a", "1") },
+			nil,
+		},
+		{
+			"set as arg",
+			nil,
+			func(env *Env) { env.SetAsArg("a", "1") },
+			[]change{{"a", "", false, "1", false}},
+		},
+		{
+			"set if empty",
+			nil,
+			func(env *Env) { env.SetIfEmpty("a", "1") },
+			[]change{{"a", "", false, "1", false}},
+		},
+		{
+			"set if empty on existing key",
+			nil,
+			func(env *Env) { env.SetIfEmpty("p", "1") },
+			nil,
+		},
+		{
+			"delete",
+			func(env *Env) { env.Set("a", "1") },
+			func(env *Env) { env.Delete("a") },
+			[]change{{"a", "1", true, "", true}},
+		},
+		{
+			"delete not existing key",
+			nil,
+			func(env *Env) { env.Delete("a") },
+			nil,
+		},
+		{
+			"delete key only in parent layer",
+			nil,
+			func(env *Env) { env.Delete("p") },
+			nil,
+		},
+		{
+			"delete in self layer",
+			func(env *Env) { env.Set("p", "1") },
+			func(env *Env) { env.DeleteInSelfLayer("p") },
+			[]change{{"p", "1", true, "", true}},
+		},
+		{
+			"delete with stop layer",
+			func(env *Env) { env.Set("a", "1") },
+			func(env *Env) { env.DeleteEx("a", EnvLayerDefault) },
+			[]change{{"a", "1", true, "", true}},
+		},
+		{
+			"merge",
+			func(env *Env) { env.Set("a", "1") },
+			func(env *Env) {
+				x := NewEnv()
+				x.Set("a", "2")
+				env.Merge(x)
+			},
+			[]change{{"a", "1", true, "2", false}},
+		},
+		{
+			"clear",
+			func(env *Env) {
+				env.Set("a", "1")
+				env.Set("sys.x", "1")
+			},
+			func(env *Env) { env.Clear(false) },
+			[]change{{"a", "1", true, "", true}},
+		},
+		{
+			"ignored keys",
+			nil,
+			func(env *Env) {
+				env.Set("session", "1")
+				env.Set("sys.stack", "1")
+				env.Set("sys.stack-depth", "1")
+			},
+			nil,
+		},
+	}
+
+	for _, it := range tests {
+		env := newJournaledEnvForTest()
+		journal := env.Journal()
+		if it.prepare != nil {
+			journal.BeginStep("prepare")
+			it.prepare(env)
+		}
+		prepared := len(journal.Changes)
+		step := journal.BeginStep("writer")
+		it.op(env)
+
+		var res []change
+		for _, c := range journal.Changes[prepared:] {
+			if c.Writer != "writer" || c.Step != step {
+				t.Fatalf("%s: change %#v should be written by step %d\n", it.name, c, step)
+			}
+			res = append(res, change{c.Key, c.Old, c.OldExists, c.New, c.Deleted})
+		}
+		if !reflect.DeepEqual(res, it.expected) {
+			t.Fatalf("%s: %#v != %#v\n", it.name, res, it.expected)
+		}
+	}
+
+	// Changes on other layers or a cloned env are not recorded
+	env := newJournaledEnvForTest()
+	env.GetLayer(EnvLayerDefault).Set("a", "1")
+	env.Clone().Set("b", "1")
+	env.NewLayer(EnvLayerCmd).Set("c", "1")
+	if len(env.Journal().Changes) != 0 {
+		t.Fatalf("changes should not be recorded: %#v\n", env.Journal().Changes)
+	}
+}
+
+func TestEnvRollbackJournal(t *testing.T) {
+	env := newJournaledEnvForTest()
+	journal := env.Journal()
+
+	state := func(env *Env) map[string]string {
+		vals := map[string]string{}
+		for k, v := range env.pairs {
+			vals[k] = v.Raw
+		}
+		return vals
+	}
+	states := map[int]map[string]string{}
+	step := func(writer string, op func()) {
+		states[journal.BeginStep(writer)] = state(env)
+		op()
+	}
+	rollback := func(step int, reverted int, expected map[string]string) {
+		// The cloned env before the step should be the same as rolling back
+		if cloned := state(env.CloneBeforeStep(step)); !reflect.DeepEqual(cloned, expected) {
+			t.Fatalf("clone before step %d: %#v != %#v\n", step, cloned, expected)
+		}
+		states[journal.BeginStep("rollback")] = state(env)
+		res := env.RollbackJournal(step)
+		if res != reverted {
+			t.Fatalf("rollback to step %d: reverted %d != %d\n", step, res, reverted)
+		}
+		if vals := state(env); !reflect.DeepEqual(vals, expected) {
+			t.Fatalf("rollback to step %d: %#v != %#v\n", step, vals, expected)
+		}
+	}
+
+	step("a", func() {
+		env.Set("a", "1")
+		env.Set("b", "1")
+	})
+	step("b", func() {
+		env.Set("a", "2")
+		env.Delete("b")
+		env.Set("c", "1")
+		env.Set("p", "1")
+	})
+	step("c", func() {
+		// Re-set a deleted key, delete a new key
+		env.Set("b", "2")
+		env.Delete("c")
+	})
+	if !reflect.DeepEqual(states[2], map[string]string{"a": "1", "b": "1"}) {
+		t.Fatalf("bad state before step 2: %#v\n", states[2])
+	}
+
+	// Step 4
+	rollback(3, 2, states[3])
+	if env.GetRaw("p") != "1" {
+		t.Fatalf("the change of step 2 should be kept\n")
+	}
+
+	step("e", func() {
+		env.Set("a", "5")
+		env.Set("d", "1")
+	})
+
+	// Step 6, only revert the changes after the last rollback
+	rollback(5, 2, states[5])
+
+	// Step 7, revert through the rollbacks
+	rollback(2, 12, states[2])
+	if env.GetRaw("p") != "def" {
+		t.Fatalf("the key of parent layer should be visible after rolling back\n")
+	}
+
+	// Step 8, undo the last rollback
+	rollback(7, 12, states[7])
+	if env.GetRaw("p") != "1" {
+		t.Fatalf("the key of parent layer should be set again by undoing the rollback\n")
+	}
+
+	// The reverts are recorded with the writer of the rollback step
+	for _, c := range journal.KeyHistory("d") {
+		if c.Step >= 6 && c.Writer != "rollback" {
+			t.Fatalf("revert %#v should be written by rollback\n", c)
+		}
+	}
+
+	// Rolling back to before all steps clears the journaled layer
+	rollback(1, len(journal.Changes), map[string]string{})
+}
@@ -146,41 +146,7 @@ func (self EnvOpsChecker) OnCallCmd(
 	keys, origins, _ := ops.RenderedEnvKeys(argv, env, cmd, false)
 	for i, key := range keys {
 		for _, curr := range ops.Ops(origins[i]) {
-			before, _ := self[key]
-
-			if (curr&EnvOpTypeWrite) == 0 && (curr&EnvOpTypeMayWrite) != 0 {
-				before.mayWriteCmds = append(before.mayWriteCmds, MayWriteCmd{matched, cmd})
-			}
-			before.val = before.val | curr
-			self[key] = before
-
-			var res EnvOpsCheckResult
-			res.Key = key
-			res.CmdDisplayPath = displayPath
-			res.Cmd = cmd.Owner()
-			if (before.val&EnvOpTypeWrite) == 0 &&
-				(before.val&EnvOpTypeMayWrite) == 0 {
-				if (before.val & EnvOpTypeRead) != 0 {
-					res.ReadNotExist = true
-				} else if (before.val & EnvOpTypeMayRead) != 0 {
-					res.MayReadNotExist = true
-				}
-			} else if (before.val & EnvOpTypeMayWrite) != 0 {
-				if (before.val & EnvOpTypeRead) != 0 {
-					res.ReadMayWrite = true
-					res.MayWriteCmdsBefore = before.mayWriteCmds
-				} else if (before.val & EnvOpTypeMayRead) != 0 {
-					res.MayReadMayWrite = true
-					res.MayWriteCmdsBefore = before.mayWriteCmds
-				}
-			}
-			var passCheck bool
-			if ignoreMaybe {
-				passCheck = !res.ReadNotExist
-			} else {
-				passCheck = !(res.ReadMayWrite || res.MayReadMayWrite ||
-					res.MayReadNotExist || res.ReadNotExist)
-			}
+			res, passCheck := self.onKeyOp(key, curr, matched, cmd, ignoreMaybe, displayPath)
 			if !passCheck && len(env.GetRaw(res.Key)) == 0 {
 				res.FirstArg2Env = arg2envs.Get(res.Key)
 				result = append(result, res)
@@ -190,6 +156,81 @@ func (self EnvOpsChecker) OnCallCmd(
 	return
 }
 
+// The keys read by the templates of a flow are checked as the read ops of it
+func (self EnvOpsChecker) OnFlowTemplateReads(
+	env *Env,
+	argv ArgVals,
+	matched ParsedCmd,
+	cmd *Cmd,
+	ignoreMaybe bool,
+	displayPath string,
+	arg2envs FirstArg2EnvProviders) (result []EnvOpsCheckResult) {
+
+	keys, mayKeys := cmd.FlowTemplateKeys(argv)
+	check := func(key string, op uint) {
+		// The values in env are used in rendering, no matter who provides them
+		if _, ok := env.GetEx(key); ok {
+			return
+		}
+		res, passCheck := self.onKeyOp(key, op, matched, cmd, ignoreMaybe, displayPath)
+		if !passCheck {
+			res.FirstArg2Env = arg2envs.Get(res.Key)
+			result = append(result, res)
+		}
+	}
+	for _, key := range keys {
+		check(key, EnvOpTypeRead)
+	}
+	for _, key := range mayKeys {
+		check(key, EnvOpTypeMayRead)
+	}
+	return
+}
+
+func (self EnvOpsChecker) onKeyOp(
+	key string,
+	curr uint,
+	matched ParsedCmd,
+	cmd *Cmd,
+	ignoreMaybe bool,
+	displayPath string) (res EnvOpsCheckResult, passCheck bool) {
+
+	before, _ := self[key]
+
+	if (curr&EnvOpTypeWrite) == 0 && (curr&EnvOpTypeMayWrite) != 0 {
+		before.mayWriteCmds = append(before.mayWriteCmds, MayWriteCmd{matched, cmd})
+	}
+	before.val = before.val | curr
+	self[key] = before
+
+	res.Key = key
+	res.CmdDisplayPath = displayPath
+	res.Cmd = cmd.Owner()
+	if (before.val&EnvOpTypeWrite) == 0 &&
+		(before.val&EnvOpTypeMayWrite) == 0 {
+		if (before.val & EnvOpTypeRead) != 0 {
+			res.ReadNotExist = true
+		} else if (before.val & EnvOpTypeMayRead) != 0 {
+			res.MayReadNotExist = true
+		}
+	} else if (before.val & EnvOpTypeMayWrite) != 0 {
+		if (before.val & EnvOpTypeRead) != 0 {
+			res.ReadMayWrite = true
+			res.MayWriteCmdsBefore = before.mayWriteCmds
+		} else if (before.val & EnvOpTypeMayRead) != 0 {
+			res.MayReadMayWrite = true
+			res.MayWriteCmdsBefore = before.mayWriteCmds
+		}
+	}
+	if ignoreMaybe {
+		passCheck = !res.ReadNotExist
+	} else {
+		passCheck = !(res.ReadMayWrite || res.MayReadMayWrite ||
+			res.MayReadNotExist || res.ReadNotExist)
+	}
+	return
+}
+
 type envOpsCheckerKeyInfo struct {
 	mayWriteCmds []MayWriteCmd
 	val          uint
@@ -237,9 +278,23 @@ func checkEnvOps(
 
 		displayPath := cmd.DisplayPath(sep, true)
 		cmdEnv, argv := cmd.ApplyMappingGenEnvAndArgv(env, cc.Cmds.Strs.EnvValDelAllMark, cc.Cmds.Strs.PathSep)
-		if last.Type() == CmdTypeFileNFlow {
+
+		// The sub flow can't be rendered if the keys its templates read are missed
+		renderable := true
+		if last.Type() == CmdTypeFlow || last.Type() == CmdTypeFileNFlow {
+			res := checker.OnFlowTemplateReads(cmdEnv, argv, cmd, last, ignoreMaybe, displayPath, arg2envs)
+			*result = append(*result, res...)
+			keys, _ := last.FlowTemplateKeys(argv)
+			for _, key := range keys {
+				if _, ok := cmdEnv.GetEx(key); !ok {
+					renderable = false
+				}
+			}
+		}
+
+		if last.Type() == CmdTypeFileNFlow && renderable {
 			parsedFlow := renderSubFlowOnChecking(last, cc, argv, env, cmdEnv)
-			checkEnvOps(cc, parsedFlow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
+			checkSubFlowEnvOps(cc, last, parsedFlow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
 		}
 
 		res := checker.OnCallCmd(cmdEnv, argv, cmd, sep, last, ignoreMaybe, displayPath, arg2envs)
@@ -248,13 +303,33 @@ func checkEnvOps(
 		TryExeEnvOpCmds(argv, cc, cmdEnv, flow, i, envOpCmds, checker,
 			"failed to execute env-op cmd in env-ops checking")
 
-		if last.Type() != CmdTypeFlow {
+		if last.Type() != CmdTypeFlow || !renderable {
 			continue
 		}
 
 		parsedFlow := renderSubFlowOnChecking(last, cc, argv, env, cmdEnv)
-		checkEnvOps(cc, parsedFlow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
+		checkSubFlowEnvOps(cc, last, parsedFlow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
+	}
+}
+
+func checkSubFlowEnvOps(
+	cc *Cli,
+	cmd *Cmd,
+	flow *ParsedCmds,
+	env *Env,
+	checker *EnvOpsChecker,
+	ignoreMaybe bool,
+	envOpCmds []EnvOpCmd,
+	result *[]EnvOpsCheckResult,
+	arg2envs FirstArg2EnvProviders) {
+
+	if !cmd.IsScoped() {
+		checkEnvOps(cc, flow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
+		return
 	}
+	saved := checker.Clone()
+	checkEnvOps(cc, flow, env, checker, ignoreMaybe, envOpCmds, result, arg2envs)
+	checker.EndScope(saved, cmd.ScopeExports(), cc.Cmds.Strs.EnvPathSep)
 }
 
 // TODO: a bit meeessy
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"strings"
+)
+
+// Save the pairs of a layer when a scoped flow begins, restore them when it finishes.
+// The flow runs on a child session layer, the values of the caller's command layer are put under it,
+// so they are visible in the flow, but not written to the saved layer
+type EnvScope struct {
+	env   *Env
+	saved map[string]EnvVal
+	inner *Env
+}
+
+func (self *Env) BeginScope(cmdEnv *Env) *EnvScope {
+	saved := map[string]EnvVal{}
+	for k, v := range self.pairs {
+		saved[k] = v
+	}
+	inner := self
+	if cmdEnv != nil {
+		inner = self.NewLayer(EnvLayerCmd)
+		for k, v := range cmdEnv.pairs {
+			inner.pairs[k] = v
+		}
+	}
+	inner = inner.NewLayer(EnvLayerSession)
+	return &EnvScope{self, saved, inner}
+}
+
+// The env for the scoped flow, changes in it are discarded except the exported keys
+func (self *EnvScope) Env() *Env {
+	return self.inner
+}
+
+// Discard the changes since the scope began, except the exported keys written in the scope
+func (self *EnvScope) End(exports []string, pathSep string) {
+	env := self.env
+	for k, _ := range env.pairs {
+		if MatchScopeExports(k, exports, pathSep) {
+			continue
+		}
+		if _, ok := self.saved[k]; !ok {
+			env.DeleteInSelfLayer(k)
+		}
+	}
+	for k, v := range self.saved {
+		if MatchScopeExports(k, exports, pathSep) {
+			continue
+		}
+		env.SetEx(k, v.Raw, v.IsArg)
+	}
+	for k, v := range self.inner.pairs {
+		if MatchScopeExports(k, exports, pathSep) {
+			env.SetEx(k, v.Raw, v.IsArg)
+		}
+	}
+}
+
+func (self EnvOpsChecker) Clone() EnvOpsChecker {
+	checker := EnvOpsChecker{}
+	for k, v := range self {
+		checker[k] = v
+	}
+	return checker
+}
+
+// The same as EnvScope.End, the stats of the keys written in a scoped flow are discarded
+func (self *EnvOpsChecker) EndScope(saved EnvOpsChecker, exports []string, pathSep string) {
+	for k, _ := range *self {
+		if MatchScopeExports(k, exports, pathSep) {
+			continue
+		}
+		if _, ok := saved[k]; !ok {
+			delete(*self, k)
+		}
+	}
+	for k, v := range saved {
+		if MatchScopeExports(k, exports, pathSep) {
+			continue
+		}
+		(*self)[k] = v
+	}
+}
+
+// An export could be a key, or a key prefix ends with path-sep, eg: "cluster." exports all keys under "cluster"
+func MatchScopeExports(key string, exports []string, pathSep string) bool {
+	for _, it := range exports {
+		if key == it {
+			return true
+		}
+		if strings.HasSuffix(it, pathSep) && strings.HasPrefix(key, it) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchScopeExports(t *testing.T) {
+	tests := []struct {
+		key      string
+		exports  []string
+		expected bool
+	}{
+		{"a", []string{"a"}, true},
+		{"a", []string{"b", "a"}, true},
+		{"a.b", []string{"a"}, false},
+		{"a.b", []string{"a."}, true},
+		{"a.b.c", []string{"a."}, true},
+		{"a", []string{"a."}, false},
+		{"ab", []string{"a."}, false},
+		{"ab", []string{"a"}, false},
+		{"a", nil, false},
+	}
+	for _, it := range tests {
+		if MatchScopeExports(it.key, it.exports, ".") != it.expected {
+			t.Fatalf("%#v %#v: should be %v\n", it.key, it.exports, it.expected)
+		}
+	}
+}
+
+func TestEnvScopeEnd(t *testing.T) {
+	env := NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+	env.GetLayer(EnvLayerDefault).Set("def", "0")
+	env.Set("kept", "0")
+	env.Set("changed", "0")
+	env.Set("deleted", "0")
+	env.Set("x.changed", "0")
+	env.Set("x.deleted", "0")
+	env.Set("x.by-cmd", "0")
+	env.Set("by-cmd", "0")
+
+	cmdEnv := env.NewLayer(EnvLayerCmd)
+	cmdEnv.Set("x.by-cmd", "1")
+	cmdEnv.Set("x.new-by-cmd", "1")
+	cmdEnv.Set("by-cmd", "1")
+	cmdEnv.Set("x.rewritten", "1")
+
+	scope := env.BeginScope(cmdEnv)
+	inner := scope.Env()
+	if inner.LayerType() != EnvLayerSession || inner.GetLayer(EnvLayerSession) != inner {
+		t.Fatalf("the scoped flow should write to the child session layer\n")
+	}
+	// The values of the command layer are visible in the scope
+	for k, v := range map[string]string{"x.by-cmd": "1", "x.new-by-cmd": "1", "by-cmd": "1", "kept": "0"} {
+		if inner.GetRaw(k) != v {
+			t.Fatalf("%#v: %#v != %#v in the scope\n", k, inner.GetRaw(k), v)
+		}
+	}
+
+	inner.Set("changed", "1")
+	inner.Set("new", "1")
+	inner.Delete("deleted")
+	inner.Set("x.changed", "1")
+	inner.Set("x.new", "1")
+	inner.Delete("x.deleted")
+	inner.Set("x.rewritten", "2")
+	inner.Set("def", "1")
+	scope.End([]string{"x."}, ".")
+
+	expected := map[string]string{
+		"kept":    "0",
+		"changed": "0",
+		"deleted": "0",
+		"by-cmd":  "0",
+		// The exported keys written in the scope
+		"x.changed":   "1",
+		"x.new":       "1",
+		"x.rewritten": "2",
+		// Exported keys, but the values are from the command layer, not written by the flow
+		"x.by-cmd": "0",
+	}
+	vals := map[string]string{}
+	for k, v := range env.pairs {
+		vals[k] = v.Raw
+	}
+	if !reflect.DeepEqual(vals, expected) {
+		t.Fatalf("%#v != %#v\n", vals, expected)
+	}
+	if env.GetRaw("def") != "0" {
+		t.Fatalf("the not exported key of the parent layer should not be changed\n")
+	}
+
+	// Without the command layer
+	env = NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+	env.Set("a", "0")
+	scope = env.BeginScope(nil)
+	if scope.Env().Parent() != env {
+		t.Fatalf("the scope env should be a child of the session layer\n")
+	}
+	scope.Env().Set("a", "1")
+	scope.Env().Set("b", "1")
+	scope.End([]string{"b"}, ".")
+	if env.GetRaw("a") != "0" || env.GetRaw("b") != "1" {
+		t.Fatalf("bad env after the scope: %#v %#v\n", env.GetRaw("a"), env.GetRaw("b"))
+	}
+}
+
+func TestEnvOpsCheckerEndScope(t *testing.T) {
+	info := func(val uint) envOpsCheckerKeyInfo {
+		return envOpsCheckerKeyInfo{nil, val}
+	}
+	checker := EnvOpsChecker{
+		"kept":      info(EnvOpTypeWrite),
+		"changed":   info(EnvOpTypeWrite),
+		"x.changed": info(EnvOpTypeMayWrite),
+	}
+	saved := checker.Clone()
+	checker["changed"] = info(EnvOpTypeMayWrite)
+	checker["new"] = info(EnvOpTypeWrite)
+	checker["x.changed"] = info(EnvOpTypeWrite)
+	checker["x.new"] = info(EnvOpTypeWrite)
+	if reflect.DeepEqual(saved, checker) {
+		t.Fatalf("the cloned checker should not be changed\n")
+	}
+
+	checker.EndScope(saved, []string{"x."}, ".")
+	expected := EnvOpsChecker{
+		"kept":      info(EnvOpTypeWrite),
+		"changed":   info(EnvOpTypeWrite),
+		"x.changed": info(EnvOpTypeWrite),
+		"x.new":     info(EnvOpTypeWrite),
+	}
+	if !reflect.DeepEqual(checker, expected) {
+		t.Fatalf("%#v != %#v\n", checker, expected)
+	}
+
+	// Exported keys removed in the scope are not restored
+	checker = EnvOpsChecker{"x.a": info(EnvOpTypeWrite), "b": info(EnvOpTypeWrite)}
+	saved = checker.Clone()
+	delete(checker, "x.a")
+	delete(checker, "b")
+	checker.EndScope(saved, []string{"x."}, ".")
+	if !reflect.DeepEqual(checker, EnvOpsChecker{"b": info(EnvOpTypeWrite)}) {
+		t.Fatalf("bad checker after the scope: %#v\n", checker)
+	}
+}
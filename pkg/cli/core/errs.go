@@ -157,6 +157,20 @@ func (self CmdMissedArgValWhenRenderFlow) Error() string {
 	return self.Str
 }
 
+type CmdBadTemplateExprWhenRenderFlow struct {
+	Str           string
+	CmdPath       string
+	MetaFilePath  string
+	Source        string
+	RenderingLine string
+	Expr          string
+	Cmd           *Cmd
+}
+
+func (self CmdBadTemplateExprWhenRenderFlow) Error() string {
+	return self.Str
+}
+
 type RunCmdFileFailed struct {
 	Err         string
 	Cmd         ParsedCmd
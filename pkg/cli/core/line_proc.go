@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// How long to wait for a helper(or a worker) to exit after its input is closed, then it will be killed
+const helperExitTimeout = 3 * time.Second
+
+// A long-running process which receives a line and answers a line each time,
+// the base of rpc helpers and workers
+type lineProc struct {
+	// For messages, eg: "rpc helper", "worker"
+	kind   string
+	path   string
+	cmd    *exec.Cmd
+	input  io.WriteCloser
+	output *os.File
+	reader *bufio.Reader
+	exited bool
+	done   chan struct{}
+}
+
+// The process should be started, the output is not closed on exiting,
+// so the answer is not lost if the process exits right after it
+func newLineProc(kind string, path string, cmd *exec.Cmd, input io.WriteCloser, output *os.File) *lineProc {
+	proc := &lineProc{
+		kind:   kind,
+		path:   path,
+		cmd:    cmd,
+		input:  input,
+		output: output,
+		reader: bufio.NewReader(output),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(proc.done)
+	}()
+	return proc
+}
+
+// An exited process could be found without calling it, it may die between calls
+func (self *lineProc) running() bool {
+	select {
+	case <-self.done:
+		return false
+	default:
+		return !self.exited
+	}
+}
+
+// Send a line and read the answer, the process is killed if it's not answered in time,
+// no timeout if 'timeout' is zero. The process is broken and can't be used any more if it fails
+func (self *lineProc) exchange(data []byte, timeout time.Duration) ([]byte, error) {
+	type answer struct {
+		line []byte
+		err  error
+	}
+	answered := make(chan answer, 1)
+	go func() {
+		_, err := self.input.Write(append(data, '\n'))
+		if err != nil {
+			answered <- answer{nil, fmt.Errorf("send to %s '%s' failed: %v", self.kind, self.path, err)}
+			return
+		}
+		line, err := self.reader.ReadBytes('\n')
+		if err != nil {
+			err = fmt.Errorf("read from %s '%s' failed: %v", self.kind, self.path, err)
+		}
+		answered <- answer{line, err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	select {
+	case it := <-answered:
+		if it.err != nil {
+			self.exited = true
+		}
+		return it.line, it.err
+	case <-expired:
+		self.exited = true
+		self.input.Close()
+		waitOrKill(self.cmd, self.done, 0)
+		self.output.Close()
+		return nil, fmt.Errorf("%s '%s' is not answered in %v, it's killed", self.kind, self.path, timeout)
+	}
+}
+
+// The answers are out of step, eg: a bad answer or a wrong id, the next call should restart the process
+func (self *lineProc) outOfStep(format string, a ...interface{}) error {
+	self.exited = true
+	return fmt.Errorf(format, a...)
+}
+
+// The process should exit when its input is closed, or it will be killed
+func (self *lineProc) close() {
+	self.input.Close()
+	waitOrKill(self.cmd, self.done, helperExitTimeout)
+	self.output.Close()
+	self.exited = true
+}
+
+// Wait for the process to exit, kill it if it's not exited in time
+func waitOrKill(cmd *exec.Cmd, done chan struct{}, timeout time.Duration) {
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	cmd.Process.Kill()
+	<-done
+}
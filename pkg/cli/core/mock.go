@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// In mock mode ("sys.mock" = true), the executable-file commands will not be executed,
+// the keys declared by their 'write' env-ops will be set with recorded values, or placeholders.
+// The values written by real executions will be recorded if "sys.mock.record" = true,
+// one file for each command in dir "sys.paths.mocks".
+
+func (self *Cmd) executeMock(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCmd) bool {
+	if len(self.cmdLine) == 0 {
+		return true
+	}
+
+	sep := cc.Cmds.Strs.EnvKeyValSep
+	recorded := NewEnv().NewLayer(EnvLayerSession)
+	path := self.mockRecordPath(cc, env)
+	if len(path) != 0 {
+		LoadEnvFromFile(recorded, path, sep)
+	}
+
+	placeholder := env.GetRaw("sys.mock.placeholder")
+	session := env.GetLayer(EnvLayerSession)
+
+	keys, origins, _ := self.envOps.RenderedEnvKeys(argv, env, self, true)
+	for i, key := range keys {
+		write, mayWrite := false, false
+		for _, op := range self.envOps.Ops(origins[i]) {
+			write = write || (op&EnvOpTypeWrite) != 0
+			mayWrite = mayWrite || (op&EnvOpTypeMayWrite) != 0
+		}
+		if !write && !mayWrite {
+			continue
+		}
+		val, ok := recorded.GetEx(key)
+		if ok {
+			session.Set(key, val.Raw)
+		} else if !write {
+			continue
+		} else if _, exists := env.GetEx(key); !exists {
+			session.Set(key, placeholder)
+		}
+		cc.Screen.Print(fmt.Sprintf("(mock) %s = %s\n", key, env.GetRaw(key)))
+	}
+	return true
+}
+
+func (self *Cmd) recordMockValues(argv ArgVals, cc *Cli, env *Env) {
+	path := self.mockRecordPath(cc, env)
+	if len(path) == 0 {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		panic(fmt.Errorf("[recordMockValues] create mock records dir failed: %v", err))
+	}
+	sep := cc.Cmds.Strs.EnvKeyValSep
+	recorded := NewEnv().NewLayer(EnvLayerSession)
+	LoadEnvFromFile(recorded, path, sep)
+
+	keys, origins, _ := self.envOps.RenderedEnvKeys(argv, env, self, true)
+	for i, key := range keys {
+		for _, op := range self.envOps.Ops(origins[i]) {
+			if (op & (EnvOpTypeWrite | EnvOpTypeMayWrite)) == 0 {
+				continue
+			}
+			val, ok := env.GetEx(key)
+			if ok {
+				recorded.Set(key, val.Raw)
+			}
+			break
+		}
+	}
+	SaveEnvToFile(recorded, path, sep)
+}
+
+func (self *Cmd) mockRecordPath(cc *Cli, env *Env) string {
+	dir := env.GetRaw("sys.paths.mocks")
+	if len(dir) == 0 {
+		return ""
+	}
+	return filepath.Join(dir, self.owner.DisplayPath())
+}
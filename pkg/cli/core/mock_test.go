@@ -0,0 +1,77 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMockRecordAndExecute(t *testing.T) {
+	dir := t.TempDir()
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	cmd := tree.AddSub("x").AddSub("y").RegFileCmd(filepath.Join(dir, "not-executed.sh"), "mocked cmd").
+		AddEnvOp("x.out", EnvOpTypeWrite).
+		AddEnvOp("x.maybe", EnvOpTypeMayWrite).
+		AddEnvOp("x.in", EnvOpTypeRead).
+		AddEnvOp("x.kept", EnvOpTypeWrite)
+
+	newEnv := func() *Env {
+		env := NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+		def := env.GetLayer(EnvLayerDefault)
+		def.Set("sys.paths.mocks", filepath.Join(dir, "mocks"))
+		def.Set("sys.mock.placeholder", "mocked")
+		return env
+	}
+	check := func(step string, env *Env, expected map[string]string) {
+		for k, v := range expected {
+			val, ok := env.GetEx(k)
+			if len(v) == 0 && ok {
+				t.Fatalf("%s: %#v should not be set, but it's %#v\n", step, k, val.Raw)
+			}
+			if len(v) != 0 && val.Raw != v {
+				t.Fatalf("%s: %#v: %#v != %#v\n", step, k, val.Raw, v)
+			}
+		}
+	}
+
+	// No records, the placeholders are set for the write ops, the existing values are kept
+	env := newEnv()
+	env.GetLayer(EnvLayerSession).Set("x.kept", "old")
+	cc := NewCli(env, &QuietScreen{}, tree, nil, nil)
+	cmd.executeMock(ArgVals{}, cc, env, ParsedCmd{})
+	check("placeholders", env, map[string]string{
+		"x.out":   "mocked",
+		"x.maybe": "",
+		"x.in":    "",
+		"x.kept":  "old",
+	})
+
+	// Only the written keys are recorded
+	env = newEnv()
+	session := env.GetLayer(EnvLayerSession)
+	session.Set("x.out", "real")
+	session.Set("x.maybe", "m")
+	session.Set("x.in", "input")
+	cc = NewCli(env, &QuietScreen{}, tree, nil, nil)
+	cmd.recordMockValues(ArgVals{}, cc, env)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mocks", "x.y"))
+	if err != nil {
+		t.Fatalf("read mock records failed: %v\n", err)
+	}
+	if strings.Contains(string(data), "x.in") || !strings.Contains(string(data), "x.out") {
+		t.Fatalf("bad mock records:\n%s\n", data)
+	}
+
+	// The recorded values are fed back
+	env = newEnv()
+	env.GetLayer(EnvLayerSession).Set("x.kept", "old")
+	cc = NewCli(env, &QuietScreen{}, tree, nil, nil)
+	cmd.executeMock(ArgVals{}, cc, env, ParsedCmd{})
+	check("recorded", env, map[string]string{
+		"x.out":   "real",
+		"x.maybe": "m",
+		"x.in":    "",
+		"x.kept":  "old",
+	})
+}
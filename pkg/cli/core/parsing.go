@@ -60,6 +60,9 @@ func (self *ParsedCmds) RemoveLeadingCmds(count int) {
 type ParseResult struct {
 	Input []string
 	Error error
+	// The error position in the joined input (by space), -1 if unknown
+	ErrCol int
+	ErrLen int
 }
 
 type ParsedCmd struct {
@@ -67,6 +70,8 @@ type ParsedCmd struct {
 	ParseResult ParseResult
 	TrivialLvl  int
 	TailMode    bool
+	// The command the user typed if it's redirected to this one
+	RedirectFrom *CmdTree
 }
 
 func (self ParsedCmd) IsEmpty() bool {
@@ -377,6 +382,24 @@ func (self ParseErrExpectNoArg) Error() string {
 	return self.Origin.Error()
 }
 
+type ParseErrTokenize struct {
+	Origin error
+}
+
+func (self ParseErrTokenize) Error() string {
+	return self.Origin.Error()
+}
+
+// The redirect target of a renamed command is not found
+type ParseErrRedirect struct {
+	Origin error
+	Cmd    *CmdTree
+}
+
+func (self ParseErrRedirect) Error() string {
+	return self.Origin.Error()
+}
+
 type ParseErrEnv struct {
 	Origin error
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,18 @@ import (
 )
 
 func EnvOutput(env *Env, writer io.Writer, sep string) error {
+	keys := envOutputKeys(env, "", false)
+	for _, k := range keys {
+		v := env.GetRaw(k)
+		_, err := fmt.Fprintf(writer, "%s%s%s\n", k, sep, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envOutputKeys(env *Env, prefix string, filterArgs bool) (keys []string) {
 	// TODO: move to default config
 	filtered := []string{
 		"session",
@@ -21,20 +34,87 @@ func EnvOutput(env *Env, writer io.Writer, sep string) error {
 	}
 
 	defEnv := env.GetLayer(EnvLayerDefault)
+	sep := env.GetRaw("strs.env-path-sep")
 
-	flatten := env.Flatten(true, filtered, false)
-	var keys []string
+	flatten := env.Flatten(true, filtered, filterArgs)
 	for k, v := range flatten {
 		if defEnv.GetRaw(k) == v {
 			continue
 		}
+		if !matchEnvKeyPrefix(k, prefix, sep) {
+			continue
+		}
 		keys = append(keys, k)
 	}
 
 	sort.Strings(keys)
+	return
+}
+
+// Match by path segments: prefix "mysql" matches "mysql" and "mysql.port", but not "mysqlx.port"
+func matchEnvKeyPrefix(key string, prefix string, sep string) bool {
+	if len(prefix) == 0 || key == prefix {
+		return true
+	}
+	if len(sep) == 0 {
+		sep = "."
+	}
+	if !strings.HasSuffix(prefix, sep) {
+		prefix += sep
+	}
+	return strings.HasPrefix(key, prefix)
+}
+
+// The key-values in the session file which executable-file commands receive
+func SessionFileVals(env *Env) map[string]string {
+	vals := map[string]string{}
+	for _, k := range envOutputKeys(env, "", false) {
+		vals[k] = env.GetRaw(k)
+	}
+	return vals
+}
+
+// Export env in formats could be used by other tools: "sh", "dotenv", "json"
+func EnvExport(env *Env, writer io.Writer, format string, prefix string) error {
+	keys := envOutputKeys(env, prefix, true)
+
+	if format == "json" {
+		vals := map[string]string{}
+		for _, k := range keys {
+			vals[k] = env.GetRaw(k)
+		}
+		// Keep values like "a&b" as they are, the output is not for html
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(vals)
+	}
+
+	var lineFmt string
+	var quote func(string) string
+	switch format {
+	case "sh", "shell", "bash":
+		lineFmt = "export %s=%s\n"
+		quote = QuoteShellVal
+	case "dotenv", ".env":
+		lineFmt = "%s=%s\n"
+		quote = quoteDotEnvVal
+	default:
+		return fmt.Errorf("[EnvExport] unknown format '%s'", format)
+	}
+
+	// Different keys may map to the same name, eg: "a.b" and "a-b", one will overwrite the other
+	names := map[string]string{}
 	for _, k := range keys {
-		v := env.GetRaw(k)
-		_, err := fmt.Fprintf(writer, "%s%s%s\n", k, sep, v)
+		name := EnvKeyToShellName(k)
+		if old, ok := names[name]; ok {
+			return fmt.Errorf("[EnvExport] env keys '%s' and '%s' are both exported as '%s'", old, k, name)
+		}
+		names[name] = k
+	}
+
+	for _, k := range keys {
+		_, err := fmt.Fprintf(writer, lineFmt, EnvKeyToShellName(k), quote(env.GetRaw(k)))
 		if err != nil {
 			return err
 		}
@@ -42,6 +122,60 @@ func EnvOutput(env *Env, writer io.Writer, sep string) error {
 	return nil
 }
 
+// Map an env key to a valid shell identifier: "mysql.port" => "MYSQL_PORT"
+func EnvKeyToShellName(key string) string {
+	var name []byte
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'a' && c <= 'z' {
+			c = c - 'a' + 'A'
+		} else if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			c = '_'
+		}
+		name = append(name, c)
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		name = append([]byte{'_'}, name...)
+	}
+	return string(name)
+}
+
+func isShellSafeStr(val string) bool {
+	if len(val) == 0 {
+		return false
+	}
+	for _, c := range val {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if strings.ContainsRune("_-.,:/@%+=", c) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func QuoteShellVal(val string) string {
+	if isShellSafeStr(val) {
+		return val
+	}
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+func quoteDotEnvVal(val string) string {
+	if isShellSafeStr(val) {
+		return val
+	}
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", `\$`,
+		"`", "\\`",
+		"\n", `\n`)
+	return `"` + replacer.Replace(val) + `"`
+}
+
 func EnvInput(env *Env, reader io.Reader, sep string) error {
 	scanner := bufio.NewScanner(reader)
 	scanner.Split(bufio.ScanLines)
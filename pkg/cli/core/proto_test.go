@@ -0,0 +1,111 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestQuoteShellVal(t *testing.T) {
+	test := func(val string, quoted string) {
+		if QuoteShellVal(val) != quoted {
+			t.Fatalf("%#v: quoted %#v != %#v\n", val, QuoteShellVal(val), quoted)
+		}
+	}
+
+	test("abc", "abc")
+	test("127.0.0.1:4000", "127.0.0.1:4000")
+	test("a=b,c/d@e%f+g-h_i", "a=b,c/d@e%f+g-h_i")
+	test("", "''")
+	test("a b", "'a b'")
+	test("it's", `'it'\''s'`)
+	test("$HOME", "'$HOME'")
+	test("`ls`", "'`ls`'")
+	test(`a"b`, `'a"b'`)
+	test("a\nb", "'a\nb'")
+}
+
+func TestQuoteDotEnvVal(t *testing.T) {
+	test := func(val string, quoted string) {
+		if quoteDotEnvVal(val) != quoted {
+			t.Fatalf("%#v: quoted %#v != %#v\n", val, quoteDotEnvVal(val), quoted)
+		}
+	}
+
+	test("abc", "abc")
+	test("", `""`)
+	test("a b", `"a b"`)
+	test(`a"b`, `"a\"b"`)
+	test(`a\b`, `"a\\b"`)
+	test("$HOME", `"\$HOME"`)
+	test("`ls`", "\"\\`ls\\`\"")
+	test("a\nb", `"a\nb"`)
+	test("it's", `"it's"`)
+}
+
+func TestEnvKeyToShellName(t *testing.T) {
+	test := func(key string, name string) {
+		if EnvKeyToShellName(key) != name {
+			t.Fatalf("%#v: name %#v != %#v\n", key, EnvKeyToShellName(key), name)
+		}
+	}
+
+	test("mysql.port", "MYSQL_PORT")
+	test("a-b.c", "A_B_C")
+	test("1st", "_1ST")
+	test("", "_")
+}
+
+func TestMatchEnvKeyPrefix(t *testing.T) {
+	test := func(key string, prefix string, matched bool) {
+		if matchEnvKeyPrefix(key, prefix, ".") != matched {
+			t.Fatalf("%#v %#v: matched %v != %v\n", key, prefix, !matched, matched)
+		}
+	}
+
+	test("mysql.port", "", true)
+	test("mysql.port", "mysql", true)
+	test("mysql.port", "mysql.", true)
+	test("mysql", "mysql", true)
+	test("mysqlx.port", "mysql", false)
+	test("mysql.port", "mysql.po", false)
+	test("mysql.port", "mysql.port", true)
+}
+
+func TestEnvExport(t *testing.T) {
+	newEnv := func(kvs ...string) *Env {
+		env := NewEnv().NewLayer(EnvLayerSession)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			env.Set(kvs[i], kvs[i+1])
+		}
+		return env
+	}
+
+	test := func(env *Env, format string, prefix string, output string) {
+		buf := bytes.NewBuffer(nil)
+		err := EnvExport(env, buf, format, prefix)
+		if err != nil {
+			t.Fatalf("%v %v: unexpected error: %v\n", format, prefix, err)
+		}
+		if buf.String() != output {
+			t.Fatalf("%v %v: output %#v != %#v\n", format, prefix, buf.String(), output)
+		}
+	}
+
+	testErr := func(env *Env, format string) {
+		err := EnvExport(env, bytes.NewBuffer(nil), format, "")
+		if err == nil {
+			t.Fatalf("%v: expect error\n", format)
+		}
+	}
+
+	env := newEnv("mysql.port", "3306", "mysqlx.port", "33060", "mysql.pwd", "a b")
+	test(env, "sh", "mysql", "export MYSQL_PORT=3306\nexport MYSQL_PWD='a b'\n")
+	test(env, "dotenv", "mysql.", "MYSQL_PORT=3306\nMYSQL_PWD=\"a b\"\n")
+	test(env, "sh", "mysqlx", "export MYSQLX_PORT=33060\n")
+
+	testErr(newEnv("a.b", "1", "a-b", "2"), "sh")
+	testErr(newEnv("a.b", "1", "a-b", "2"), "dotenv")
+	testErr(newEnv("a", "1"), "xml")
+	test(newEnv("a.b", "1", "a-b", "2"), "json", "", "{\n    \"a-b\": \"2\",\n    \"a.b\": \"1\"\n}\n")
+	test(newEnv("a", "x&y<z>"), "json", "", "{\n    \"a\": \"x&y<z>\"\n}\n")
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A replay bundle is a dir, each execution of an executable-file(or rpc) command is recorded as a sub dir:
+//   <bundle>/<step-index>/info      : command path, bin, args, exit code and error, in json
+//   <bundle>/<step-index>/env-in    : the session env before executing
+//   <bundle>/<step-index>/env-out   : the env key-values written by the command
+//   <bundle>/<step-index>/stdout
+//   <bundle>/<step-index>/stderr
+// In record mode ("sys.replay.record-to" = <bundle>) the executions are recorded,
+// in replay mode ("sys.replay.from" = <bundle>) the recorded results are used instead of executing.
+
+const (
+	ReplayStepInfoFile   = "info"
+	ReplayStepEnvInFile  = "env-in"
+	ReplayStepEnvOutFile = "env-out"
+	ReplayStepStdoutFile = "stdout"
+	ReplayStepStderrFile = "stderr"
+
+	replayCursorKey    = "sys.replay.cursor"
+	replayRecordIdxKey = "sys.replay.record-idx"
+)
+
+type ReplayStep struct {
+	Dir        string   `json:"-"`
+	CmdPath    string   `json:"cmd"`
+	Bin        string   `json:"bin"`
+	Args       []string `json:"args"`
+	ExitCode   int      `json:"exit-code"`
+	Err        string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration-ms"`
+}
+
+func ReplayStepDirs(bundle string) (dirs []string, err error) {
+	files, err := ioutil.ReadDir(bundle)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read replay bundle '%s' failed: %v", bundle, err)
+	}
+	var indexes []int
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		idx, err := strconv.Atoi(file.Name())
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		dirs = append(dirs, filepath.Join(bundle, replayStepDirName(idx)))
+	}
+	return
+}
+
+func LoadReplayStep(dir string) (step ReplayStep, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ReplayStepInfoFile))
+	if err != nil {
+		return step, fmt.Errorf("read replay step '%s' failed: %v", dir, err)
+	}
+	err = json.Unmarshal(data, &step)
+	if err != nil {
+		return step, fmt.Errorf("parse replay step '%s' failed: %v", dir, err)
+	}
+	step.Dir = dir
+	return step, nil
+}
+
+func replayStepDirName(idx int) string {
+	return fmt.Sprintf("%04d", idx)
+}
+
+// Pick the step index for the next recording, the bundle is checked when the recording starts,
+// then the index is kept in the session env, so the bundle dir doesn't need to be scanned on each step
+func nextReplayRecordIdx(env *Env, bundle string) int {
+	idx := 0
+	if len(env.GetRaw(replayRecordIdxKey)) != 0 {
+		idx = env.GetInt(replayRecordIdxKey)
+	} else {
+		dirs, err := ReplayStepDirs(bundle)
+		if err != nil {
+			panic(err)
+		}
+		if len(dirs) != 0 {
+			panic(fmt.Errorf("[replayRecorder] replay bundle '%s' already has %d recorded steps, "+
+				"remove it or record to another dir", bundle, len(dirs)))
+		}
+	}
+	env.GetLayer(EnvLayerSession).SetInt(replayRecordIdxKey, idx+1)
+	return idx
+}
+
+type replayRecorder struct {
+	step   ReplayStep
+	stdout *os.File
+	stderr *os.File
+	envIn  *Env
+	start  time.Time
+	kvSep  string
+}
+
+func newReplayRecorder(
+	bundle string,
+	idx int,
+	cmdPath string,
+	bin string,
+	args []string,
+	env *Env,
+	kvSep string) *replayRecorder {
+
+	dir := filepath.Join(bundle, replayStepDirName(idx))
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		panic(fmt.Errorf("[replayRecorder] create replay step dir '%s' failed: %v", dir, err))
+	}
+
+	envIn := env.GetLayer(EnvLayerSession).Clone()
+	SaveEnvToFile(envIn, filepath.Join(dir, ReplayStepEnvInFile), kvSep)
+
+	create := func(name string) *os.File {
+		path := filepath.Join(dir, name)
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			panic(fmt.Errorf("[replayRecorder] open '%s' failed: %v", path, err))
+		}
+		return file
+	}
+
+	return &replayRecorder{
+		ReplayStep{dir, cmdPath, bin, args, 0, "", 0},
+		create(ReplayStepStdoutFile),
+		create(ReplayStepStderrFile),
+		envIn,
+		time.Now(),
+		kvSep,
+	}
+}
+
+func (self *replayRecorder) Stdout() io.Writer {
+	return io.MultiWriter(os.Stdout, self.stdout)
+}
+
+func (self *replayRecorder) Stderr() io.Writer {
+	return io.MultiWriter(os.Stderr, self.stderr)
+}
+
+// Only the key-values written by the command are saved, so replaying them won't bring in irrelevant env
+func (self *replayRecorder) Finish(runErr error, sessionPath string) {
+	envOut := NewEnv().NewLayer(EnvLayerSession)
+	LoadEnvFromFile(envOut, sessionPath, self.kvSep)
+	self.FinishWithEnv(runErr, envOut)
+}
+
+func (self *replayRecorder) FinishWithEnv(runErr error, envOut *Env) {
+	self.stdout.Close()
+	self.stderr.Close()
+
+	self.step.DurationMs = time.Since(self.start).Milliseconds()
+	if runErr != nil {
+		self.step.Err = runErr.Error()
+		self.step.ExitCode = -1
+		if exitErr, ok := runErr.(*exec.ExitError); ok {
+			self.step.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	written := NewEnv().NewLayer(EnvLayerSession)
+	keys, vals := envOut.Pairs()
+	for i, key := range keys {
+		old, ok := self.envIn.GetEx(key)
+		if !ok || old.Raw != vals[i].Raw {
+			written.Set(key, vals[i].Raw)
+		}
+	}
+	SaveEnvToFile(written, filepath.Join(self.step.Dir, ReplayStepEnvOutFile), self.kvSep)
+
+	data, err := json.MarshalIndent(self.step, "", "    ")
+	if err != nil {
+		panic(fmt.Errorf("[replayRecorder] marshal replay step info failed: %v", err))
+	}
+	path := filepath.Join(self.step.Dir, ReplayStepInfoFile)
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		panic(fmt.Errorf("[replayRecorder] write replay step info '%s' failed: %v", path, err))
+	}
+}
+
+// Feed the recorded result of the next step, the steps are matched by the executing order
+func (self *Cmd) executeReplay(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCmd, bundle string) bool {
+	session := env.GetLayer(EnvLayerSession)
+	cursor := 0
+	if len(env.GetRaw(replayCursorKey)) != 0 {
+		cursor = env.GetInt(replayCursorKey)
+	}
+
+	dirs, err := ReplayStepDirs(bundle)
+	if err != nil {
+		panic(NewCmdError(parsedCmd, err.Error()))
+	}
+	if cursor >= len(dirs) {
+		panic(NewCmdError(parsedCmd, fmt.Sprintf("no more recorded steps in replay bundle '%s', %d steps replayed",
+			bundle, len(dirs))))
+	}
+	step, err := LoadReplayStep(dirs[cursor])
+	if err != nil {
+		panic(NewCmdError(parsedCmd, err.Error()))
+	}
+	cmdPath := self.owner.DisplayPath()
+	if step.CmdPath != cmdPath {
+		panic(NewCmdError(parsedCmd, fmt.Sprintf("replay step '%s' is command '%s', not match '%s'",
+			step.Dir, step.CmdPath, cmdPath)))
+	}
+	session.SetInt(replayCursorKey, cursor+1)
+
+	copyFile := func(name string, w io.Writer) {
+		data, err := ioutil.ReadFile(filepath.Join(step.Dir, name))
+		if err == nil {
+			w.Write(data)
+		}
+	}
+	copyFile(ReplayStepStdoutFile, os.Stdout)
+	copyFile(ReplayStepStderrFile, os.Stderr)
+
+	if len(step.Err) != 0 {
+		panic(RunCmdFileFailed{
+			"(replay) " + step.Err,
+			parsedCmd,
+			argv,
+			step.Bin,
+			filepath.Join(step.Dir, ReplayStepEnvInFile),
+		})
+	}
+
+	LoadEnvFromFile(session, filepath.Join(step.Dir, ReplayStepEnvOutFile), cc.Cmds.Strs.EnvKeyValSep)
+	return true
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestNextReplayRecordIdx(t *testing.T) {
+	bundle, err := ioutil.TempDir("", "ticat-replay-test")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %v\n", err)
+	}
+	defer os.RemoveAll(bundle)
+
+	env := NewEnv().NewLayer(EnvLayerSession)
+	for i := 0; i < 3; i++ {
+		idx := nextReplayRecordIdx(env, bundle)
+		if idx != i {
+			t.Fatalf("step index %#v != %#v\n", idx, i)
+		}
+		os.MkdirAll(filepath.Join(bundle, replayStepDirName(idx)), os.ModePerm)
+	}
+
+	refused := func() (refused bool) {
+		defer func() {
+			refused = recover() != nil
+		}()
+		nextReplayRecordIdx(NewEnv().NewLayer(EnvLayerSession), bundle)
+		return
+	}
+	if !refused() {
+		t.Fatalf("recording into a non-empty bundle should be refused\n")
+	}
+}
+
+func TestRecordRpcArgs(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper.sh")
+	script := `while read line; do
+	id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+	echo "{\"jsonrpc\": \"2.0\", \"id\": $id, \"result\": {}}"
+done`
+	err := ioutil.WriteFile(helper, []byte(script), 0644)
+	if err != nil {
+		t.Fatalf("write rpc helper failed: %v\n", err)
+	}
+
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	cmd := tree.AddSub("rpc").RegRpcCmd(helper, "run", "rpc for test").AddArg("msg", "")
+
+	bundle := filepath.Join(dir, "bundle")
+	env := NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+	env.GetLayer(EnvLayerDefault).SetInt("sys.rpc.timeout-sec", 60)
+	env.GetLayer(EnvLayerSession).Set("sys.replay.record-to", bundle)
+	cc := NewCli(env, &QuietScreen{}, tree, nil, nil)
+	defer cc.RpcHelpers.Close()
+
+	msgs := []string{"first", "second"}
+	for _, msg := range msgs {
+		cmd.executeRpc(ArgVals{"msg": ArgVal{msg, true, 0}}, cc, env, ParsedCmd{})
+	}
+
+	dirs, err := ReplayStepDirs(bundle)
+	if err != nil || len(dirs) != len(msgs) {
+		t.Fatalf("recorded steps %#v should be %d: %v\n", dirs, len(msgs), err)
+	}
+	for i, msg := range msgs {
+		step, err := LoadReplayStep(dirs[i])
+		if err != nil {
+			t.Fatalf("load recorded step failed: %v\n", err)
+		}
+		if len(step.Args) == 0 || step.Args[len(step.Args)-1] != msg {
+			t.Fatalf("recorded args %#v should end with the arg value %#v\n", step.Args, msg)
+		}
+	}
+}
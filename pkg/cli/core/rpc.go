@@ -0,0 +1,242 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A rpc helper is a long-running process, it's started by the first call in a session,
+// then it serves the calls of all commands declared with it, by json-rpc 2.0 over stdio, one json each line:
+//   request : {"jsonrpc": "2.0", "id": 1, "method": "<method>", "params": {"cmd": "<cmd-path>", "args": {...}, "env": {...}}}
+//   response: {"jsonrpc": "2.0", "id": 1, "result": {"env": {...}, "output": "..."}}
+//             {"jsonrpc": "2.0", "id": 1, "error": {"code": 1, "message": "..."}}
+// The key-values in "env" of the result will be written to the session env.
+// The stdout of the helper is used for rpc, so it should print logs to stderr.
+// In record mode the calls are recorded as steps the same as executable-file commands,
+// so they could be fed back in replay mode.
+// A call not responded in "sys.rpc.timeout-sec" (0 means no limit) fails, the helper is killed.
+
+type RpcParams struct {
+	Cmd  string            `json:"cmd"`
+	Args map[string]string `json:"args"`
+	Env  map[string]string `json:"env"`
+}
+
+type RpcResult struct {
+	Env    map[string]string `json:"env"`
+	Output string            `json:"output"`
+}
+
+type rpcRequest struct {
+	JsonRpc string      `json:"jsonrpc"`
+	Id      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// The helpers of a session, one process for each helper executable
+type RpcHelpers struct {
+	lock    sync.Mutex
+	helpers map[string]*rpcHelper
+}
+
+func NewRpcHelpers() *RpcHelpers {
+	return &RpcHelpers{helpers: map[string]*rpcHelper{}}
+}
+
+func (self *RpcHelpers) Get(path string, bin string, args []string) (*rpcHelper, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	helper, ok := self.helpers[path]
+	if ok && helper.running() {
+		return helper, nil
+	}
+	if ok {
+		// Reap the broken one, kill it if it's still running
+		helper.Close()
+	}
+	helper, err := startRpcHelper(path, bin, args)
+	if err != nil {
+		return nil, err
+	}
+	self.helpers[path] = helper
+	return helper, nil
+}
+
+// The helpers will exit when their stdin are closed
+func (self *RpcHelpers) Close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for path, helper := range self.helpers {
+		helper.Close()
+		delete(self.helpers, path)
+	}
+}
+
+type rpcHelper struct {
+	*lineProc
+	lock   sync.Mutex
+	nextId int
+}
+
+func startRpcHelper(path string, bin string, args []string) (*rpcHelper, error) {
+	cmd := exec.Command(bin, append(args, path)...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create stdin pipe for rpc helper '%s' failed: %v", path, err)
+	}
+	// Not using StdoutPipe, it's closed by Wait, the response may be lost if the helper exits right after it
+	stdout, output, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create stdout pipe for rpc helper '%s' failed: %v", path, err)
+	}
+	cmd.Stdout = output
+	err = cmd.Start()
+	output.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, fmt.Errorf("start rpc helper '%s' failed: %v", path, err)
+	}
+	return &rpcHelper{lineProc: newLineProc("rpc helper", path, cmd, stdin, stdout)}, nil
+}
+
+// The helper is killed if it's not responded in time, no timeout if 'timeout' is zero
+func (self *rpcHelper) Call(method string, params interface{}, result interface{}, timeout time.Duration) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.nextId += 1
+	data, err := json.Marshal(rpcRequest{"2.0", self.nextId, method, params})
+	if err != nil {
+		return fmt.Errorf("marshal rpc request failed: %v", err)
+	}
+	line, err := self.exchange(data, timeout)
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	err = json.Unmarshal(line, &resp)
+	if err != nil {
+		return self.outOfStep("bad rpc response from helper '%s': %v, response: %s",
+			self.path, err, strings.TrimSpace(string(line)))
+	}
+	if resp.Id != self.nextId {
+		return self.outOfStep("rpc response id %d from helper '%s' not match request id %d",
+			resp.Id, self.path, self.nextId)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s (code %d)", resp.Error.Message, resp.Error.Code)
+	}
+	if result != nil && len(resp.Result) != 0 {
+		err = json.Unmarshal(resp.Result, result)
+		if err != nil {
+			return fmt.Errorf("bad rpc result from helper '%s': %v", self.path, err)
+		}
+	}
+	return nil
+}
+
+func (self *rpcHelper) Close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.close()
+}
+
+func (self *Cmd) executeRpc(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCmd) bool {
+	replayFrom := env.GetRaw("sys.replay.from")
+	if len(replayFrom) != 0 {
+		return self.executeReplay(argv, cc, env, parsedCmd, replayFrom)
+	}
+	if env.GetBool("sys.mock") {
+		return self.executeMock(argv, cc, env, parsedCmd)
+	}
+
+	for _, dep := range self.depends {
+		_, err := exec.LookPath(dep.OsCmd)
+		if err != nil {
+			panic(NewCmdError(parsedCmd,
+				fmt.Sprintf("[Cmd.executeRpc] %s", err)))
+		}
+	}
+
+	bin, args := extRunner(env, self.cmdLine)
+
+	var recorder *replayRecorder
+	recordTo := env.GetRaw("sys.replay.record-to")
+	if len(recordTo) != 0 {
+		idx := nextReplayRecordIdx(env, recordTo)
+		recordArgs := append(append([]string{}, args...), self.cmdLine, self.rpcMethod)
+		for _, k := range self.args.Names() {
+			recordArgs = append(recordArgs, argv[k].Raw)
+		}
+		recorder = newReplayRecorder(recordTo, idx, self.owner.DisplayPath(), bin, recordArgs, env,
+			cc.Cmds.Strs.EnvKeyValSep)
+	}
+
+	helper, err := cc.RpcHelpers.Get(self.cmdLine, bin, args)
+	if err != nil {
+		panic(NewCmdError(parsedCmd, err.Error()))
+	}
+
+	session := env.GetLayer(EnvLayerSession)
+	params := RpcParams{self.owner.DisplayPath(), map[string]string{}, map[string]string{}}
+	for _, k := range self.args.Names() {
+		params.Args[k] = argv[k].Raw
+	}
+	for _, k := range envOutputKeys(session, "", false) {
+		params.Env[k] = session.GetRaw(k)
+	}
+
+	var result RpcResult
+	timeout := time.Duration(env.GetInt("sys.rpc.timeout-sec")) * time.Second
+	err = helper.Call(self.rpcMethod, params, &result, timeout)
+	if recorder != nil {
+		output := result.Output
+		if len(output) != 0 && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		recorder.stdout.WriteString(output)
+		written := NewEnv().NewLayer(EnvLayerSession)
+		for k, v := range result.Env {
+			written.Set(k, v)
+		}
+		recorder.FinishWithEnv(err, written)
+	}
+	if err != nil {
+		panic(NewCmdError(parsedCmd, fmt.Sprintf("rpc call '%s' to helper '%s' failed: %v",
+			self.rpcMethod, self.cmdLine, err)))
+	}
+
+	if len(result.Output) != 0 {
+		cc.Screen.Print(result.Output)
+		if !strings.HasSuffix(result.Output, "\n") {
+			cc.Screen.Print("\n")
+		}
+	}
+	for k, v := range result.Env {
+		session.Set(k, v)
+	}
+	if env.GetBool("sys.mock.record") {
+		self.recordMockValues(argv, cc, env)
+	}
+	return true
+}
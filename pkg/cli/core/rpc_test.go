@@ -0,0 +1,83 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRpcHelperExitedBetweenCalls(t *testing.T) {
+	helpers := NewRpcHelpers()
+	defer helpers.Close()
+
+	// Respond once then exit
+	script := `read line; echo '{"jsonrpc": "2.0", "id": 1, "result": {}}'`
+	for i := 0; i < 3; i++ {
+		helper, err := helpers.Get("once", "sh", []string{"-c", script})
+		if err != nil {
+			t.Fatalf("get rpc helper failed: %v\n", err)
+		}
+		err = helper.Call("x", nil, nil, 0)
+		if err != nil {
+			t.Fatalf("call #%d: unexpected error: %v\n", i, err)
+		}
+		<-helper.done
+		if helper.running() {
+			t.Fatalf("call #%d: the exited helper should not be running\n", i)
+		}
+	}
+}
+
+func TestRpcHelperCallTimeout(t *testing.T) {
+	helpers := NewRpcHelpers()
+	defer helpers.Close()
+
+	helper, err := helpers.Get("hung", "sh", []string{"-c", "exec sleep 60"})
+	if err != nil {
+		t.Fatalf("get rpc helper failed: %v\n", err)
+	}
+	start := time.Now()
+	err = helper.Call("x", nil, nil, 100*time.Millisecond)
+	if err == nil {
+		t.Fatalf("the call to a hung helper should be failed\n")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("the call to a hung helper is not timed out in time\n")
+	}
+	select {
+	case <-helper.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the hung helper should be killed\n")
+	}
+}
+
+func TestRpcHelperBadResponse(t *testing.T) {
+	helpers := NewRpcHelpers()
+	defer helpers.Close()
+
+	// Answer each request with a bad response then a stale one
+	script := `while read line; do echo 'not json'; echo '{"jsonrpc": "2.0", "id": 1, "result": {}}'; done`
+	helper, err := helpers.Get("bad", "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatalf("get rpc helper failed: %v\n", err)
+	}
+	err = helper.Call("x", nil, nil, 0)
+	if err == nil {
+		t.Fatalf("the bad response should be an error\n")
+	}
+	if helper.running() {
+		t.Fatalf("the helper with a bad response should not be running\n")
+	}
+
+	// The stale response should not be read by the next call
+	restarted, err := helpers.Get("bad", "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatalf("get rpc helper failed: %v\n", err)
+	}
+	if restarted == helper {
+		t.Fatalf("the broken helper should be restarted\n")
+	}
+	err = restarted.Call("x", nil, nil, 0)
+	if err == nil {
+		t.Fatalf("the bad response of the restarted helper should be an error\n")
+	}
+}
@@ -70,20 +70,20 @@ func tryRenderMultiplyTemplate(
 
 	key := strings.TrimSpace(in[valBegin+len(ml) : valEnd])
 
-	var valStr string
-	val, ok := env.GetEx(key)
-	valStr = val.Raw
-	if !ok {
-		val, inArg := argv[key]
-		valStr = val.Raw
-		ok = inArg && len(valStr) != 0
-	}
-	if !ok {
+	valStr, missedKey, err := renderTemplateExpr(key, templateLookup(argv, env))
+	if err != nil {
 		hasError = true
 		if allowError {
 			return
 		}
-		templateRenderPanic(in, cmd, targetName, key, true)
+		templateExprPanic(in, cmd, targetName, key, err)
+	}
+	if len(missedKey) != 0 {
+		hasError = true
+		if allowError {
+			return
+		}
+		templateRenderPanic(in, cmd, targetName, missedKey, true)
 	}
 
 	out = nil
@@ -130,27 +130,85 @@ func tryRenderTemplate(
 			break
 		}
 		key := tail[0:j]
-		var valStr string
-		val, ok := env.GetEx(key)
-		valStr = val.Raw
-		if !ok {
-			val, inArg := argv[key]
-			valStr = val.Raw
-			ok = inArg && len(valStr) != 0
-		}
-		if !ok {
+		valStr, missedKey, err := renderTemplateExpr(key, templateLookup(argv, env))
+		if err != nil || len(missedKey) != 0 {
 			hasError = true
 			if allowError {
 				findPos += j + len(templBracketRight)
 				continue
 			}
-			templateRenderPanic(in, cmd, targetName, key, false)
+			if err != nil {
+				templateExprPanic(in, cmd, targetName, key, err)
+			}
+			templateRenderPanic(in, cmd, targetName, missedKey, false)
 		}
 		in = in[:findPos] + str[0:i] + valStr + tail[j+len(templBracketRight):]
 	}
 	return in, hasError
 }
 
+// The env keys read by the templates of the flow, not including the ones provided by args,
+// the keys in expressions with alternatives are 'mayKeys'
+func (self *Cmd) FlowTemplateKeys(argv ArgVals) (keys []string, mayKeys []string) {
+	templBracketLeft := self.owner.Strs.FlowTemplateBracketLeft
+	templBracketRight := self.owner.Strs.FlowTemplateBracketRight
+	templMultiplyMark := self.owner.Strs.FlowTemplateMultiplyMark
+
+	added := map[string]bool{}
+	for _, line := range self.flow {
+		for {
+			i := strings.Index(line, templBracketLeft)
+			if i < 0 {
+				break
+			}
+			line = line[i+len(templBracketLeft):]
+			j := strings.Index(line, templBracketRight)
+			if j < 0 {
+				break
+			}
+			expr := strings.Trim(strings.TrimSpace(line[:j]), templMultiplyMark)
+			line = line[j+len(templBracketRight):]
+
+			exprKeys, optional := templateExprKeys(expr)
+			for _, key := range exprKeys {
+				if added[key] || len(argv[key].Raw) != 0 {
+					continue
+				}
+				added[key] = true
+				if optional {
+					mayKeys = append(mayKeys, key)
+				} else {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	return
+}
+
+func templateLookup(argv ArgVals, env *Env) templateValLookup {
+	return func(key string) (string, bool) {
+		val, ok := env.GetEx(key)
+		if ok {
+			return val.Raw, true
+		}
+		arg, inArg := argv[key]
+		return arg.Raw, inArg && len(arg.Raw) != 0
+	}
+}
+
+func templateExprPanic(in string, cmd *Cmd, targetName string, expr string, err error) {
+	panic(CmdBadTemplateExprWhenRenderFlow{
+		"render " + targetName + " template failed, bad expression: " + err.Error(),
+		cmd.owner.DisplayPath(),
+		cmd.metaFilePath,
+		cmd.owner.Source(),
+		in,
+		expr,
+		cmd,
+	})
+}
+
 func templateRenderPanic(in string, cmd *Cmd, targetName string, key string, isMultiply bool) {
 	multiply := ""
 	if isMultiply {
@@ -0,0 +1,445 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template expressions in brackets, eg: "[[key]]", "[[key|alter-key|default]]", "[[port + 1]]",
+// "[[split(addr, ':', 0)]]". In "a|b|c" the first one could be evaluated is used,
+// the last one is used as literal text if it's a bare word and not a key, quote it for other literal text.
+// Spaces are needed around '-' because keys may contain it.
+// '+' concatenates strings if any side is not a number.
+// Functions: upper(s), lower(s), trim(s), replace(s, old, new), split(s, sep, index)
+
+type templateValLookup func(key string) (val string, ok bool)
+
+type templateMissedKeyErr struct {
+	key string
+}
+
+func (self templateMissedKeyErr) Error() string {
+	return "key '" + self.key + "' not found"
+}
+
+// Return the missed key if a key can't be found, or an error if the expression is not valid
+func renderTemplateExpr(expr string, lookup templateValLookup) (val string, missedKey string, err error) {
+	expr = strings.TrimSpace(expr)
+
+	// Fast path, also compatible with keys have special chars
+	val, ok := lookup(expr)
+	if ok {
+		return val, "", nil
+	}
+	if isTemplateWord(expr) {
+		return "", expr, nil
+	}
+
+	alters, err := splitTemplateAlters(expr)
+	if err != nil {
+		return "", "", err
+	}
+
+	for i, alter := range alters {
+		isLast := (i == len(alters)-1)
+		val, err = evalTemplateExpr(alter, lookup)
+		if err == nil {
+			return val, "", nil
+		}
+		missed, isMissed := err.(templateMissedKeyErr)
+		if !isMissed {
+			return "", "", err
+		}
+		// Only a bare word could be a literal default, eg: "[[host|127.0.0.1]]"
+		word := strings.TrimSpace(alter)
+		if isLast && len(alters) > 1 && word == missed.key {
+			return word, "", nil
+		}
+		if isLast {
+			return "", missed.key, nil
+		}
+	}
+	return
+}
+
+// The keys read by the expression, 'optional' is true if it has alternatives,
+// the bare word in the last alternative is not included, it's treated as the literal default
+func templateExprKeys(expr string) (keys []string, optional bool) {
+	expr = strings.TrimSpace(expr)
+	if isTemplateWord(expr) {
+		return []string{expr}, false
+	}
+	alters, err := splitTemplateAlters(expr)
+	if err != nil {
+		return nil, false
+	}
+	for i, alter := range alters {
+		if i > 0 && i == len(alters)-1 && isTemplateWord(strings.TrimSpace(alter)) {
+			continue
+		}
+		tokens, err := tokenizeTemplateExpr(alter)
+		if err != nil {
+			continue
+		}
+		for j, token := range tokens {
+			isCall := j+1 < len(tokens) && tokens[j+1].ty == templateTokenOp && tokens[j+1].str == "("
+			if token.ty == templateTokenWord && !isCall {
+				keys = append(keys, token.str)
+			}
+		}
+	}
+	return keys, len(alters) > 1
+}
+
+func splitTemplateAlters(expr string) (alters []string, err error) {
+	depth := 0
+	var quote byte
+	begin := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		if quote != 0 {
+			if c == '\\' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '(':
+			depth += 1
+		case ')':
+			depth -= 1
+		case '|':
+			if depth == 0 {
+				alters = append(alters, expr[begin:i])
+				begin = i + 1
+			}
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in template expression '%s'", expr)
+	}
+	alters = append(alters, expr[begin:])
+	return
+}
+
+func isTemplateWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-'
+}
+
+func isTemplateWord(str string) bool {
+	if len(str) == 0 || str[0] == '-' {
+		return false
+	}
+	for i := 0; i < len(str); i++ {
+		if !isTemplateWordChar(str[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	templateTokenWord = iota
+	templateTokenNumber
+	templateTokenString
+	templateTokenOp
+)
+
+type templateToken struct {
+	ty  int
+	str string
+}
+
+func tokenizeTemplateExpr(expr string) (tokens []templateToken, err error) {
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i += 1
+		case c == '"' || c == '\'':
+			var str []byte
+			j := i + 1
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j += 1
+				}
+				str = append(str, expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unclosed quote in template expression '%s'", expr)
+			}
+			tokens = append(tokens, templateToken{templateTokenString, string(str)})
+			i = j + 1
+		case isTemplateWordChar(c) && c != '-':
+			j := i + 1
+			for ; j < len(expr) && isTemplateWordChar(expr[j]); j++ {
+			}
+			word := expr[i:j]
+			if _, err := strconv.ParseInt(word, 10, 64); err == nil {
+				tokens = append(tokens, templateToken{templateTokenNumber, word})
+			} else {
+				tokens = append(tokens, templateToken{templateTokenWord, word})
+			}
+			i = j
+		case strings.IndexByte("+-*/%(),", c) >= 0:
+			tokens = append(tokens, templateToken{templateTokenOp, string(c)})
+			i += 1
+		default:
+			return nil, fmt.Errorf("unexpected char '%c' in template expression '%s'", c, expr)
+		}
+	}
+	return
+}
+
+// The parsing goes on after a key is missed, so the syntax errors are not hidden by it
+type templateExprParser struct {
+	tokens []templateToken
+	pos    int
+	lookup templateValLookup
+	expr   string
+	missed string
+}
+
+func evalTemplateExpr(expr string, lookup templateValLookup) (string, error) {
+	tokens, err := tokenizeTemplateExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("empty template expression")
+	}
+	parser := &templateExprParser{tokens, 0, lookup, expr, ""}
+	val, err := parser.parseSum()
+	if err != nil {
+		return "", err
+	}
+	if parser.pos != len(tokens) {
+		return "", fmt.Errorf("unexpected '%s' in template expression '%s'",
+			tokens[parser.pos].str, expr)
+	}
+	if len(parser.missed) != 0 {
+		return "", templateMissedKeyErr{parser.missed}
+	}
+	return val, nil
+}
+
+func (self *templateExprParser) peekOp() string {
+	if self.pos >= len(self.tokens) || self.tokens[self.pos].ty != templateTokenOp {
+		return ""
+	}
+	return self.tokens[self.pos].str
+}
+
+func (self *templateExprParser) expectOp(op string) error {
+	if self.peekOp() != op {
+		return fmt.Errorf("expect '%s' in template expression '%s'", op, self.expr)
+	}
+	self.pos += 1
+	return nil
+}
+
+func (self *templateExprParser) parseSum() (string, error) {
+	val, err := self.parseTerm()
+	if err != nil {
+		return "", err
+	}
+	for {
+		op := self.peekOp()
+		if op != "+" && op != "-" {
+			return val, nil
+		}
+		self.pos += 1
+		right, err := self.parseTerm()
+		if err != nil {
+			return "", err
+		}
+		val, err = self.calculate(op, val, right)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (self *templateExprParser) parseTerm() (string, error) {
+	val, err := self.parseFactor()
+	if err != nil {
+		return "", err
+	}
+	for {
+		op := self.peekOp()
+		if op != "*" && op != "/" && op != "%" {
+			return val, nil
+		}
+		self.pos += 1
+		right, err := self.parseFactor()
+		if err != nil {
+			return "", err
+		}
+		val, err = self.calculate(op, val, right)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (self *templateExprParser) parseFactor() (string, error) {
+	if self.pos >= len(self.tokens) {
+		return "", fmt.Errorf("unexpected end of template expression '%s'", self.expr)
+	}
+	token := self.tokens[self.pos]
+	self.pos += 1
+
+	switch token.ty {
+	case templateTokenNumber, templateTokenString:
+		return token.str, nil
+	case templateTokenWord:
+		if self.peekOp() == "(" {
+			return self.parseCall(token.str)
+		}
+		val, ok := self.lookup(token.str)
+		if !ok && len(self.missed) == 0 {
+			self.missed = token.str
+		}
+		return val, nil
+	}
+
+	switch token.str {
+	case "(":
+		val, err := self.parseSum()
+		if err != nil {
+			return "", err
+		}
+		return val, self.expectOp(")")
+	case "-":
+		val, err := self.parseFactor()
+		if err != nil {
+			return "", err
+		}
+		return self.calculate("-", "0", val)
+	}
+	return "", fmt.Errorf("unexpected '%s' in template expression '%s'", token.str, self.expr)
+}
+
+func (self *templateExprParser) parseCall(name string) (string, error) {
+	self.pos += 1
+	var args []string
+	if self.peekOp() != ")" {
+		for {
+			arg, err := self.parseSum()
+			if err != nil {
+				return "", err
+			}
+			args = append(args, arg)
+			if self.peekOp() != "," {
+				break
+			}
+			self.pos += 1
+		}
+	}
+	err := self.expectOp(")")
+	if err != nil {
+		return "", err
+	}
+	if len(self.missed) != 0 {
+		if !isTemplateFunc(name) {
+			return "", fmt.Errorf("unknown function '%s' in template expression '%s'", name, self.expr)
+		}
+		return "", nil
+	}
+	return callTemplateFunc(name, args, self.expr)
+}
+
+func (self *templateExprParser) calculate(op string, left string, right string) (string, error) {
+	if len(self.missed) != 0 {
+		return "", nil
+	}
+	l, lErr := strconv.ParseInt(left, 10, 64)
+	r, rErr := strconv.ParseInt(right, 10, 64)
+	if lErr != nil || rErr != nil {
+		if op == "+" {
+			return left + right, nil
+		}
+		return "", fmt.Errorf("operator '%s' needs numbers, got '%s' and '%s' in template expression '%s'",
+			op, left, right, self.expr)
+	}
+	var val int64
+	switch op {
+	case "+":
+		val = l + r
+	case "-":
+		val = l - r
+	case "*":
+		val = l * r
+	case "/", "%":
+		if r == 0 {
+			return "", fmt.Errorf("divided by zero in template expression '%s'", self.expr)
+		}
+		if op == "/" {
+			val = l / r
+		} else {
+			val = l % r
+		}
+	}
+	return strconv.FormatInt(val, 10), nil
+}
+
+func isTemplateFunc(name string) bool {
+	switch name {
+	case "upper", "lower", "trim", "replace", "split":
+		return true
+	}
+	return false
+}
+
+func callTemplateFunc(name string, args []string, expr string) (string, error) {
+	checkArgs := func(cnt int) error {
+		if len(args) != cnt {
+			return fmt.Errorf("function '%s' needs %d args, got %d in template expression '%s'",
+				name, cnt, len(args), expr)
+		}
+		return nil
+	}
+
+	switch name {
+	case "upper", "lower", "trim":
+		if err := checkArgs(1); err != nil {
+			return "", err
+		}
+		if name == "upper" {
+			return strings.ToUpper(args[0]), nil
+		} else if name == "lower" {
+			return strings.ToLower(args[0]), nil
+		}
+		return strings.TrimSpace(args[0]), nil
+	case "replace":
+		if err := checkArgs(3); err != nil {
+			return "", err
+		}
+		return strings.ReplaceAll(args[0], args[1], args[2]), nil
+	case "split":
+		if err := checkArgs(3); err != nil {
+			return "", err
+		}
+		idx, err := strconv.Atoi(args[2])
+		if err != nil {
+			return "", fmt.Errorf("function 'split' needs a number as index, got '%s' in template expression '%s'",
+				args[2], expr)
+		}
+		fields := strings.Split(args[0], args[1])
+		if idx < 0 {
+			idx += len(fields)
+		}
+		if idx < 0 || idx >= len(fields) {
+			return "", fmt.Errorf("function 'split' index '%s' out of range in template expression '%s'",
+				args[2], expr)
+		}
+		return fields[idx], nil
+	}
+	return "", fmt.Errorf("unknown function '%s' in template expression '%s'", name, expr)
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderTemplateExpr(t *testing.T) {
+	vals := map[string]string{
+		"port":     "4000",
+		"host":     "127.0.0.1",
+		"addr":     "db1:3306",
+		"name":     "tidb",
+		"empty":    "",
+		"a.b-c":    "x",
+		"key with": "space",
+	}
+	lookup := func(key string) (string, bool) {
+		val, ok := vals[key]
+		return val, ok
+	}
+
+	test := func(expr string, val string) {
+		res, missed, err := renderTemplateExpr(expr, lookup)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", expr, err)
+		}
+		if len(missed) != 0 {
+			t.Fatalf("%#v: unexpected missed key '%s'\n", expr, missed)
+		}
+		if res != val {
+			t.Fatalf("%#v: rendered %#v != %#v\n", expr, res, val)
+		}
+	}
+
+	testMissed := func(expr string, key string) {
+		_, missed, err := renderTemplateExpr(expr, lookup)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", expr, err)
+		}
+		if missed != key {
+			t.Fatalf("%#v: missed key %#v != %#v\n", expr, missed, key)
+		}
+	}
+
+	testErr := func(expr string) {
+		_, _, err := renderTemplateExpr(expr, lookup)
+		if err == nil {
+			t.Fatalf("%#v: expect error\n", expr)
+		}
+	}
+
+	// Keys
+	test("port", "4000")
+	test(" port ", "4000")
+	test("a.b-c", "x")
+	test("key with", "space")
+	test("empty", "")
+	testMissed("nope", "nope")
+
+	// Defaults
+	test("nope|port", "4000")
+	test("port|nope", "4000")
+	test("nope|nope2|3000", "3000")
+	test("nope|localhost", "localhost")
+	test("nope|127.0.0.1", "127.0.0.1")
+	test(`nope|"a default"`, "a default")
+	test("nope|'a|b'", "a|b")
+	test("nope|upper(name)", "TIDB")
+	testMissed("nope|upper(nope2)", "nope2")
+	testMissed("nope|nope2 + 1", "nope2")
+
+	// Arithmetic
+	test("port + 1", "4001")
+	test("port - 1", "3999")
+	test("port * 2 + 1", "8001")
+	test("(port + 1) * 2", "8002")
+	test("port / 3", "1333")
+	test("port % 7", "3")
+	test("-port + 1", "-3999")
+	test(`"tidb-" + name`, "tidb-tidb")
+	test("name + port", "tidb4000")
+	testMissed("nope + 1", "nope")
+	testErr("port / 0")
+	testErr("name * 2")
+
+	// Functions
+	test("upper(name)", "TIDB")
+	test(`lower("ABC")`, "abc")
+	test(`trim(" a ")`, "a")
+	test(`replace(host, ".", "-")`, "127-0-0-1")
+	test(`split(addr, ":", 0)`, "db1")
+	test(`split(addr, ":", -1)`, "3306")
+	test(`split(addr, ":", 1) + 1`, "3307")
+	test(`upper(split(addr, ":", 0))`, "DB1")
+	testErr(`split(addr, ":", 2)`)
+	testErr(`split(addr, ":", name)`)
+	testMissed(`split(addr, ":", x)`, "x")
+	testErr("upper(name, name)")
+	testErr("nope(name)")
+
+	// Errors are reported even if a key is missed, or in the last alternative
+	testErr("nope|nope2(name)")
+	testErr("nope|upper(name")
+	testErr("nope|a b")
+	testErr("nope(nope2)")
+	testErr("upper(nope")
+	testErr(`nope|"abc`)
+	testErr("port +")
+	testErr("port $ 1")
+}
+
+func TestTemplateExprKeys(t *testing.T) {
+	test := func(expr string, keys []string, optional bool) {
+		res, opt := templateExprKeys(expr)
+		if !reflect.DeepEqual(res, keys) || opt != optional {
+			t.Fatalf("%#v: keys %#v %v != %#v %v\n", expr, res, opt, keys, optional)
+		}
+	}
+
+	test("port", []string{"port"}, false)
+	test("a.b-c", []string{"a.b-c"}, false)
+	test("port + 1", []string{"port"}, false)
+	test(`split(addr, ":", 0)`, []string{"addr"}, false)
+	test(`"tidb-" + name`, []string{"name"}, false)
+	test("a|b|3000", []string{"a", "b"}, true)
+	test("a|upper(b)", []string{"a", "b"}, true)
+	// The bare word in the last alternative is the literal default
+	test("host|localhost", []string{"host"}, true)
+	test("a|b|127.0.0.1", []string{"a", "b"}, true)
+	test("a|b + c", []string{"a", "b", "c"}, true)
+	test(`"abc`, nil, false)
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// An executable-file command declared 'worker = true' in meta stays alive in the session,
+// it's started by the first step with os env "TICAT_WORKER=1" and the session dir as the only arg,
+// then receives the steps from fd 3 and sends back the results to fd 4, one json each line:
+//   step  : {"id": 1, "args": {...}, "env": {...}, "deleted": [...]}
+//   result: {"id": 1, "env": {...}, "deleted": [...], "error": "..."}
+// Only the env delta is exchanged: the changed and deleted keys since the last step,
+// and the keys written or deleted by the step. Stdin, stdout and stderr are the same as normal executions.
+// In record mode the steps are executed as normal executions instead of by the worker,
+// because the output of a long-running process can't be split into steps.
+// A step not finished in "sys.worker.timeout-sec" (0 means no limit) fails, the worker is killed.
+
+const WorkerOsEnv = "TICAT_WORKER=1"
+
+type workerStep struct {
+	Id      int               `json:"id"`
+	Args    map[string]string `json:"args"`
+	Env     map[string]string `json:"env"`
+	Deleted []string          `json:"deleted,omitempty"`
+}
+
+type workerResult struct {
+	Id      int               `json:"id"`
+	Env     map[string]string `json:"env"`
+	Deleted []string          `json:"deleted"`
+	Err     string            `json:"error"`
+}
+
+// The workers of a session, one process for each executable file
+type ModWorkers struct {
+	lock    sync.Mutex
+	workers map[string]*modWorker
+}
+
+func NewModWorkers() *ModWorkers {
+	return &ModWorkers{workers: map[string]*modWorker{}}
+}
+
+func (self *ModWorkers) Get(path string, bin string, args []string) (*modWorker, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	worker, ok := self.workers[path]
+	if ok && worker.running() {
+		return worker, nil
+	}
+	if ok {
+		// Reap the broken one, kill it if it's still running
+		worker.Close()
+	}
+	worker, err := startModWorker(path, bin, args)
+	if err != nil {
+		return nil, err
+	}
+	self.workers[path] = worker
+	return worker, nil
+}
+
+// The workers will exit when the step pipes are closed
+func (self *ModWorkers) Close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for path, worker := range self.workers {
+		worker.Close()
+		delete(self.workers, path)
+	}
+}
+
+type modWorker struct {
+	*lineProc
+	lock   sync.Mutex
+	nextId int
+	// The env the worker has, for calculating delta
+	synced map[string]string
+}
+
+func startModWorker(path string, bin string, args []string) (*modWorker, error) {
+	stepsR, stepsW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create step pipe for worker '%s' failed: %v", path, err)
+	}
+	resultsR, resultsW, err := os.Pipe()
+	if err != nil {
+		stepsR.Close()
+		stepsW.Close()
+		return nil, fmt.Errorf("create result pipe for worker '%s' failed: %v", path, err)
+	}
+
+	cmd := exec.Command(bin, args...)
+	cmd.Env = append(os.Environ(), WorkerOsEnv)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Become fd 3 and fd 4 in the worker
+	cmd.ExtraFiles = []*os.File{stepsR, resultsW}
+	err = cmd.Start()
+	stepsR.Close()
+	resultsW.Close()
+	if err != nil {
+		stepsW.Close()
+		resultsR.Close()
+		return nil, fmt.Errorf("start worker '%s' failed: %v", path, err)
+	}
+	return &modWorker{
+		lineProc: newLineProc("worker", path, cmd, stepsW, resultsR),
+		synced:   map[string]string{},
+	}, nil
+}
+
+// The worker is killed if the step is not finished in time, no timeout if 'timeout' is zero
+func (self *modWorker) Step(args map[string]string, env map[string]string,
+	timeout time.Duration) (result workerResult, err error) {
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.nextId += 1
+	step := workerStep{self.nextId, args, map[string]string{}, nil}
+	for k, v := range env {
+		old, ok := self.synced[k]
+		if !ok || old != v {
+			step.Env[k] = v
+		}
+	}
+	for k := range self.synced {
+		if _, ok := env[k]; !ok {
+			step.Deleted = append(step.Deleted, k)
+		}
+	}
+
+	data, err := json.Marshal(step)
+	if err != nil {
+		return result, fmt.Errorf("marshal worker step failed: %v", err)
+	}
+	line, err := self.exchange(data, timeout)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(line, &result)
+	if err != nil {
+		return result, self.outOfStep("bad step result from worker '%s': %v", self.path, err)
+	}
+	if result.Id != self.nextId {
+		return result, self.outOfStep("step result id %d from worker '%s' not match step id %d",
+			result.Id, self.path, self.nextId)
+	}
+
+	self.synced = map[string]string{}
+	for k, v := range env {
+		self.synced[k] = v
+	}
+	for k, v := range result.Env {
+		self.synced[k] = v
+	}
+	for _, k := range result.Deleted {
+		delete(self.synced, k)
+	}
+	if len(result.Err) != 0 {
+		return result, fmt.Errorf("%s", result.Err)
+	}
+	return result, nil
+}
+
+func (self *modWorker) Close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.close()
+}
+
+func (self *Cmd) executeWorker(argv ArgVals, cc *Cli, env *Env, parsedCmd ParsedCmd, bin string, args []string) bool {
+	sessionDir := env.GetRaw("session")
+	if len(sessionDir) == 0 {
+		panic(NewCmdError(parsedCmd, "[Cmd.executeWorker] session dir not found in env"))
+	}
+	args = append(args, self.cmdLine, sessionDir)
+	worker, err := cc.ModWorkers.Get(self.cmdLine, bin, args)
+	if err != nil {
+		panic(NewCmdError(parsedCmd, err.Error()))
+	}
+
+	session := env.GetLayer(EnvLayerSession)
+	stepArgs := map[string]string{}
+	for _, k := range self.args.Names() {
+		stepArgs[k] = argv[k].Raw
+	}
+	stepEnv := map[string]string{}
+	for _, k := range envOutputKeys(session, "", false) {
+		stepEnv[k] = session.GetRaw(k)
+	}
+
+	timeout := time.Duration(env.GetInt("sys.worker.timeout-sec")) * time.Second
+	result, err := worker.Step(stepArgs, stepEnv, timeout)
+	for k, v := range result.Env {
+		session.Set(k, v)
+	}
+	for _, k := range result.Deleted {
+		session.DeleteInSelfLayer(k)
+	}
+	if err != nil {
+		panic(RunCmdFileFailed{
+			err.Error(),
+			parsedCmd,
+			argv,
+			bin,
+			sessionDir,
+		})
+	}
+	if env.GetBool("sys.mock.record") {
+		self.recordMockValues(argv, cc, env)
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write back the received delta of each step, the values are stored in the worker as its env.
+// Step "drop" deletes key "c"
+const testWorkerScript = `
+import json, os
+
+env = {}
+steps = os.fdopen(3, "r")
+results = os.fdopen(4, "w")
+for line in steps:
+    step = json.loads(line)
+    env.update(step["env"])
+    for k in step.get("deleted") or []:
+        env.pop(k)
+    dropped = ["c"] if step["args"]["msg"] == "drop" else []
+    for k in dropped:
+        env.pop(k, None)
+    written = {
+        "got.changed": ",".join(sorted(step["env"])) or "-",
+        "got.deleted": ",".join(sorted(step.get("deleted") or [])) or "-",
+        "got.msg": step["args"]["msg"],
+        "got.keys": ",".join(sorted(k for k in env if not k.startswith("got."))),
+    }
+    env.update(written)
+    results.write(json.dumps({"id": step["id"], "env": written, "deleted": dropped}) + "\n")
+    results.flush()
+`
+
+func TestExecuteWorker(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not found")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "worker.py")
+	err := ioutil.WriteFile(path, []byte(testWorkerScript), 0644)
+	if err != nil {
+		t.Fatalf("write worker script failed: %v\n", err)
+	}
+
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	cmd := tree.AddSub("worker").RegFileCmd(path, "worker for test").SetWorker().AddArg("msg", "")
+
+	env := NewEnv().NewLayers(EnvLayerDefault, EnvLayerSession)
+	env.GetLayer(EnvLayerDefault).Set("sys.ext.exec.py", "python3")
+	env.GetLayer(EnvLayerDefault).SetInt("sys.worker.timeout-sec", 60)
+	session := env.GetLayer(EnvLayerSession)
+	session.Set("session", dir)
+	cc := NewCli(env, &QuietScreen{}, tree, nil, nil)
+	defer cc.ModWorkers.Close()
+
+	step := func(msg string, changed string, deleted string, keys string) {
+		cmd.executeFile(ArgVals{"msg": ArgVal{msg, true, 0}}, cc, env, ParsedCmd{})
+		expected := map[string]string{
+			"got.changed": changed,
+			"got.deleted": deleted,
+			"got.msg":     msg,
+			"got.keys":    keys,
+		}
+		for k, v := range expected {
+			if session.GetRaw(k) != v {
+				t.Fatalf("step %#v: session %#v: %#v != %#v\n", msg, k, session.GetRaw(k), v)
+			}
+		}
+	}
+
+	session.Set("a", "1")
+	session.Set("b", "2")
+	step("first", "a,b", "-", "a,b")
+
+	// Only the delta is sent, the written keys are already in the worker
+	session.Set("a", "10")
+	session.Delete("b")
+	session.Set("c", "3")
+	step("second", "a,c", "b", "a,c")
+
+	step("third", "-", "-", "a,c")
+	if session.GetRaw("a") != "10" || session.GetRaw("c") != "3" {
+		t.Fatalf("the session env should not be changed by the worker\n")
+	}
+
+	step("drop", "-", "-", "a")
+	if session.Has("c") {
+		t.Fatalf("the key deleted by the worker should be deleted from the session env\n")
+	}
+	// The deleted key is not in the worker, no need to send it back as deleted
+	step("fifth", "-", "-", "a")
+}
+
+func TestModWorkerExitedBetweenSteps(t *testing.T) {
+	workers := NewModWorkers()
+	defer workers.Close()
+
+	// Finish one step then exit
+	script := `read line <&3; echo '{"id": 1, "env": {}}' >&4`
+	for i := 0; i < 3; i++ {
+		worker, err := workers.Get("once", "sh", []string{"-c", script})
+		if err != nil {
+			t.Fatalf("get worker failed: %v\n", err)
+		}
+		_, err = worker.Step(nil, nil, 0)
+		if err != nil {
+			t.Fatalf("step #%d: unexpected error: %v\n", i, err)
+		}
+		<-worker.done
+		if worker.running() {
+			t.Fatalf("step #%d: the exited worker should not be running\n", i)
+		}
+	}
+}
+
+func TestModWorkerStepTimeout(t *testing.T) {
+	workers := NewModWorkers()
+	defer workers.Close()
+
+	worker, err := workers.Get("hung", "sh", []string{"-c", "exec sleep 60"})
+	if err != nil {
+		t.Fatalf("get worker failed: %v\n", err)
+	}
+	start := time.Now()
+	_, err = worker.Step(nil, nil, 100*time.Millisecond)
+	if err == nil {
+		t.Fatalf("the step of a hung worker should be failed\n")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("the step of a hung worker is not timed out in time\n")
+	}
+	select {
+	case <-worker.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the hung worker should be killed\n")
+	}
+}
+
+func TestModWorkerBadResult(t *testing.T) {
+	workers := NewModWorkers()
+	defer workers.Close()
+
+	// Answer each step with a bad result then a stale one
+	script := `while read line <&3; do echo 'not json' >&4; echo '{"id": 1, "env": {}}' >&4; done`
+	worker, err := workers.Get("bad", "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatalf("get worker failed: %v\n", err)
+	}
+	_, err = worker.Step(nil, nil, 0)
+	if err == nil {
+		t.Fatalf("the bad result should be an error\n")
+	}
+	if !worker.exited {
+		t.Fatalf("the worker with a bad result should be marked as exited\n")
+	}
+
+	// The stale result should not be read by the next step
+	restarted, err := workers.Get("bad", "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatalf("get worker failed: %v\n", err)
+	}
+	if restarted == worker {
+		t.Fatalf("the broken worker should be restarted\n")
+	}
+	_, err = restarted.Step(nil, nil, 0)
+	if err == nil {
+		t.Fatalf("the bad result of the restarted worker should be an error\n")
+	}
+}
@@ -1,6 +1,7 @@
 package display
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
@@ -19,7 +20,7 @@ func DumpCmdsWithTips(
 	}
 
 	buf := NewCacheScreen()
-	dumpCmd(buf, env, cmds, args, -cmds.Depth())
+	dumpCmds(buf, env, cmds, args)
 
 	findStr := strings.Join(args.FindStrs, " ")
 	selfName := env.GetRaw("strs.self-name")
@@ -39,6 +40,9 @@ func DumpCmdsWithTips(
 			}
 		}
 		matchStr := " commands matched " + tag + "'" + findStr + "'"
+		if args.RankFind() && buf.OutputNum() > 0 {
+			matchStr += ", best matches first"
+		}
 		if !cmds.IsRoot() {
 			if buf.OutputNum() > 0 {
 				prt(tip + "branch '" + displayCmdPath + "', found" + matchStr + ":")
@@ -117,7 +121,7 @@ func DumpCmds(
 	env *core.Env,
 	args *DumpCmdArgs) {
 
-	dumpCmd(screen, env, cmds, args, -cmds.Depth())
+	dumpCmds(screen, env, cmds, args)
 }
 
 type DumpCmdArgs struct {
@@ -189,12 +193,108 @@ func (self *DumpCmdArgs) MatchFind(cmd *core.CmdTree) bool {
 	return false
 }
 
+// Search results are ranked by relevance: the flatten results are listed by score,
+// in the tree mode the branches are listed by the best score in them
+func (self *DumpCmdArgs) RankFind() bool {
+	return len(self.FindStrs) != 0 && len(self.MatchWriteKey) == 0
+}
+
+// The score of a command itself and the best score in its sub tree, 'idx' is the order in the tree
+type rankedCmd struct {
+	cmd     *core.CmdTree
+	idx     int
+	score   int
+	best    int
+	matches []core.FindMatch
+}
+
+type rankedCmds map[*core.CmdTree]rankedCmd
+
+func dumpCmds(
+	screen core.Screen,
+	env *core.Env,
+	cmds *core.CmdTree,
+	args *DumpCmdArgs) {
+
+	indentAdjust := -cmds.Depth()
+	if !args.RankFind() {
+		dumpCmd(screen, env, cmds, args, indentAdjust, nil)
+		return
+	}
+
+	ranked := rankedCmds{}
+	collectRankedCmds(cmds, args, ranked)
+	if !args.Flatten || !args.Recursive {
+		dumpCmd(screen, env, cmds, args, indentAdjust, ranked)
+		return
+	}
+
+	var results []rankedCmd
+	for _, it := range ranked {
+		if it.score > 0 {
+			results = append(results, it)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].idx < results[j].idx
+	})
+	single := *args
+	single.Recursive = false
+	for _, it := range results {
+		dumpCmd(screen, env, it.cmd, &single, indentAdjust, ranked)
+	}
+}
+
+func collectRankedCmds(cmd *core.CmdTree, args *DumpCmdArgs, ranked rankedCmds) int {
+	if cmd == nil || cmd.IsHidden() {
+		return 0
+	}
+	it := rankedCmd{cmd: cmd, idx: len(ranked)}
+	ranked[cmd] = it
+	if cmd.Parent() != nil && cmd.Cmd() != nil {
+		if !args.FindByTags {
+			it.score, it.matches = cmd.MatchFindRank(args.FindStrs...)
+		} else if cmd.MatchTags(args.FindStrs...) {
+			// All results have the tags, rank them by the tags appear in names or helps
+			it.score, _ = cmd.MatchFindRank(args.FindStrs...)
+			if it.score <= 0 {
+				it.score = 1
+			}
+		}
+	}
+	it.best = it.score
+	for _, name := range cmd.SubNames() {
+		if best := collectRankedCmds(cmd.GetSub(name), args, ranked); best > it.best {
+			it.best = best
+		}
+	}
+	ranked[cmd] = it
+	return it.best
+}
+
+// The sub commands are listed by the best score in their sub trees if 'ranked' is not nil
+func (self rankedCmds) subNames(cmd *core.CmdTree) []string {
+	names := append([]string{}, cmd.SubNames()...)
+	if self == nil {
+		return names
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return self[cmd.GetSub(names[i])].best > self[cmd.GetSub(names[j])].best
+	})
+	return names
+}
+
+// The matched parts are highlighted if the commands are ranked
 func dumpCmd(
 	screen core.Screen,
 	env *core.Env,
 	cmd *core.CmdTree,
 	args *DumpCmdArgs,
-	indentAdjust int) {
+	indentAdjust int,
+	ranked rankedCmds) {
 
 	if cmd == nil || cmd.IsHidden() {
 		return
@@ -215,7 +315,13 @@ func dumpCmd(
 		screen.Print(padding + msg + "\n")
 	}
 
-	if cmd.Parent() == nil || args.MatchFind(cmd) {
+	matched := args.MatchFind(cmd)
+	if ranked != nil {
+		matched = ranked[cmd].score > 0
+	}
+	matches := ranked[cmd].matches
+
+	if cmd.Parent() == nil || matched {
 		cic := cmd.Cmd()
 		var name string
 		abbrs := cmd.Abbrs()
@@ -231,7 +337,7 @@ func dumpCmd(
 		}
 
 		if !args.Flatten || cic != nil {
-			prt(0, ColorCmd("["+name+"]", env))
+			prt(0, colorHits("["+name+"]", matchHits(matches, "name", "path"), ColorCmd, env))
 
 			if (!args.Skeleton || args.FindByTags) && len(cmd.Tags()) != 0 {
 				prt(1, ColorTag(" "+tagMark+strings.Join(cmd.Tags(), " "+tagMark), env))
@@ -246,10 +352,38 @@ func dumpCmd(
 					helpStr = cic.DisplayHelpStr()
 				}
 				if len(helpStr) != 0 {
-					prt(1, " "+ColorHelp("'"+helpStr+"'", env))
+					prt(1, " "+colorHits("'"+helpStr+"'", matchHits(matches, "help"), ColorHelp, env))
+				}
+				if cic.IsAlias() {
+					prt(1, ColorProp("- alias-of:", env))
+					prt(2, ColorCmd(cic.Redirect(), env))
+				} else if len(cic.Redirect()) != 0 {
+					prt(1, ColorProp("- redirect:", env))
+					prt(2, ColorCmd(cic.Redirect(), env))
+				}
+				if cic.IsDeprecated() {
+					prt(1, ColorProp("- deprecated:", env))
+					msg := cic.DeprecatedMsg()
+					if len(msg) == 0 {
+						msg = "(no message)"
+					}
+					prt(2, ColorWarn(msg, env))
 				}
 			}
 
+			var otherMatches []core.FindMatch
+			for _, match := range matches {
+				if match.Field != "name" && match.Field != "path" && match.Field != "help" {
+					otherMatches = append(otherMatches, match)
+				}
+			}
+			if len(otherMatches) != 0 {
+				prt(1, ColorProp("- matched:", env))
+			}
+			for _, match := range otherMatches {
+				prt(2, match.Field+": "+colorHits(match.Value, []string{match.Hit}, nil, env))
+			}
+
 			full := cmd.DisplayPath()
 			if cmd.Parent() != nil && cmd.Parent().Parent() != nil {
 				if !args.Skeleton && !args.Flatten && full != name {
@@ -311,7 +445,11 @@ func dumpCmd(
 				prt(1, ColorProp("- os-cmd-dep:", env))
 			}
 			for _, dep := range deps {
-				prt(2, ColorCmdDone(dep.OsCmd, env)+ColorSymbol(" = ", env)+dep.Reason)
+				line := ColorCmdDone(dep.OsCmd, env) + ColorSymbol(" = ", env) + dep.Reason
+				if len(dep.Version) != 0 {
+					line += ColorSymbol(" (version "+dep.Version+")", env)
+				}
+				prt(2, line)
 			}
 
 			// TODO: a bit messy
@@ -324,6 +462,9 @@ func dumpCmd(
 				if cic.IsPriority() {
 					line += " (priority)"
 				}
+				if cic.IsWorker() {
+					line += " (worker)"
+				}
 				prt(1, ColorProp("- cmd-type:", env))
 				prt(2, line)
 			}
@@ -336,6 +477,16 @@ func dumpCmd(
 						for _, flowStr := range cic.FlowStrs() {
 							prt(2, ColorFlow(flowStr, env))
 						}
+						if cic.IsScoped() {
+							prt(1, ColorProp("- scoped, export:", env))
+							exports := cic.ScopeExports()
+							if len(exports) == 0 {
+								prt(2, ColorDisabled("(none)", env))
+							}
+							for _, key := range exports {
+								prt(2, ColorKey(key, env))
+							}
+						}
 					}
 					if len(cic.CmdLine()) != 0 {
 						if cic.Type() == core.CmdTypeEmptyDir {
@@ -347,6 +498,10 @@ func dumpCmd(
 						}
 						prt(2, cic.CmdLine())
 					}
+					if cic.Type() == core.CmdTypeRpc {
+						prt(1, ColorProp("- rpc-method:", env))
+						prt(2, cic.RpcMethod())
+					}
 				}
 			}
 
@@ -369,8 +524,58 @@ func dumpCmd(
 	}
 
 	if args.Recursive {
-		for _, name := range cmd.SubNames() {
-			dumpCmd(screen, env, cmd.GetSub(name), args, indentAdjust)
+		for _, name := range ranked.subNames(cmd) {
+			dumpCmd(screen, env, cmd.GetSub(name), args, indentAdjust, ranked)
+		}
+	}
+}
+
+func matchHits(matches []core.FindMatch, fields ...string) (hits []string) {
+	for _, match := range matches {
+		for _, field := range fields {
+			if match.Field == field {
+				hits = append(hits, match.Hit)
+			}
+		}
+	}
+	return
+}
+
+// Highlight the first occurrence of each hit, colorize the rest of the text by 'color' if it's not nil
+func colorHits(
+	text string,
+	hits []string,
+	color func(string, *core.Env) string,
+	env *core.Env) string {
+
+	if color == nil {
+		color = func(origin string, env *core.Env) string {
+			return origin
+		}
+	}
+	marked := make([]bool, len(text))
+	for _, hit := range hits {
+		i := strings.Index(text, hit)
+		if len(hit) == 0 || i < 0 {
+			continue
+		}
+		for j := i; j < i+len(hit); j++ {
+			marked[j] = true
+		}
+	}
+
+	var res string
+	for start := 0; start < len(text); {
+		end := start
+		for end < len(text) && marked[end] == marked[start] {
+			end += 1
+		}
+		if marked[start] {
+			res += ColorMatched(text[start:end], env)
+		} else {
+			res += color(text[start:end], env)
 		}
+		start = end
 	}
+	return res
 }
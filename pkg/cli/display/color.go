@@ -32,6 +32,7 @@ func ColorExtraLen(env *core.Env, types ...string) (res int) {
 		"flowing":  2,
 		"enabled":  2,
 		"disabled": 3,
+		"matched":  3,
 	}
 	for _, it := range types {
 		extra, ok := lens[it]
@@ -111,6 +112,10 @@ func ColorFlowing(origin string, env *core.Env) string {
 	return colorize(origin, fromColor256(81), env)
 }
 
+func ColorMatched(origin string, env *core.Env) string {
+	return colorize(origin, fromColor256(226), env)
+}
+
 func DecodeColor(text string, env *core.Env) string {
 	for {
 		prefix := strings.Index(text, colorEncodePrefix)
@@ -4,16 +4,70 @@ import (
 	"fmt"
 	"os/exec"
 	"sort"
+	"strings"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
 )
 
-func GatherOsCmdsExistingInfo(deps core.Depends) (foundOsCmds map[string]bool, osCmds []string, missedOsCmds int) {
+type OsCmdState struct {
+	Exists   bool
+	Version  string
+	Required []string
+	// The reason why version is not satisfied, empty if it's satisfied
+	VersionErr string
+}
+
+func (self OsCmdState) Satisfied() bool {
+	return self.Exists && len(self.VersionErr) == 0
+}
+
+func CheckOsCmd(probes *core.VersionProbes, deps core.Depends, osCmd string) (state OsCmdState) {
+	state.Exists = isOsCmdExists(osCmd)
+	state.Required = deps.VersionConstraints(osCmd)
+	if !state.Exists || len(state.Required) == 0 {
+		return
+	}
+	version, err := probes.Probe(deps.VersionProbe(osCmd), deps.VersionPattern(osCmd))
+	if err != nil {
+		state.VersionErr = err.Error()
+		return
+	}
+	state.Version = version
+	for _, constraint := range state.Required {
+		ok, err := core.CheckVersionConstraint(version, constraint)
+		if err != nil {
+			state.VersionErr = err.Error()
+			return
+		}
+		if !ok {
+			state.VersionErr = "not match '" + constraint + "'"
+			return
+		}
+	}
+	return
+}
+
+func GatherOsCmdsExistingInfo(
+	probes *core.VersionProbes,
+	deps core.Depends) (foundOsCmds map[string]bool, osCmds []string, missedOsCmds int) {
+
+	states, osCmds, missedOsCmds := gatherOsCmdStates(probes, deps)
 	foundOsCmds = map[string]bool{}
+	for osCmd, state := range states {
+		foundOsCmds[osCmd] = state.Satisfied()
+	}
+	return
+}
+
+func gatherOsCmdStates(
+	probes *core.VersionProbes,
+	deps core.Depends) (states map[string]OsCmdState, osCmds []string, missedOsCmds int) {
+
+	states = map[string]OsCmdState{}
 	for osCmd, _ := range deps {
-		exists := isOsCmdExists(osCmd)
-		foundOsCmds[osCmd] = exists
-		if !exists {
+		state := CheckOsCmd(probes, deps, osCmd)
+		states[osCmd] = state
+		if !state.Satisfied() {
 			missedOsCmds += 1
 		}
 		osCmds = append(osCmds, osCmd)
@@ -23,6 +77,7 @@ func GatherOsCmdsExistingInfo(deps core.Depends) (foundOsCmds map[string]bool, o
 }
 
 func DumpDepends(
+	probes *core.VersionProbes,
 	screen core.Screen,
 	env *core.Env,
 	deps core.Depends) (hasMissedOsCmd bool) {
@@ -31,7 +86,7 @@ func DumpDepends(
 		return
 	}
 
-	foundOsCmds, osCmds, missedOsCmds := GatherOsCmdsExistingInfo(deps)
+	states, osCmds, missedOsCmds := gatherOsCmdStates(probes, deps)
 
 	sep := env.Get("strs.cmd-path-sep").Raw
 
@@ -39,7 +94,7 @@ func DumpDepends(
 		PrintErrTitle(screen, env,
 			"missed depended os-commands.",
 			"",
-			"the needed os-commands below are not installed:")
+			"the needed os-commands below are not installed or versions not matched:")
 	} else {
 		PrintTipTitle(screen, env,
 			"depended os-commands are all installed.",
@@ -47,13 +102,39 @@ func DumpDepends(
 			"this flow need these os-commands below to execute:")
 	}
 
+	installable := false
 	for _, osCmd := range osCmds {
-		if missedOsCmds > 0 && foundOsCmds[osCmd] {
+		state := states[osCmd]
+		if missedOsCmds > 0 && state.Satisfied() {
 			continue
 		}
 		cmds := deps[osCmd]
 		screen.Print(ColorCmd(fmt.Sprintf("[%s]\n", osCmd), env))
 
+		if state.Exists && len(state.Required) != 0 {
+			screen.Print("        " + ColorProp("- version:", env) + "\n")
+			installed := state.Version
+			if len(installed) == 0 {
+				installed = "unknown"
+			}
+			screen.Print("            " + ColorSymbol("installed: ", env) + installed + "\n")
+			screen.Print("            " + ColorSymbol("required: ", env) + strings.Join(state.Required, ", ") + "\n")
+			if len(state.VersionErr) != 0 {
+				screen.Print("            " + ColorError(state.VersionErr, env) + "\n")
+			}
+		}
+
+		if !state.Satisfied() {
+			installs := deps.Installs(osCmd)
+			if len(installs) != 0 {
+				installable = true
+				screen.Print("        " + ColorProp("- install:", env) + "\n")
+				for _, it := range installs {
+					screen.Print("            " + ColorSymbol(it.Installer+": ", env) + it.Target + "\n")
+				}
+			}
+		}
+
 		// TODO: sort cmds
 		for _, info := range cmds {
 			screen.Print("        " + ColorHelp(fmt.Sprintf("'%s'\n", info.Reason), env))
@@ -61,6 +142,12 @@ func DumpDepends(
 		}
 	}
 
+	if installable {
+		screen.Print("\n" + ColorTip("[tip]", env) + " some of them could be installed automatically:\n")
+		for _, line := range SuggestInstallDeps(env) {
+			screen.Print("    " + line + "\n")
+		}
+	}
 	return missedOsCmds > 0
 }
 
@@ -0,0 +1,189 @@
+package display
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+const didYouMeanLimit = 5
+
+// Find command paths with a name or abbr close to the mistyped word (the first of 'path'),
+// search the subs of 'branch' first, then the whole tree from 'root' if nothing found.
+// The rest of 'path' are appended to the found ones as long as they could be matched
+func SimilarCmdPaths(root *core.CmdTree, branch *core.CmdTree, path []string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+	word := path[0]
+	var candidates []similarCandidate
+	addSubs := func(node *core.CmdTree) {
+		for _, name := range node.SubNames() {
+			sub := node.GetSub(name)
+			if sub.IsHidden() {
+				continue
+			}
+			found := sub
+			for _, seg := range path[1:] {
+				next := found.GetSub(seg)
+				if next == nil {
+					break
+				}
+				found = next
+			}
+			for _, abbr := range append([]string{name}, node.SubAbbrs(name)...) {
+				candidates = append(candidates, similarCandidate{abbr, found.DisplayPath()})
+			}
+		}
+	}
+	if branch != nil {
+		addSubs(branch)
+		similar := closestCandidates(word, candidates)
+		if len(similar) != 0 {
+			return similar
+		}
+	}
+	if root != nil {
+		var walk func(node *core.CmdTree)
+		walk = func(node *core.CmdTree) {
+			if node.IsHidden() {
+				return
+			}
+			addSubs(node)
+			for _, name := range node.SubNames() {
+				walk(node.GetSub(name))
+			}
+		}
+		walk(root)
+	}
+	return closestCandidates(word, candidates)
+}
+
+func SimilarArgNames(args core.Args, word string, abbrsSep string) []string {
+	var candidates []similarCandidate
+	for _, name := range args.Names() {
+		abbrs := args.Abbrs(name)
+		for _, abbr := range abbrs {
+			candidates = append(candidates, similarCandidate{abbr, strings.Join(abbrs, abbrsSep)})
+		}
+	}
+	return closestCandidates(word, candidates)
+}
+
+func SimilarEnvKeys(abbrs *core.EnvAbbrs, key string) []string {
+	var candidates []similarCandidate
+	var walk func(node *core.EnvAbbrs)
+	walk = func(node *core.EnvAbbrs) {
+		for _, name := range node.SubNames() {
+			sub := node.GetSub(name)
+			candidates = append(candidates, similarCandidate{sub.DisplayPath(), sub.DisplayPath()})
+			walk(sub)
+		}
+	}
+	if abbrs != nil {
+		walk(abbrs)
+	}
+	return closestCandidates(key, candidates)
+}
+
+func didYouMeanLines(similar []string) []string {
+	if len(similar) == 0 {
+		return nil
+	}
+	lines := []string{"", "did you mean:", ""}
+	for _, it := range similar {
+		lines = append(lines, rpt(" ", 4)+it)
+	}
+	return lines
+}
+
+// The words of the error position, cut by the seps
+func parseErrWords(result core.ParseResult, seps string) []string {
+	return strings.FieldsFunc(parseErrInput(result), func(r rune) bool {
+		return strings.ContainsRune(seps, r)
+	})
+}
+
+// The keys (before kv-sep) in the error position, or the first word if no keys
+func parseErrKeys(result core.ParseResult, env *core.Env) (keys []string) {
+	kvSep := env.GetRaw("strs.env-kv-sep")
+	brackets := env.GetRaw("strs.env-bracket-left") + env.GetRaw("strs.env-bracket-right")
+	input := strings.ReplaceAll(parseErrInput(result), kvSep, " "+kvSep+" ")
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ' ' || r == '\t' || strings.ContainsRune(brackets, r)
+	})
+	for i, word := range words {
+		if word == kvSep && i > 0 && words[i-1] != kvSep {
+			keys = append(keys, words[i-1])
+		}
+	}
+	if len(keys) == 0 && len(words) != 0 {
+		keys = append(keys, words[0])
+	}
+	return
+}
+
+func parseErrInput(result core.ParseResult) string {
+	input := strings.Join(result.Input, " ")
+	if result.ErrCol >= 0 && result.ErrCol < len(input) {
+		input = input[result.ErrCol:]
+	}
+	return input
+}
+
+type similarCandidate struct {
+	name    string
+	display string
+}
+
+// Pick the candidates closest to the word, ordered by edit distance, keep the origin order if equal
+func closestCandidates(word string, candidates []similarCandidate) []string {
+	maxDist := similarMaxDistance(word)
+	if maxDist <= 0 {
+		return nil
+	}
+	word = strings.ToLower(word)
+	dists := map[string]int{}
+	var res []string
+	for _, it := range candidates {
+		name := strings.ToLower(it.name)
+		if len(word) < similarShortWordLen && !strings.HasPrefix(name, word[:1]) {
+			continue
+		}
+		dist := core.EditDistance(word, name, maxDist)
+		if dist > maxDist {
+			continue
+		}
+		old, ok := dists[it.display]
+		if !ok {
+			res = append(res, it.display)
+		}
+		if !ok || dist < old {
+			dists[it.display] = dist
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return dists[res[i]] < dists[res[j]]
+	})
+	if len(res) > didYouMeanLimit {
+		res = res[:didYouMeanLimit]
+	}
+	return res
+}
+
+// The short words match almost everything, so they are only matched to the names
+// with the same first char, like abbrs or prefixes (eg: 'dq' to 'dp', 'e' to 'ec')
+const similarShortWordLen = 3
+
+// Abbrs are short, allow one typo for them
+func similarMaxDistance(word string) int {
+	if len(word) == 0 {
+		return 0
+	} else if len(word) < 6 {
+		return 1
+	} else if len(word) < 10 {
+		return 2
+	}
+	return 3
+}
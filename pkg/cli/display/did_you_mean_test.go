@@ -0,0 +1,77 @@
+package display
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestClosestCandidates(t *testing.T) {
+	names := []string{"dp", "deploy", "e", "ec", "echo", "dbg", "destroy", "x"}
+	var candidates []similarCandidate
+	for _, name := range names {
+		candidates = append(candidates, similarCandidate{name, name})
+	}
+
+	test := func(word string, expected ...string) {
+		res := closestCandidates(word, candidates)
+		if strings.Join(res, " ") != strings.Join(expected, " ") {
+			t.Fatalf("%#v: similar %#v != %#v\n", word, res, expected)
+		}
+	}
+
+	// Short words only match the names with the same first char
+	test("dq", "dp")
+	test("d", "dp")
+	test("ex", "e", "ec")
+	test("E", "e", "ec")
+	test("y")
+	test("pd")
+	test("ehco", "echo")
+	test("dpeloy", "deploy")
+	test("deploi", "deploy")
+	test("")
+}
+
+func TestSimilarCmdPaths(t *testing.T) {
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	cluster := tree.AddSub("cluster", "c")
+	cluster.AddSub("deploy", "dp").RegEmptyCmd("deploy a cluster")
+	cluster.AddSub("destroy", "ds").RegEmptyCmd("destroy a cluster")
+	tree.AddSub("echo", "e").RegEmptyCmd("print message")
+
+	test := func(branch *core.CmdTree, path []string, expected ...string) {
+		res := SimilarCmdPaths(tree, branch, path)
+		if strings.Join(res, " ") != strings.Join(expected, " ") {
+			t.Fatalf("%#v: similar %#v != %#v\n", path, res, expected)
+		}
+	}
+
+	test(cluster, []string{"dq"}, "cluster.deploy", "cluster.destroy")
+	test(cluster, []string{"deplyo"}, "cluster.deploy")
+	test(tree, []string{"clustr", "dp"}, "cluster.deploy")
+	test(tree, []string{"ehco"}, "echo")
+	// Not found in the branch, search the whole tree
+	test(cluster, []string{"ecoh"}, "echo")
+	test(tree, []string{"xyz"})
+}
+
+func TestSimilarArgNames(t *testing.T) {
+	tree := core.NewCmdTree(core.CmdTreeStrsForTest())
+	cmd := tree.AddSub("echo").RegEmptyCmd("print message").
+		AddArg("message", "", "msg", "m").
+		AddArg("color", "", "c")
+
+	test := func(word string, expected ...string) {
+		res := SimilarArgNames(cmd.Args(), word, "|")
+		if strings.Join(res, " ") != strings.Join(expected, " ") {
+			t.Fatalf("%#v: similar %#v != %#v\n", word, res, expected)
+		}
+	}
+
+	test("mgs", "message|msg|m")
+	test("mesage", "message|msg|m")
+	test("cl", "color|c")
+	test("x")
+}
@@ -1,6 +1,7 @@
 package display
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
@@ -30,6 +31,69 @@ func DumpEnvFlattenVals(screen core.Screen, env *core.Env, findStrs ...string) {
 	dumpEnvFlattenVals(screen, env, flatten, findStrs...)
 }
 
+func DumpEnvHistory(screen core.Screen, env *core.Env, changes []core.EnvChange, findStrs ...string) {
+	for _, it := range changes {
+		notMatched := false
+		for _, findStr := range findStrs {
+			if strings.Index(it.Key, findStr) < 0 {
+				notMatched = true
+				break
+			}
+		}
+		if notMatched {
+			continue
+		}
+		old := mayQuoteStr(it.Old)
+		if !it.OldExists {
+			old = ColorDisabled("(none)", env)
+		}
+		val := mayQuoteStr(it.New)
+		if it.Deleted {
+			val = ColorDisabled("(deleted)", env)
+		}
+		writer := it.Writer
+		if len(writer) == 0 {
+			writer = "(unknown)"
+		}
+		screen.Print(ColorSymbol(fmt.Sprintf("[%d] ", it.Step), env) +
+			it.Time.Format("15:04:05") + " " + ColorKey(it.Key, env) + ColorSymbol(" = ", env) +
+			old + ColorSymbol(" => ", env) + val + ColorHelp(" by ", env) + ColorCmd(writer, env) + "\n")
+	}
+}
+
+func DumpEnvDiff(screen core.Screen, env *core.Env, left map[string]string, right map[string]string) {
+	keySet := map[string]bool{}
+	for k, _ := range left {
+		keySet[k] = true
+	}
+	for k, _ := range right {
+		keySet[k] = true
+	}
+	var keys []string
+	for k, _ := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		l, inLeft := left[k]
+		r, inRight := right[k]
+		if inLeft && inRight {
+			if l == r {
+				continue
+			}
+			screen.Print(ColorSymbol("~ ", env) + ColorKey(k, env) + ColorSymbol(" = ", env) +
+				mayQuoteStr(l) + ColorSymbol(" => ", env) + mayQuoteStr(r) + "\n")
+		} else if inRight {
+			screen.Print(ColorEnabled("+ ", env) + ColorKey(k, env) + ColorSymbol(" = ", env) +
+				mayQuoteStr(r) + "\n")
+		} else {
+			screen.Print(ColorDisabled("- ", env) + ColorKey(k, env) + ColorSymbol(" = ", env) +
+				mayQuoteStr(l) + "\n")
+		}
+	}
+}
+
 func dumpEnvFlattenVals(screen core.Screen, env *core.Env, flatten map[string]string, findStrs ...string) {
 	var keys []string
 	for k, _ := range flatten {
@@ -0,0 +1,35 @@
+package display
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+)
+
+func TestDumpEnvDiff(t *testing.T) {
+	env := core.NewEnv()
+	env.SetBool("display.color", false)
+
+	test := func(left map[string]string, right map[string]string, expected ...string) {
+		screen := NewCacheScreen()
+		DumpEnvDiff(screen, env, left, right)
+		var lines []string
+		screen.WriteToEx(&core.QuietScreen{}, func(text string, isError bool, textLen int) (string, bool) {
+			lines = append(lines, strings.TrimSuffix(text, "\n"))
+			return text, isError
+		})
+		if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("%#v => %#v:\n%s\n!=\n%s\n", left, right, strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+		}
+	}
+
+	test(map[string]string{"a": "1"}, map[string]string{"a": "1"})
+	test(map[string]string{}, map[string]string{})
+	test(map[string]string{"a": "1", "b": "2", "c": "3"}, map[string]string{"a": "1", "b": "x", "d": "4"},
+		"~ b = 2 => x",
+		"- c = 3",
+		"+ d = 4")
+	test(map[string]string{"a": "x y"}, map[string]string{"a": ""},
+		"~ a = 'x y' => ''")
+}
@@ -22,6 +22,33 @@ func PrintEmptyDirCmdHint(screen core.Screen, env *core.Env, cmd core.ParsedCmd)
 	DumpCmds(last, screen, env, dumpArgs)
 }
 
+// Shown before a deprecated or redirected command runs, so the users could update their flows
+func PrintDeprecatedCmdHint(screen core.Screen, env *core.Env, cmd core.ParsedCmd) {
+	sep := env.GetRaw("strs.cmd-path-sep")
+	name := cmd.DisplayPath(sep, false)
+	var lines []string
+	if from := cmd.RedirectFrom; from != nil && !from.Cmd().IsAlias() {
+		lines = append(lines, fmt.Sprintf("'%v' is redirected to '%v', please use the new one.",
+			from.DisplayPath(), from.Cmd().Redirect()))
+		if len(from.Cmd().DeprecatedMsg()) != 0 {
+			lines = append(lines, "", "    "+from.Cmd().DeprecatedMsg())
+		}
+	}
+	if last := cmd.LastCmd(); last != nil && last.IsDeprecated() {
+		if len(lines) != 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, fmt.Sprintf("'%v' is deprecated.", name))
+		if len(last.DeprecatedMsg()) != 0 {
+			lines = append(lines, "", "    "+last.DeprecatedMsg())
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	PrintTipTitle(screen, env, lines)
+}
+
 func PrintError(cc *core.Cli, env *core.Env, err error) {
 	switch err.(type) {
 	case core.CmdMissedEnvValWhenRenderFlow:
@@ -67,6 +94,22 @@ func PrintError(cc *core.Cli, env *core.Env, err error) {
 		argInfo := getArgInfoLine(env, e.Cmd, e.MissedArg)
 		cc.Screen.Print(rpt(" ", 4) + argInfo + "\n")
 
+	case core.CmdBadTemplateExprWhenRenderFlow:
+		e := err.(core.CmdBadTemplateExprWhenRenderFlow)
+		PrintErrTitle(cc.Screen, env,
+			e.Error(),
+			"",
+			"from repo|dir:",
+			"    - "+e.Source,
+			"file:",
+			"    - "+e.MetaFilePath,
+			"command:",
+			"    - "+e.CmdPath,
+			"error-line:",
+			"    - "+e.RenderingLine,
+			"bad-expression:",
+			"    - "+e.Expr)
+
 	case *core.CmdError:
 		e := err.(*core.CmdError)
 		sep := cc.Cmds.Strs.PathSep
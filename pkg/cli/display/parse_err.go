@@ -39,13 +39,30 @@ func HandleParseResult(
 		inputStr := strings.Join(input, " ")
 
 		switch cmd.ParseResult.Error.(type) {
+		case core.ParseErrTokenize:
+			PrintErrTitle(cc.Screen, env,
+				"parse input failed: "+cmd.ParseResult.Error.Error()+".",
+				parseErrMarkLines(cmd.ParseResult),
+				"",
+				"use '\\' to escape special chars, or quote the value:",
+				"",
+				SuggestEscapeChars(env),
+				"")
+			return false
 		case core.ParseErrExpectNoArg:
 			return PrintCmdByParseError(cc, cmd, env, "doesn't have args")
 		case core.ParseErrEnv:
+			var similar []string
+			for _, key := range parseErrKeys(cmd.ParseResult, env) {
+				similar = append(similar, SimilarArgNames(cmd.Args(), key, cc.Cmds.Strs.AbbrsSep)...)
+				similar = append(similar, SimilarEnvKeys(cc.EnvAbbrs, key)...)
+			}
 			PrintErrTitle(cc.Screen, env,
 				"["+cmd.DisplayPath(cc.Cmds.Strs.PathSep, true)+"] parse env failed.",
 				"",
 				"'"+inputStr+"' is not valid input.",
+				parseErrMarkLines(cmd.ParseResult),
+				didYouMeanLines(similar),
 				"",
 				"env setting examples:",
 				"",
@@ -56,6 +73,19 @@ func HandleParseResult(
 			return PrintCmdByParseError(cc, cmd, env, "parse args failed")
 		case core.ParseErrExpectCmd:
 			return PrintSubCmdByParseError(cc, flow, cmd, env, isSearch)
+		case core.ParseErrRedirect:
+			e := cmd.ParseResult.Error.(core.ParseErrRedirect)
+			PrintErrTitle(cc.Screen, env,
+				"'"+inputStr+"' is not valid input.",
+				parseErrMarkLines(cmd.ParseResult),
+				"",
+				"command '"+e.Cmd.DisplayPath()+"' is redirected to '"+e.Cmd.Cmd().Redirect()+"',",
+				"but the target is not found or redirected in a loop.",
+				"",
+				"check the 'redirect' in the meta file:",
+				"",
+				"    "+e.Cmd.Cmd().MetaFile())
+			return false
 		default:
 			return PrintFindResultByParseError(cc, cmd, env, "")
 		}
@@ -74,10 +104,21 @@ func PrintCmdByParseError(
 	printer := NewTipBoxPrinter(cc.Screen, env, true)
 	input := cmd.ParseResult.Input
 
+	var similar []string
+	if _, ok := cmd.ParseResult.Error.(core.ParseErrExpectArgs); ok {
+		for _, key := range parseErrKeys(cmd.ParseResult, env) {
+			similar = append(similar, SimilarArgNames(cmd.Args(), key, cc.Cmds.Strs.AbbrsSep)...)
+		}
+	}
+	words := parseErrWords(cmd.ParseResult, " \t"+sep+cc.Cmds.Strs.PathAlterSeps)
+	similar = append(similar, SimilarCmdPaths(nil, cmd.LastCmdNode(), words)...)
+
 	printer.PrintWrap(
 		"["+cmdName+"] "+title+".",
 		"",
 		"'"+strings.Join(input, " ")+"' is not valid input.")
+	printer.Prints(parseErrMarkLines(cmd.ParseResult)...)
+	printer.Prints(didYouMeanLines(similar)...)
 	printer.Prints("", "command detail:")
 	printer.Finish()
 	dumpArgs := NewDumpCmdArgs().NoFlatten().NoRecursive()
@@ -98,13 +139,20 @@ func PrintSubCmdByParseError(
 	input := cmd.ParseResult.Input
 
 	last := cmd.LastCmdNode()
+	words := parseErrWords(cmd.ParseResult, " \t"+sep+cc.Cmds.Strs.PathAlterSeps)
 	if last == nil {
-		return PrintFreeSearchResultByParseError(cc, flow, env, isSearch, input...)
+		var similar []string
+		if !isSearch {
+			similar = SimilarCmdPaths(cc.Cmds, cc.Cmds, words)
+		}
+		return PrintFreeSearchResultByParseError(cc, flow, env, isSearch, similar, input...)
 	}
 	printer.PrintWrap(
 		"["+cmdName+"] parse sub command failed.",
 		"",
 		"'"+strings.Join(input, " ")+"' is not valid input.")
+	printer.Prints(parseErrMarkLines(cmd.ParseResult)...)
+	printer.Prints(didYouMeanLines(SimilarCmdPaths(cc.Cmds, last, words))...)
 	if last.HasSub() {
 		printer.Prints("", "commands on branch '"+last.DisplayPath()+"':")
 		dumpArgs := NewDumpCmdArgs().SetSkeleton()
@@ -130,12 +178,14 @@ func PrintFreeSearchResultByParseError(
 	flow *core.ParsedCmds,
 	env *core.Env,
 	isSearch bool,
+	similar []string,
 	findStr ...string) bool {
 
 	selfName := env.GetRaw("strs.self-name")
 	input := findStr
 	inputStr := strings.Join(input, " ")
 	notValidStr := "'" + inputStr + "' is not valid input."
+	notValid := append([]string{notValidStr}, didYouMeanLines(similar)...)
 
 	var lines int
 	for len(input) > 0 {
@@ -151,7 +201,7 @@ func PrintFreeSearchResultByParseError(
 			"search and found commands matched '" + strings.Join(input, " ") + "':",
 		}
 		if !isSearch {
-			helpStr = append([]string{notValidStr, ""}, helpStr...)
+			helpStr = append(append(notValid, ""), helpStr...)
 		}
 		PrintErrTitle(cc.Screen, env, helpStr)
 		screen.WriteTo(cc.Screen)
@@ -165,7 +215,7 @@ func PrintFreeSearchResultByParseError(
 		selfName + " will filter results by kewords from left to right.",
 	}
 	if !isSearch {
-		helpStr = append([]string{notValidStr, ""}, helpStr...)
+		helpStr = append(append(notValid, ""), helpStr...)
 	}
 	PrintErrTitle(cc.Screen, env, helpStr)
 	return false
@@ -205,3 +255,19 @@ func PrintFindResultByParseError(
 	}
 	return false
 }
+
+// Underline the error position of the input
+func parseErrMarkLines(result core.ParseResult) []string {
+	if result.ErrCol < 0 {
+		return nil
+	}
+	markLen := result.ErrLen
+	if markLen <= 0 {
+		markLen = 1
+	}
+	return []string{
+		"",
+		rpt(" ", 4) + strings.Join(result.Input, " "),
+		rpt(" ", 4+result.ErrCol) + rpt("^", markLen),
+	}
+}
@@ -58,6 +58,29 @@ func SuggestListEnv(env *core.Env) []string {
 	}
 }
 
+func SuggestRollbackEnv(env *core.Env) []string {
+	selfName, indent := getSuggestArgs(env)
+	return []string{
+		padR(selfName+" <flow> : e.undo step", indent) + "- roll back session env to before the step",
+	}
+}
+
+func SuggestDiffEnv(env *core.Env) []string {
+	selfName, indent := getSuggestArgs(env)
+	return []string{
+		padR(selfName+" e.diff snap.name session", indent) + "- diff a snapshot with current session env",
+		padR(selfName+" e.diff snap.x snap.y", indent) + "- diff two snapshots",
+	}
+}
+
+func SuggestEscapeChars(env *core.Env) []string {
+	selfName, indent := getSuggestArgs(env)
+	return []string{
+		padR(selfName+" {url=a\\:b}", indent) + "- escape ':' by '\\' (quote it in shell)",
+		padR(selfName+" {url=\"a:b\"}", indent) + "- quote the value (quote it again in shell)",
+	}
+}
+
 func SuggestFindEnv(env *core.Env, subCmd string) []string {
 	selfName, indent := getSuggestArgs(env)
 	return []string{
@@ -97,6 +120,18 @@ func SuggestFindCmdsInRepo(env *core.Env) []string {
 	}
 }
 
+func SuggestAddAlias(env *core.Env, abbr bool) []string {
+	selfName, indent := getSuggestArgs(env)
+	if abbr {
+		return []string{
+			padR(selfName+" cmds.abbrs.add dbg.echo say", indent) + "- then 'dbg.say' is the same as 'dbg.echo'",
+		}
+	}
+	return []string{
+		padR(selfName+" cmds.alias.add dbg.echo say", indent) + "- then 'say' is the same as 'dbg.echo'",
+	}
+}
+
 func SuggestHubAdd(env *core.Env) []string {
 	selfName, indent := getSuggestArgs(env)
 	exampleRepo := env.GetRaw("display.example-https-repo")
@@ -156,6 +191,14 @@ func SuggestDesc(env *core.Env) []string {
 	}
 }
 
+func SuggestInstallDeps(env *core.Env) []string {
+	selfName, indent := getSuggestArgs(env)
+	return []string{
+		padR(selfName+" foo : install-deps", indent) + "- install the missed os-commands of 'foo'",
+		padR(selfName+" foo : install-deps y", indent) + "- install them without confirmation",
+	}
+}
+
 // TODO: no use by now
 /*
 func SuggestFindConfigFlows(env *core.Env) []string {
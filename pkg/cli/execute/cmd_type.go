@@ -29,6 +29,7 @@ func allowCheckEnvOpsFail(flow *core.ParsedCmds) bool {
 		builtin.DumpFlowDepends,
 		builtin.DumpFlowSkeleton,
 		builtin.DumpFlowEnvOpsCheckResult,
+		builtin.InstallFlowDepends,
 	}
 	for _, allow := range allows {
 		if last.IsTheSameFunc(allow) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -21,6 +22,8 @@ type Executor struct {
 	sessionFileName     string
 	callerNameBootstrap string
 	callerNameEntry     string
+	// The session dir created by the last run, a new run in the same process should not reuse it
+	lastSessionDir string
 }
 
 func NewExecutor(
@@ -32,6 +35,7 @@ func NewExecutor(
 		sessionFileName,
 		callerNameBootstrap,
 		callerNameEntry,
+		"",
 	}
 }
 
@@ -66,6 +70,9 @@ func (self *Executor) execute(caller string, cc *core.Cli, bootstrap bool, inner
 		useEnvAbbrs(cc.EnvAbbrs, env, cc.Cmds.Strs.EnvPathSep)
 	}
 	flow := cc.Parser.Parse(cc.Cmds, cc.EnvAbbrs, input...)
+	if journal := env.Journal(); journal != nil {
+		journal.SetWriter(caller)
+	}
 	if flow.GlobalEnv != nil {
 		flow.GlobalEnv.WriteNotArgTo(env, cc.Cmds.Strs.EnvValDelAllMark)
 	}
@@ -92,8 +99,16 @@ func (self *Executor) execute(caller string, cc *core.Cli, bootstrap bool, inner
 
 	display.PrintTolerableErrs(cc.Screen, env, cc.TolerableErrs)
 
-	if !innerCall && !bootstrap && !self.sessionInit(cc, flow, env) {
-		return false
+	if !innerCall && !bootstrap {
+		created, ok := self.sessionInit(cc, flow, env)
+		if !ok {
+			return false
+		}
+		// Also save the session env if the flow failed or panicked,
+		// a nested run in the session of its caller leaves it to the caller
+		if created {
+			defer self.sessionFinish(cc, flow, env)
+		}
 	}
 
 	if !innerCall && !bootstrap {
@@ -147,6 +162,10 @@ func (self *Executor) executeCmd(
 	// But if a mod modified the env, the modifications stay in session level
 	cmdEnv := cmd.GenCmdEnv(env, cc.Cmds.Strs.EnvValDelAllMark)
 
+	if journal := env.Journal(); journal != nil {
+		journal.BeginStep(cmd.DisplayPath(cc.Cmds.Strs.PathSep, true))
+	}
+
 	ln := cc.Screen.OutputNum()
 
 	stackLines := display.PrintCmdStack(bootstrap, cc.Screen, cmd,
@@ -161,6 +180,9 @@ func (self *Executor) executeCmd(
 	}
 
 	last := cmd.LastCmdNode()
+	if last != nil {
+		display.PrintDeprecatedCmdHint(cc.Screen, env, cmd)
+	}
 	start := time.Now()
 	if last != nil {
 		if last.IsNoExecutableCmd() {
@@ -239,18 +261,19 @@ func moveLastPriorityCmdToFront(
 	return flow, true, last.AllowTailModeCall() && len(flow) <= 2, attempTailModeCall
 }
 
-func (self *Executor) sessionInit(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) bool {
+// Use the session of the caller if there is one, or create a new one
+func (self *Executor) sessionInit(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) (created bool, ok bool) {
 	sessionDir := env.GetRaw("session")
 	sessionPath := filepath.Join(sessionDir, self.sessionFileName)
-	if len(sessionDir) != 0 {
+	if len(sessionDir) != 0 && sessionDir != self.lastSessionDir {
 		core.LoadEnvFromFile(env, sessionPath, cc.Cmds.Strs.EnvKeyValSep)
-		return true
+		return false, true
 	}
 
 	sessionsRoot := env.GetRaw("sys.paths.sessions")
 	if len(sessionsRoot) == 0 {
 		cc.Screen.Print("[sessionInit] can't get sessions' root path\n")
-		return false
+		return false, false
 	}
 
 	os.MkdirAll(sessionsRoot, os.ModePerm)
@@ -258,36 +281,58 @@ func (self *Executor) sessionInit(cc *core.Cli, flow *core.ParsedCmds, env *core
 	if err != nil {
 		cc.Screen.Print(fmt.Sprintf("[sessionInit] can't read sessions' root path '%s'\n",
 			sessionsRoot))
-		return false
+		return false, false
 	}
 
-	pid := fmt.Sprintf("%d", os.Getpid())
-
+	// Keep the latest finished sessions, so their env could be compared by "env.diff".
+	// A session is finished if it has the finished mark, or its process is gone.
+	// The env file can't tell, it's written before each step of a running session.
+	// The dir name is "<pid>-<start-time>", one process could run many sessions when ticat is embedded
+	var finished []os.DirEntry
 	for _, dir := range dirs {
-		pid, err := strconv.Atoi(dir.Name())
+		if isSessionFinished(filepath.Join(sessionsRoot, dir.Name())) {
+			finished = append(finished, dir)
+		}
+	}
+	modTime := func(dir os.DirEntry) time.Time {
+		info, err := dir.Info()
 		if err != nil {
-			continue
+			return time.Time{}
 		}
-		err = syscall.Kill(pid, syscall.Signal(0))
-		if err != nil && err == syscall.ESRCH {
+		return info.ModTime()
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return modTime(finished[i]).After(modTime(finished[j]))
+	})
+	keep := env.GetInt("sys.sessions.keep")
+	for i, dir := range finished {
+		if i >= keep {
 			os.RemoveAll(filepath.Join(sessionsRoot, dir.Name()))
 		}
 	}
 
-	sessionDir = filepath.Join(sessionsRoot, pid)
-	err = os.MkdirAll(sessionDir, os.ModePerm)
-	if err != nil && !os.IsExist(err) {
+	// Never reuse a dir, it may be a finished session of the same process
+	for {
+		name := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+		sessionDir = filepath.Join(sessionsRoot, name)
+		err = os.Mkdir(sessionDir, os.ModePerm)
+		if err == nil || !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
 		cc.Screen.Print(fmt.Sprintf("[sessionInit] can't create session dir '%s'\n",
 			sessionDir))
-		return false
+		return false, false
 	}
 
 	env.GetLayer(core.EnvLayerSession).Set("session", sessionDir)
-	return true
+	self.lastSessionDir = sessionDir
+	return true, true
 }
 
-// TODO: clean ti
-// Seems not very useful, no user now.
+// Save the session env and mark the session finished,
+// the env could be compared with other env by "env.diff session.<id>"
 func (self *Executor) sessionFinish(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) bool {
 	sessionDir := env.GetRaw("session")
 	if len(sessionDir) == 0 {
@@ -295,9 +340,28 @@ func (self *Executor) sessionFinish(cc *core.Cli, flow *core.ParsedCmds, env *co
 	}
 	path := filepath.Join(sessionDir, self.sessionFileName)
 	core.SaveEnvToFile(env, path, cc.Cmds.Strs.EnvKeyValSep)
+	file, err := os.Create(filepath.Join(sessionDir, sessionFinishedMark))
+	if err == nil {
+		file.Close()
+	}
 	return true
 }
 
+// The file in a session dir, means the session is finished
+const sessionFinishedMark = "finished"
+
+func isSessionFinished(sessionDir string) bool {
+	pid, err := strconv.Atoi(strings.SplitN(filepath.Base(sessionDir), "-", 2)[0])
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(sessionDir, sessionFinishedMark)); err == nil {
+		return true
+	}
+	err = syscall.Kill(pid, syscall.Signal(0))
+	return err != nil && err == syscall.ESRCH
+}
+
 func verifyEnvOps(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) bool {
 	if len(flow.Cmds) == 0 {
 		return true
@@ -317,11 +381,18 @@ func verifyEnvOps(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) bool {
 }
 
 func verifyOsDepCmds(cc *core.Cli, flow *core.ParsedCmds, env *core.Env) bool {
+	if len(flow.Cmds) != 0 && allowCheckEnvOpsFail(flow) {
+		return true
+	}
+	// Os-commands will not be called in mock or replay mode
+	if env.GetBool("sys.mock") || len(env.GetRaw("sys.replay.from")) != 0 {
+		return true
+	}
 	deps := core.Depends{}
 	env = env.Clone()
 	core.CollectDepends(cc, env, flow, 0, deps, true, builtin.EnvOpCmds())
 	screen := display.NewCacheScreen()
-	hasMissedOsCmds := display.DumpDepends(screen, env, deps)
+	hasMissedOsCmds := display.DumpDepends(cc.VersionProbes, screen, env, deps)
 	if hasMissedOsCmds {
 		screen.WriteTo(cc.Screen)
 		return false
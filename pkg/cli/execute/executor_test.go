@@ -0,0 +1,37 @@
+package execute
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSessionFinished(t *testing.T) {
+	root := t.TempDir()
+	session := func(name string, files ...string) string {
+		dir := filepath.Join(root, name)
+		os.MkdirAll(dir, os.ModePerm)
+		for _, file := range files {
+			ioutil.WriteFile(filepath.Join(dir, file), nil, 0644)
+		}
+		return dir
+	}
+	self := os.Getpid()
+	// Pid max is far less than this on linux, so it's a gone process
+	gone := 1 << 30
+
+	test := func(dir string, expected bool) {
+		if isSessionFinished(dir) != expected {
+			t.Fatalf("%#v: finished should be %v\n", filepath.Base(dir), expected)
+		}
+	}
+
+	// A running session has the env file before each step
+	test(session(fmt.Sprintf("%d-1", self), "env"), false)
+	test(session(fmt.Sprintf("%d-2", self), "env", sessionFinishedMark), true)
+	test(session(fmt.Sprintf("%d-3", gone), "env"), true)
+	test(session(fmt.Sprintf("%d", gone)), true)
+	test(session("not-a-session", sessionFinishedMark), false)
+}
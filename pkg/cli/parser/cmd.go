@@ -39,21 +39,21 @@ func (self *CmdParser) Parse(
 	envAbbrs *core.EnvAbbrs,
 	input []string) (parsed core.ParsedCmd) {
 
-	// Delay err check
-	segs, trivialLvl, err := self.parse(cmds, envAbbrs, input)
+	// Delay err check, the parsing may modify the input, so pass a copy
+	segs, trivialLvl, rest, err := self.parse(cmds, envAbbrs, append([]string(nil), input...))
 
 	curr := core.ParsedCmdSeg{nil, core.MatchedCmd{}}
 	var path []string
 	for _, seg := range segs {
 		if seg.Type == parsedSegTypeEnv {
-			env := seg.Val.(core.ParsedEnv)
+			env := decodeParsedEnv(seg.Val.(core.ParsedEnv))
 			if len(path) != 0 {
 				env.AddPrefix(path, self.cmdSep)
 			}
 			if curr.Env != nil {
 				curr.Env.Merge(env)
 			} else {
-				curr.Env = seg.Val.(core.ParsedEnv)
+				curr.Env = env
 			}
 		} else if seg.Type == parsedSegTypeCmd {
 			matchedCmd := seg.Val.(core.MatchedCmd)
@@ -64,6 +64,11 @@ func (self *CmdParser) Parse(
 				curr.Matched = matchedCmd
 			}
 			path = append(path, matchedCmd.Cmd.Name())
+		} else if seg.Type == parsedSegTypeRedirect {
+			// Keep the first one if redirected more than once
+			if parsed.RedirectFrom == nil {
+				parsed.RedirectFrom = seg.Val.(*core.CmdTree)
+			}
 		} else {
 			// ignore parsedSegTypeSep
 		}
@@ -72,7 +77,7 @@ func (self *CmdParser) Parse(
 		parsed.Segments = append(parsed.Segments, curr)
 	}
 
-	parsed.ParseResult = core.ParseResult{input, err}
+	parsed.ParseResult = newParseResult(input, rest, err)
 	parsed.TrivialLvl = trivialLvl
 	return parsed
 }
@@ -80,7 +85,7 @@ func (self *CmdParser) Parse(
 func (self *CmdParser) parse(
 	cmds *core.CmdTree,
 	envAbbrs *core.EnvAbbrs,
-	input []string) (parsed []parsedSeg, trivialLvl int, err error) {
+	input []string) (parsed []parsedSeg, trivialLvl int, rest []string, err error) {
 
 	var matchedCmdPath []string
 	var curr = cmds
@@ -109,7 +114,7 @@ func (self *CmdParser) parse(
 		env, input, succeeded, err = self.envParser.TryParse(curr, currEnvAbbrs, input)
 		if err != nil {
 			err = fmt.Errorf("[CmdParser.parse] %s: %s", self.displayPath(matchedCmdPath), err.Error())
-			return parsed, trivialLvl, core.ParseErrEnv{err}
+			return parsed, trivialLvl, input, core.ParseErrEnv{err}
 		}
 		if succeeded {
 			if env != nil {
@@ -158,7 +163,45 @@ func (self *CmdParser) parse(
 		if allowSub {
 			// Try to parse input as cmd-seg to sub
 			sub := curr.GetSub(input[0])
-			if sub != nil {
+			if sub != nil && isRedirected(sub) {
+				target := self.redirect(cmds, sub)
+				if target == nil {
+					errStr := "command '" + sub.DisplayPath() + "' is redirected to '" +
+						sub.Cmd().Redirect() + "', but the target is not found or redirected in a loop"
+					err = fmt.Errorf("[CmdParser.parse] %s: %s", self.displayPath(matchedCmdPath), errStr)
+					return parsed, trivialLvl, input, core.ParseErrRedirect{err, sub}
+				}
+				// Replace the matched path with the target's, the envs are kept with the path they belong to
+				var kept []parsedSeg
+				var path []string
+				for _, seg := range parsed {
+					if seg.Type == parsedSegTypeCmd {
+						path = append(path, seg.Val.(core.MatchedCmd).Cmd.Name())
+					} else if seg.Type == parsedSegTypeEnv {
+						env := seg.Val.(core.ParsedEnv)
+						if len(path) != 0 {
+							env.AddPrefix(path, self.cmdSep)
+						}
+						kept = append(kept, seg)
+					} else if seg.Type == parsedSegTypeRedirect {
+						kept = append(kept, seg)
+					}
+				}
+				parsed = append(kept, parsedSeg{parsedSegTypeRedirect, sub})
+				matchedCmdPath = nil
+				currEnvAbbrs = envAbbrs
+				for _, node := range cmdPathNodes(target) {
+					if currEnvAbbrs != nil {
+						currEnvAbbrs = currEnvAbbrs.GetSub(node.Name())
+					}
+					parsed = append(parsed, parsedSeg{parsedSegTypeCmd, core.MatchedCmd{node.Name(), node}})
+					matchedCmdPath = append(matchedCmdPath, node.Name())
+				}
+				curr = target
+				input = input[1:]
+				allowSub = false
+				continue
+			} else if sub != nil {
 				curr = sub
 				if currEnvAbbrs != nil {
 					currEnvAbbrs = currEnvAbbrs.GetSub(input[0])
@@ -169,9 +212,9 @@ func (self *CmdParser) parse(
 				allowSub = false
 				continue
 			} else {
-				errStr := "unknow input '" + strings.Join(input, "") + "', should be sub cmd"
+				errStr := "unknow input '" + EncodedToEscaped(strings.Join(input, "")) + "', should be sub cmd"
 				err = fmt.Errorf("[CmdParser.parse] %s: %s", self.displayPath(matchedCmdPath), errStr)
-				return parsed, trivialLvl, core.ParseErrExpectCmd{err}
+				return parsed, trivialLvl, input, core.ParseErrExpectCmd{err}
 			}
 		} else {
 			// Try to parse cmd args
@@ -183,21 +226,41 @@ func (self *CmdParser) parse(
 				var errStr string
 				if cmdHasArgs(curr) {
 					errStr = "args parse failed"
-					errStr = "unknow input '" + strings.Join(input, " ") + "', " + errStr
+					errStr = "unknow input '" + EncodedToEscaped(strings.Join(input, " ")) + "', " + errStr
 					err = fmt.Errorf("[CmdParser.parse] %s: %s", self.displayPath(matchedCmdPath), errStr)
-					return parsed, trivialLvl, core.ParseErrExpectArgs{err}
+					return parsed, trivialLvl, input, core.ParseErrExpectArgs{err}
 				} else {
 					errStr = "looks like args, but curr cmd has no args"
-					errStr = "unknow input '" + strings.Join(input, " ") + "', " + errStr
+					errStr = "unknow input '" + EncodedToEscaped(strings.Join(input, " ")) + "', " + errStr
 					err = fmt.Errorf("[CmdParser.parse] %s: %s", self.displayPath(matchedCmdPath), errStr)
-					return parsed, trivialLvl, core.ParseErrExpectNoArg{err}
+					return parsed, trivialLvl, input, core.ParseErrExpectNoArg{err}
 				}
 			}
 			break
 		}
 	}
 
-	return parsed, trivialLvl, nil
+	return parsed, trivialLvl, nil, nil
+}
+
+// Follow the redirects of renamed commands, return nil if the target is not found or redirected in a loop
+func (self *CmdParser) redirect(cmds *core.CmdTree, cmd *core.CmdTree) *core.CmdTree {
+	for i := 0; isRedirected(cmd); i++ {
+		if i >= redirectMaxDepth {
+			return nil
+		}
+		path := strings.FieldsFunc(cmd.Cmd().Redirect(), func(r rune) bool {
+			return strings.ContainsRune(self.cmdAlterSeps, r)
+		})
+		if len(path) == 0 {
+			return nil
+		}
+		cmd = cmds.GetSub(path...)
+		if cmd == nil {
+			return nil
+		}
+	}
+	return cmd
 }
 
 func (self *CmdParser) displayPath(matchedCmdPath []string) string {
@@ -214,14 +277,59 @@ const (
 	parsedSegTypeEnv parsedSegType = iota
 	parsedSegTypeCmd
 	parsedSegTypeSep
+	parsedSegTypeRedirect
 )
 
+const redirectMaxDepth = 8
+
 type parsedSeg struct {
 	Type parsedSegType
-	// Val should be 'ParsedEnv' or 'MatchedCmd'
+	// Val should be 'ParsedEnv', 'MatchedCmd' or the redirected '*CmdTree'
 	Val interface{}
 }
 
+// Locate the error position by matching the rest input from the end of the origin input
+func newParseResult(input []string, rest []string, err error) core.ParseResult {
+	var escaped []string
+	for _, it := range input {
+		escaped = append(escaped, EncodedToEscaped(it))
+	}
+	result := core.ParseResult{escaped, err, -1, 0}
+	if err == nil {
+		return result
+	}
+
+	line := strings.Join(escaped, " ")
+	end := len(line)
+	found := false
+	for i := len(rest) - 1; i >= 0; i-- {
+		it := strings.TrimSpace(EncodedToEscaped(rest[i]))
+		if len(it) == 0 {
+			continue
+		}
+		pos := strings.LastIndex(line[:end], it)
+		if pos < 0 {
+			return result
+		}
+		end = pos
+		result.ErrLen = len(it)
+		found = true
+	}
+	if found {
+		result.ErrCol = end
+	}
+	return result
+}
+
+func decodeParsedEnv(env core.ParsedEnv) core.ParsedEnv {
+	decoded := core.ParsedEnv{}
+	for k, v := range env {
+		v.Val = DecodeLiterals(v.Val)
+		decoded[DecodeLiterals(k)] = v
+	}
+	return decoded
+}
+
 func cmdHasArgs(cmd *core.CmdTree) bool {
 	if cmd == nil || cmd.Cmd() == nil {
 		return false
@@ -229,3 +337,15 @@ func cmdHasArgs(cmd *core.CmdTree) bool {
 	args := cmd.Args()
 	return len(args.Names()) != 0
 }
+
+func isRedirected(cmd *core.CmdTree) bool {
+	return cmd != nil && cmd.Cmd() != nil && len(cmd.Cmd().Redirect()) != 0
+}
+
+// The nodes from the one under root to the cmd
+func cmdPathNodes(cmd *core.CmdTree) (nodes []*core.CmdTree) {
+	for it := cmd; it != nil && !it.IsRoot(); it = it.Parent() {
+		nodes = append([]*core.CmdTree{it}, nodes...)
+	}
+	return
+}
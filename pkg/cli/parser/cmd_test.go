@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/pingcap/ticat/pkg/cli/core"
@@ -61,7 +64,7 @@ func TestCmdParserParseSeg(t *testing.T) {
 	}
 
 	test := func(a []string, b []parsedSeg) {
-		parsed, _, _ := parser.parse(root, nil, a)
+		parsed, _, _, _ := parser.parse(root, nil, a)
 		assertEq(a, parsed, b)
 	}
 
@@ -144,7 +147,7 @@ func TestCmdParserParse(t *testing.T) {
 	}
 
 	cmd := func(segs ...core.ParsedCmdSeg) core.ParsedCmd {
-		return core.ParsedCmd{segs, core.ParseResult{nil, nil}, 0, false}
+		return core.ParsedCmd{segs, core.ParseResult{nil, nil, -1, 0}, 0, false, nil}
 	}
 
 	test := func(a []string, b core.ParsedCmd) {
@@ -184,6 +187,104 @@ func TestCmdParserParse(t *testing.T) {
 		cmd(seg("", "a", "b"), seg("X", "X.c"), seg("21", "X.21.d", "X.21.e")))
 }
 
+func TestCmdParserRedirect(t *testing.T) {
+	root := newCmdTree()
+	x := root.AddSub("X")
+	x.AddSub("21", "twenty-one").RegEmptyCmd("target").AddArg("b", "", "bb")
+	x.RegEmptyCmd("target namespace")
+
+	root.AddSub("old").RegEmptyCmd("renamed").SetRedirect("X.21")
+	root.AddSub("Y").AddSub("old").RegEmptyCmd("renamed in branch").SetRedirect("X/21")
+	root.AddSub("ns").RegEmptyCmd("renamed namespace").SetRedirect("X")
+	root.AddSub("chain").RegEmptyCmd("renamed twice").SetRedirect("old")
+	root.AddSub("loop1").RegEmptyCmd("loop").SetRedirect("loop2")
+	root.AddSub("loop2").RegEmptyCmd("loop").SetRedirect("loop1")
+	root.AddSub("self").RegEmptyCmd("loop").SetRedirect("self")
+	root.AddSub("missing").RegEmptyCmd("target not found").SetRedirect("X.22")
+	root.AddSub("alias").RegEmptyCmd("alias").SetAlias("X.21")
+
+	parser := &CmdParser{
+		&EnvParser{Brackets{"{", "}"}, "\t ", "=", "."},
+		".", "./", "\t ", "<root>", "^",
+	}
+
+	// The segments are expected as "name" or "name{env-key,env-key}"
+	test := func(input []string, from string, expected ...string) {
+		parsed := parser.Parse(root, nil, input)
+		if parsed.ParseResult.Error != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", input, parsed.ParseResult.Error)
+		}
+		var segs []string
+		for _, seg := range parsed.Segments {
+			str := seg.Matched.Name
+			if seg.Env != nil {
+				var keys []string
+				for key, _ := range seg.Env {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				str += "{" + strings.Join(keys, ",") + "}"
+			}
+			segs = append(segs, str)
+		}
+		if strings.Join(segs, " ") != strings.Join(expected, " ") {
+			t.Fatalf("%#v: segments %#v != %#v\n", input, segs, expected)
+		}
+		if parsed.RedirectFrom == nil || parsed.RedirectFrom.DisplayPath() != from {
+			t.Fatalf("%#v: redirect from %#v != %#v\n", input, parsed.RedirectFrom, from)
+		}
+		if parsed.LastCmdNode() != x.GetSub("21") && parsed.LastCmdNode() != x {
+			t.Fatalf("%#v: redirected to %#v\n", input, parsed.LastCmdNode().DisplayPath())
+		}
+	}
+
+	// Simple redirect, the envs are kept
+	test([]string{"old"}, "old", "X", "21")
+	test([]string{"{a=V}", "old", "{b=V}"}, "old", "{a}", "X", "21{X.21.b}")
+	test([]string{"Y.old"}, "Y.old", "X", "21")
+	test([]string{"Y{a=V}.old"}, "Y.old", "{Y.a}", "X", "21")
+	// Namespace redirect, the sub commands of the target could be used
+	test([]string{"ns"}, "ns", "X")
+	test([]string{"ns.21"}, "ns", "X", "21")
+	test([]string{"ns", ".", "twenty-one", "{bb=V}"}, "ns", "X", "twenty-one{X.21.b}")
+	// Redirected more than once, keep the first one
+	test([]string{"chain"}, "chain", "X", "21")
+	test([]string{"alias"}, "alias", "X", "21")
+
+	fail := func(input []string, from string) {
+		parsed := parser.Parse(root, nil, input)
+		err, ok := parsed.ParseResult.Error.(core.ParseErrRedirect)
+		if !ok {
+			t.Fatalf("%#v: error %#v is not redirect error\n", input, parsed.ParseResult.Error)
+		}
+		if err.Cmd.DisplayPath() != from {
+			t.Fatalf("%#v: redirect error of %#v != %#v\n", input, err.Cmd.DisplayPath(), from)
+		}
+	}
+
+	// Loops and missing targets
+	fail([]string{"loop1"}, "loop1")
+	fail([]string{"loop2", "{a=V}"}, "loop2")
+	fail([]string{"self"}, "self")
+	fail([]string{"missing"}, "missing")
+}
+
 func newCmdTree() *core.CmdTree {
 	return core.NewCmdTree(core.CmdTreeStrsForTest())
 }
+
+func TestNewParseResultErrCol(t *testing.T) {
+	test := func(input []string, rest []string, col int, length int) {
+		result := newParseResult(input, rest, fmt.Errorf("err"))
+		if result.ErrCol != col || result.ErrLen != length {
+			t.Fatalf("%#v %#v: col,len %v,%v != %v,%v\n", input, rest,
+				result.ErrCol, result.ErrLen, col, length)
+		}
+	}
+
+	test([]string{"aa", "bb", "cc"}, []string{"cc"}, 6, 2)
+	test([]string{"aa", "bb", "cc"}, []string{"bb", "cc"}, 3, 2)
+	test([]string{"aa", "bb", "bb"}, []string{"bb"}, 6, 2)
+	test([]string{"aa", "bb"}, []string{"xx"}, -1, 0)
+	test([]string{"aa", "bb"}, nil, -1, 0)
+}
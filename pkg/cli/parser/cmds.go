@@ -5,13 +5,14 @@ import (
 )
 
 type Parser struct {
+	tokenizer *Tokenizer
 	seqParser *SequenceParser
 	cmdParser *CmdParser
 }
 
 // UPDATE: rewite this with goyacc
 //
-// A very simple implement of command line parsing, lack of char escaping
+// A very simple implement of command line parsing, char escaping and quoting are handled by the tokenizer
 //   * The command line argv list have extra tokenizing info
 //         - An example: a quoted string with space inside
 //         - TODO: how to store this info(to flow file?) and still keep it human-editable ?
@@ -22,8 +23,16 @@ func (self *Parser) Parse(
 	envAbbrs *core.EnvAbbrs,
 	input ...string) *core.ParsedCmds {
 
-	seqs, firstIsGlobal := self.seqParser.Parse(input)
 	flow := core.ParsedCmds{core.ParsedEnv{}, nil, -1, false, false, false}
+
+	encoded, err := self.tokenizer.TokenizeAll(input)
+	if err != nil {
+		result := core.ParseResult{input, core.ParseErrTokenize{err}, err.(TokenizeErr).Col, 1}
+		flow.Cmds = append(flow.Cmds, core.ParsedCmd{nil, result, 0, false, nil})
+		return &flow
+	}
+
+	seqs, firstIsGlobal := self.seqParser.Parse(encoded)
 	for _, seq := range seqs {
 		flow.Cmds = append(flow.Cmds, self.cmdParser.Parse(cmds, envAbbrs, seq))
 	}
@@ -41,6 +50,6 @@ func (self *Parser) Parse(
 	return &flow
 }
 
-func NewParser(seqParser *SequenceParser, cmdParser *CmdParser) *Parser {
-	return &Parser{seqParser, cmdParser}
+func NewParser(tokenizer *Tokenizer, seqParser *SequenceParser, cmdParser *CmdParser) *Parser {
+	return &Parser{tokenizer, seqParser, cmdParser}
 }
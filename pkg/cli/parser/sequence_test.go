@@ -66,6 +66,10 @@ func TestSequenceParserNormalize(t *testing.T) {
 	test([]string{"HTTP:?"}, []string{"HTTP:?"})
 	test([]string{"HTTP://"}, []string{"HTTP://"})
 	test([]string{"Http:?"}, []string{"Http", ":", "?"})
+
+	parser = SequenceParser{":", nil, []string{"//"}}
+	test([]string{"a=http://b"}, []string{"a=http://b"})
+	test([]string{"a=x:y//b"}, []string{"a=x", ":", "y//b"})
 }
 
 func TestSequenceParserBreak(t *testing.T) {
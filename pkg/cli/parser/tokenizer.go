@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer handles char-escaping and quoting before other parsing steps:
+//   - '\' makes the next char a normal char
+//   - the chars inside quotes ('...' or "...") are normal chars, the quotes are removed.
+//     a quote only starts a quoted string at the head of an arg or after a char in 'quoteOpenAfter',
+//     so single quotes in normal words (eg: it's) need no escaping
+//
+// The escaped or quoted non-alphanumeric chars are encoded into private-use runes,
+// so they will never be recognized as syntax chars(sequence-sep, brackets, kv-sep, ...) in parsing,
+// the parsed results will be decoded back in the end.
+type Tokenizer struct {
+	quoteOpenAfter string
+}
+
+func NewTokenizer(quoteOpenAfter string) *Tokenizer {
+	return &Tokenizer{quoteOpenAfter}
+}
+
+type TokenizeErr struct {
+	Str string
+	// The byte offset in the arg
+	Col int
+}
+
+func (self TokenizeErr) Error() string {
+	return self.Str
+}
+
+const (
+	tokenEscapeChar  = '\\'
+	tokenLiteralBase = 0xE000
+)
+
+func (self *Tokenizer) Tokenize(arg string) (encoded string, err error) {
+	var buf strings.Builder
+	var quote byte
+	quoteBegin := -1
+
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			} else {
+				buf.WriteString(encodeLiteralChar(c))
+			}
+			continue
+		}
+		if c == tokenEscapeChar {
+			if i+1 < len(arg) {
+				i += 1
+				buf.WriteString(encodeLiteralChar(arg[i]))
+			} else {
+				buf.WriteByte(c)
+			}
+			continue
+		}
+		if (c == '"' || c == '\'') &&
+			(i == 0 || strings.IndexByte(self.quoteOpenAfter, arg[i-1]) >= 0) {
+			quote = c
+			quoteBegin = i
+			continue
+		}
+		buf.WriteByte(c)
+	}
+
+	if quote != 0 {
+		return "", TokenizeErr{fmt.Sprintf("unclosed quote <%c>", quote), quoteBegin}
+	}
+	return buf.String(), nil
+}
+
+func (self *Tokenizer) TokenizeAll(argv []string) (encoded []string, err error) {
+	col := 0
+	for _, arg := range argv {
+		it, err := self.Tokenize(arg)
+		if err != nil {
+			e := err.(TokenizeErr)
+			e.Col += col
+			return nil, e
+		}
+		encoded = append(encoded, it)
+		col += len(arg) + 1
+	}
+	return
+}
+
+func encodeLiteralChar(c byte) string {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80 {
+		return string([]byte{c})
+	}
+	return string(rune(tokenLiteralBase + int(c)))
+}
+
+func isEncodedLiteral(r rune) bool {
+	return r >= tokenLiteralBase && r < tokenLiteralBase+0x80
+}
+
+// Decode the encoded chars to normal chars, used for the final parsed values
+func DecodeLiterals(str string) string {
+	if !hasEncodedLiterals(str) {
+		return str
+	}
+	var buf strings.Builder
+	for i := 0; i < len(str); {
+		r, n := utf8.DecodeRuneInString(str[i:])
+		if isEncodedLiteral(r) {
+			buf.WriteByte(byte(r - tokenLiteralBase))
+		} else {
+			buf.WriteString(str[i : i+n])
+		}
+		i += n
+	}
+	return buf.String()
+}
+
+// Convert the encoded chars back to escaped format, used for displaying or re-parsing
+func EncodedToEscaped(str string) string {
+	if !hasEncodedLiterals(str) {
+		return str
+	}
+	var buf strings.Builder
+	for i := 0; i < len(str); {
+		r, n := utf8.DecodeRuneInString(str[i:])
+		if isEncodedLiteral(r) {
+			buf.WriteByte(tokenEscapeChar)
+			buf.WriteByte(byte(r - tokenLiteralBase))
+		} else {
+			buf.WriteString(str[i : i+n])
+		}
+		i += n
+	}
+	return buf.String()
+}
+
+// Escape the specified chars (and the escape char and quotes) by '\', the result could be parsed back to the origin
+func EscapeLiterals(str string, specials string) string {
+	specials += string(tokenEscapeChar) + "\"'"
+	if strings.IndexAny(str, specials) < 0 {
+		return str
+	}
+	var buf strings.Builder
+	for i := 0; i < len(str); i++ {
+		if strings.IndexByte(specials, str[i]) >= 0 {
+			buf.WriteByte(tokenEscapeChar)
+		}
+		buf.WriteByte(str[i])
+	}
+	return buf.String()
+}
+
+func hasEncodedLiterals(str string) bool {
+	for _, r := range str {
+		if isEncodedLiteral(r) {
+			return true
+		}
+	}
+	return false
+}
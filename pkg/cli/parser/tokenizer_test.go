@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestTokenizerTokenize(t *testing.T) {
+	tokenizer := NewTokenizer(":{}= \t")
+
+	test := func(arg string, decoded string, escaped string) {
+		encoded, err := tokenizer.Tokenize(arg)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", arg, err)
+		}
+		if DecodeLiterals(encoded) != decoded {
+			t.Fatalf("%#v: decoded %#v != %#v\n", arg, DecodeLiterals(encoded), decoded)
+		}
+		if EncodedToEscaped(encoded) != escaped {
+			t.Fatalf("%#v: escaped %#v != %#v\n", arg, EncodedToEscaped(encoded), escaped)
+		}
+	}
+
+	test("aa", "aa", "aa")
+	test("a:b", "a:b", "a:b")
+	test(`a\:b`, "a:b", `a\:b`)
+	test(`a\\b`, `a\b`, `a\\b`)
+	test(`ab\`, `ab\`, `ab\`)
+	test(`\{a=b\}`, "{a=b}", `\{a=b\}`)
+	test(`"a:b"`, "a:b", `a\:b`)
+	test(`'a b'`, "a b", `a\ b`)
+	test(`{a="x:y"}`, "{a=x:y}", `{a=x\:y}`)
+	test(`{a='x"y'}`, `{a=x"y}`, `{a=x\"y}`)
+	test(`it's`, `it's`, `it's`)
+	test(`"abc123"`, "abc123", "abc123")
+	test(`"中文:"`, "中文:", `中文\:`)
+}
+
+func TestTokenizerTokenizeErr(t *testing.T) {
+	tokenizer := NewTokenizer(":{}= \t")
+
+	test := func(argv []string, col int) {
+		_, err := tokenizer.TokenizeAll(argv)
+		if err == nil {
+			t.Fatalf("%#v: expect error\n", argv)
+		}
+		if err.(TokenizeErr).Col != col {
+			t.Fatalf("%#v: error col %v != %v\n", argv, err.(TokenizeErr).Col, col)
+		}
+	}
+
+	test([]string{`"aa`}, 0)
+	test([]string{`a:'b`}, 2)
+	test([]string{"aa", `{b="c}`}, 6)
+}
+
+func TestEscapeLiterals(t *testing.T) {
+	tokenizer := NewTokenizer(":{}= \t")
+
+	test := func(str string, escaped string) {
+		if EscapeLiterals(str, ":{}=") != escaped {
+			t.Fatalf("%#v: escaped %#v != %#v\n", str, EscapeLiterals(str, ":{}="), escaped)
+		}
+		encoded, err := tokenizer.Tokenize(escaped)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v\n", escaped, err)
+		}
+		if DecodeLiterals(encoded) != str {
+			t.Fatalf("%#v: round trip %#v != %#v\n", str, DecodeLiterals(encoded), str)
+		}
+	}
+
+	test("aa", "aa")
+	test("a:b", `a\:b`)
+	test(`a\b`, `a\\b`)
+	test(`{a="b"}`, `\{a\=\"b\"\}`)
+	test("it's", `it\'s`)
+}
@@ -0,0 +1,66 @@
+package alias_file
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A user defined command path (from root) which is resolved to another command
+type Alias struct {
+	CmdPath string
+	Name    string
+}
+
+func WriteAliasFile(path string, aliases []Alias, sep string) {
+	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		panic(fmt.Errorf("[WriteAliasFile] open file '%s' failed: %v", tmp, err))
+	}
+	defer file.Close()
+
+	for _, alias := range aliases {
+		_, err = fmt.Fprintf(file, "%s%s%s\n", alias.CmdPath, sep, alias.Name)
+		if err != nil {
+			panic(fmt.Errorf("[WriteAliasFile] write file '%s' failed: %v", tmp, err))
+		}
+	}
+	file.Close()
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		panic(fmt.Errorf("[WriteAliasFile] rename file '%s' to '%s' failed: %v",
+			tmp, path, err))
+	}
+}
+
+func ReadAliasFile(path string, sep string) (aliases []Alias) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		panic(fmt.Errorf("[ReadAliasFile] open file '%s' failed: %v", path, err))
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line := strings.Trim(scanner.Text(), "\n\r")
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != 2 {
+			panic(fmt.Errorf("[ReadAliasFile] file '%s' line '%s' can't be parsed",
+				path, line))
+		}
+		aliases = append(aliases, Alias{fields[0], fields[1]})
+	}
+	return
+}
@@ -4,16 +4,50 @@ import (
 	"github.com/pingcap/ticat/pkg/proto/meta_file"
 )
 
-func LoadFlowFile(path string) (flow []string, help string, abbrs string) {
+// An arg declared in the "[args]" section of a flow file, the names are "<name>|<abbr>|<abbr>..."
+type FlowArg struct {
+	Names  string
+	DefVal string
+}
+
+// The raw values of the other keys in a flow file
+type FlowMeta struct {
+	// The env changes in a scoped flow are discarded when it finishes, except the exported keys
+	Scoped  string
+	Exports string
+	// Seperated by spaces, without the tag-mark
+	Tags    string
+	Trivial string
+	// The flow is deprecated or renamed, the same as the mod meta file
+	Deprecated string
+	Redirect   string
+}
+
+func LoadFlowFile(path string) (flow []string, help string, abbrs string, args []FlowArg, flowMeta FlowMeta) {
 	meta := meta_file.NewMetaFile(path)
 	section := meta.GetGlobalSection()
 	help = section.Get("help")
 	abbrs = section.Get("abbrs")
 	flow = section.GetMultiLineVal("flow", false)
+	flowMeta = FlowMeta{section.Get("scoped"), section.Get("export"), section.Get("tags"), section.Get("trivial"),
+		section.Get("deprecated"), section.Get("redirect")}
+	if len(flowMeta.Tags) == 0 {
+		flowMeta.Tags = section.Get("tag")
+	}
+
+	argsSection := meta.GetSection("args")
+	if argsSection == nil {
+		argsSection = meta.GetSection("arg")
+	}
+	if argsSection != nil {
+		for _, names := range argsSection.Keys() {
+			args = append(args, FlowArg{names, argsSection.Get(names)})
+		}
+	}
 	return
 }
 
-func SaveFlowFile(path string, flow []string, help string, abbrs string) {
+func SaveFlowFile(path string, flow []string, help string, abbrs string, args []FlowArg, flowMeta FlowMeta) {
 	meta := meta_file.CreateMetaFile(path)
 	section := meta.GetGlobalSection()
 	if len(help) != 0 {
@@ -22,8 +56,32 @@ func SaveFlowFile(path string, flow []string, help string, abbrs string) {
 	if len(abbrs) != 0 {
 		section.Set("abbrs", abbrs)
 	}
+	if len(flowMeta.Tags) != 0 {
+		section.Set("tags", flowMeta.Tags)
+	}
+	if len(flowMeta.Trivial) != 0 {
+		section.Set("trivial", flowMeta.Trivial)
+	}
+	if len(flowMeta.Scoped) != 0 {
+		section.Set("scoped", flowMeta.Scoped)
+	}
+	if len(flowMeta.Exports) != 0 {
+		section.Set("export", flowMeta.Exports)
+	}
+	if len(flowMeta.Deprecated) != 0 {
+		section.Set("deprecated", flowMeta.Deprecated)
+	}
+	if len(flowMeta.Redirect) != 0 {
+		section.Set("redirect", flowMeta.Redirect)
+	}
 	if len(flow) != 0 {
 		section.SetMultiLineVal("flow", flow)
 	}
+	if len(args) != 0 {
+		argsSection := meta.NewOrGetSection("args")
+		for _, arg := range args {
+			argsSection.Set(arg.Names, arg.DefVal)
+		}
+	}
 	meta.Save()
 }
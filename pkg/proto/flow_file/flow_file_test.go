@@ -0,0 +1,30 @@
+package flow_file
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlowFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.dep.tiflow")
+	flow := []string{"dbg.echo hi", ": dbg.echo bye"}
+	args := []FlowArg{{"msg|m", "hi"}}
+	flowMeta := FlowMeta{"true", "x.y", "ready slow", "2", "use x.new", "x.new"}
+
+	SaveFlowFile(path, flow, "help str", "x.d", args, flowMeta)
+	loadedFlow, help, abbrs, loadedArgs, loadedMeta := LoadFlowFile(path)
+
+	if !reflect.DeepEqual(loadedFlow, flow) {
+		t.Fatalf("flow %#v != %#v\n", loadedFlow, flow)
+	}
+	if help != "help str" || abbrs != "x.d" {
+		t.Fatalf("help, abbrs %#v, %#v != %#v, %#v\n", help, abbrs, "help str", "x.d")
+	}
+	if !reflect.DeepEqual(loadedArgs, args) {
+		t.Fatalf("args %#v != %#v\n", loadedArgs, args)
+	}
+	if loadedMeta != flowMeta {
+		t.Fatalf("meta %#v != %#v\n", loadedMeta, flowMeta)
+	}
+}
@@ -29,3 +29,27 @@ func ReadRepoListFromFile(selfName string, path string) (helpStr string, addrs [
 	}
 	return
 }
+
+// Read the rules of importing OS env vars, format: "<env-key> = <OS-env-var-name>" in section "env.from-os"
+func ReadOsEnvImportRulesFromFile(path string) (keys []string, names []string) {
+	meta, err := meta_file.NewMetaFileEx(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		panic(fmt.Errorf("[ReadOsEnvImportRulesFromFile] read mod meta file '%s' failed: %v", path, err))
+	}
+	rules := meta.GetSection("env.from-os")
+	if rules == nil {
+		return
+	}
+	for _, key := range rules.Keys() {
+		name := rules.Get(key)
+		if len(name) == 0 {
+			continue
+		}
+		keys = append(keys, key)
+		names = append(names, name)
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package hub_meta
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadOsEnvImportRulesFromFile(t *testing.T) {
+	dir := t.TempDir()
+	test := func(content string, expectedKeys []string, expectedNames []string) {
+		path := filepath.Join(dir, "hub.ticat")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write file '%s' failed: %v\n", path, err)
+		}
+		keys, names := ReadOsEnvImportRulesFromFile(path)
+		if !reflect.DeepEqual(keys, expectedKeys) || !reflect.DeepEqual(names, expectedNames) {
+			t.Fatalf("%#v: %#v %#v != %#v %#v\n", content, keys, names, expectedKeys, expectedNames)
+		}
+	}
+
+	// The env keys are explicit and could be renamed from the OS env names, the order is kept
+	test("[env.from-os]\ndeploy.tiup.home = TIUP_HOME\nHOME = HOME\nci.job = CI_JOB_ID\n",
+		[]string{"deploy.tiup.home", "HOME", "ci.job"}, []string{"TIUP_HOME", "HOME", "CI_JOB_ID"})
+	// Rules without OS env names are skipped
+	test("[env.from-os]\na = A\nb =\n", []string{"a"}, []string{"A"})
+	// Only the rules in the section
+	test("help = repos\n[repos]\nx = y\n[env.from-os.x]\na = A\n", nil, nil)
+	test("", nil, nil)
+
+	keys, names := ReadOsEnvImportRulesFromFile(filepath.Join(dir, "not-exists.ticat"))
+	if len(keys) != 0 || len(names) != 0 {
+		t.Fatalf("no rules should be read from a not existing file: %#v %#v\n", keys, names)
+	}
+}
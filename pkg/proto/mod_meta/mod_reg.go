@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -48,6 +49,9 @@ func RegMod(
 
 	regTrivial(meta, mod)
 	regTags(meta, mod)
+	regWorker(meta, cmd)
+	regScope(meta, cmd)
+	regDeprecated(meta, cmd)
 	regArgs(meta, cmd, abbrsSep)
 	regDeps(meta, cmd)
 	regEnvOps(cc.EnvAbbrs, meta, cmd, abbrsSep, envPathSep)
@@ -55,6 +59,24 @@ func RegMod(
 	regArg2Env(cc.EnvAbbrs, meta, cmd, abbrsSep, envPathSep)
 }
 
+func regRpcMod(meta *meta_file.MetaFile, mod *core.CmdTree, rpc string, help string) *core.Cmd {
+	cmdPath := mod.DisplayPath()
+	helper, err := filepath.Abs(filepath.Join(filepath.Dir(meta.Path()), rpc))
+	if err != nil {
+		panic(fmt.Errorf("[regRpcMod] cmd '%s' get abs path of rpc helper '%s' failed",
+			cmdPath, rpc))
+	}
+	if !fileExists(helper) {
+		panic(fmt.Errorf("[regRpcMod] cmd '%s' point to a not existed rpc helper '%s'",
+			cmdPath, helper))
+	}
+	method := meta.Get("method")
+	if len(method) == 0 {
+		method = cmdPath
+	}
+	return mod.RegRpcCmd(helper, method, help)
+}
+
 func regTrivial(meta *meta_file.MetaFile, mod *core.CmdTree) {
 	val := meta.Get("trivial")
 	if len(val) == 0 {
@@ -67,6 +89,71 @@ func regTrivial(meta *meta_file.MetaFile, mod *core.CmdTree) {
 	mod.SetTrivial(trivial)
 }
 
+func regWorker(meta *meta_file.MetaFile, cmd *core.Cmd) {
+	val := meta.Get("worker")
+	if len(val) == 0 {
+		return
+	}
+	worker, err := strconv.ParseBool(val)
+	if err != nil {
+		panic(fmt.Errorf("[regWorker] worker string '%s' is not bool: '%v'", val, err))
+	}
+	if !worker {
+		return
+	}
+	if cmd.Type() != core.CmdTypeFile && cmd.Type() != core.CmdTypeDirWithCmd {
+		panic(fmt.Errorf("[regWorker] cmd '%s' is '%s', only executable files could be workers",
+			cmd.Owner().DisplayPath(), cmd.Type()))
+	}
+	cmd.SetWorker()
+}
+
+// "export" means scoped, "scoped = true" without "export" discards all the env changes of the flow
+func regScope(meta *meta_file.MetaFile, cmd *core.Cmd) {
+	scoped := false
+	val := meta.Get("scoped")
+	if len(val) != 0 {
+		var err error
+		scoped, err = strconv.ParseBool(val)
+		if err != nil {
+			panic(fmt.Errorf("[regScope] scoped string '%s' is not bool: '%v'", val, err))
+		}
+	}
+
+	var exports []string
+	for _, it := range strings.Split(meta.Get("export"), cmd.Owner().Strs.ListSep) {
+		it = strings.TrimSpace(it)
+		if len(it) != 0 {
+			exports = append(exports, it)
+		}
+	}
+	if !scoped && len(exports) == 0 {
+		return
+	}
+
+	if cmd.Type() != core.CmdTypeFlow && cmd.Type() != core.CmdTypeFileNFlow {
+		panic(fmt.Errorf("[regScope] cmd '%s' is '%s', only flows could be scoped",
+			cmd.Owner().DisplayPath(), cmd.Type()))
+	}
+	cmd.SetScoped(exports...)
+}
+
+// "deprecated = <message>" or "deprecated = true", the command still works but shows a banner
+func regDeprecated(meta *meta_file.MetaFile, cmd *core.Cmd) {
+	msg := meta.Get("deprecated")
+	if len(msg) == 0 {
+		return
+	}
+	deprecated, err := strconv.ParseBool(msg)
+	if err == nil {
+		if !deprecated {
+			return
+		}
+		msg = ""
+	}
+	cmd.SetDeprecated(msg)
+}
+
 func regTags(meta *meta_file.MetaFile, mod *core.CmdTree) {
 	tags := meta.Get("tags")
 	if len(tags) == 0 {
@@ -93,12 +180,34 @@ func regMod(
 	cmdLine := meta.Get("cmd")
 
 	help := meta.Get("help")
+
+	// A renamed command could leave a stub pointing to the new path, it needs no help string
+	redirect := meta.Get("redirect")
+	if len(redirect) != 0 {
+		if len(flow) != 0 || len(cmdLine) != 0 || len(meta.Get("rpc")) != 0 ||
+			len(executablePath) != 0 && !isDir {
+			panic(fmt.Errorf("[regMod] cmd '%s' is redirected to '%s', can't have executable or flow",
+				cmdPath, redirect))
+		}
+		return mod.RegEmptyCmd(help).SetRedirect(redirect)
+	}
+
 	// If has executable file, it need to have help string, a flow can have not
 	if len(help) == 0 && (!isDir && len(flow) == 0 || len(cmdLine) != 0) {
 		panic(fmt.Errorf("[regMod] cmd '%s' has no help string in '%s'",
 			cmdPath, meta.Path()))
 	}
 
+	// Served by a long-running helper process, 'rpc' is a relative path base on this file
+	rpc := meta.Get("rpc")
+	if len(rpc) != 0 {
+		if len(flow) != 0 || len(cmdLine) != 0 || len(executablePath) != 0 && !isDir {
+			panic(fmt.Errorf("[regMod] cmd '%s' has rpc helper '%s', can't have executable or flow",
+				cmdPath, rpc))
+		}
+		return regRpcMod(meta, mod, rpc, help)
+	}
+
 	// Even if 'isFlow' is true, if it does not have 'flow' content, it can't reg as flow
 	if len(flow) != 0 && len(cmdLine) == 0 && len(executablePath) == 0 {
 		return mod.RegFlowCmd(flow, help)
@@ -217,6 +326,56 @@ func regDeps(meta *meta_file.MetaFile, cmd *core.Cmd) {
 			cmd.AddDepend(dep, reason)
 		}
 	}
+	regDepVersions(meta, cmd)
+	regDepInstalls(meta, cmd)
+}
+
+// Section "[dep.version]": "os-cmd = >= 1.2.3",
+// section "[dep.probe]": "os-cmd = <command to print version>", "os-cmd.pattern = <regexp to extract version>"
+func regDepVersions(meta *meta_file.MetaFile, cmd *core.Cmd) {
+	versions := meta.GetSection("dep.version")
+	if versions == nil {
+		versions = meta.GetSection("deps.version")
+	}
+	if versions == nil {
+		return
+	}
+	probes := meta.GetSection("dep.probe")
+	if probes == nil {
+		probes = meta.GetSection("deps.probe")
+	}
+	for _, dep := range versions.Keys() {
+		var probe string
+		var pattern string
+		if probes != nil {
+			probe = probes.Get(dep)
+			pattern = probes.Get(dep + ".pattern")
+		}
+		cmd.SetDependVersion(dep, versions.Get(dep), probe, pattern)
+	}
+}
+
+// Sections like "[install.apt]", keys are os-commands, values are package names or ticat commands
+func regDepInstalls(meta *meta_file.MetaFile, cmd *core.Cmd) {
+	installPrefix := "install."
+	var installers []string
+	for name, _ := range meta.GetAll() {
+		if strings.HasPrefix(name, installPrefix) {
+			installers = append(installers, name)
+		}
+	}
+	sort.Strings(installers)
+	for _, name := range installers {
+		section := meta.GetSection(name)
+		installer := strings.TrimSpace(name[len(installPrefix):])
+		if !core.IsDependInstaller(installer) {
+			panic(fmt.Errorf("[regDepInstalls] cmd '%s' has unknown installer section '[%s]', should be one of: %s",
+				cmd.Owner().DisplayPath(), name, strings.Join(core.DependInstallers, ", ")))
+		}
+		for _, dep := range section.Keys() {
+			cmd.AddDependInstall(dep, installer, section.Get(dep))
+		}
+	}
 }
 
 func regEnvOps(
@@ -0,0 +1,53 @@
+package mod_meta
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/proto/meta_file"
+)
+
+func TestRegDepInstalls(t *testing.T) {
+	dir := t.TempDir()
+	load := func(content string) (*core.Cmd, error) {
+		path := filepath.Join(dir, "x.ticat")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write file '%s' failed: %v\n", path, err)
+		}
+		cmd := core.NewCmdTree(core.CmdTreeStrsForTest()).AddSub("x").RegFileCmd(path, "x")
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = r.(error)
+				}
+			}()
+			regDeps(meta_file.NewMetaFile(path), cmd)
+		}()
+		return cmd, err
+	}
+
+	cmd, err := load("[dep]\nmysql = client\n[install.apt]\nmysql = mysql-client\n[install.cmd]\nmysql = install.mysql\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	installs := cmd.GetDepends()[0].Installs
+	if len(installs) != 2 || installs[0] != (core.DependInstall{"apt", "mysql-client"}) ||
+		installs[1] != (core.DependInstall{"cmd", "install.mysql"}) {
+		t.Fatalf("bad installs: %#v\n", installs)
+	}
+
+	for _, content := range []string{
+		// Unknown installer
+		"[dep]\nmysql = client\n[install.pip]\nmysql = mysql-connector\n",
+		"[dep]\nmysql = client\n[install.]\nmysql = mysql-client\n",
+		// Not a depended os-command
+		"[dep]\nmysql = client\n[install.apt]\ngit = git\n",
+	} {
+		if _, err := load(content); err == nil {
+			t.Fatalf("%#v: should be failed\n", content)
+		}
+	}
+}
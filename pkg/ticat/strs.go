@@ -0,0 +1,87 @@
+package ticat
+
+// The strings and separators used by ticat, they could be customized before creating a TiCat
+type Strs struct {
+	SelfName                 string
+	ListSep                  string
+	CmdRootDisplayName       string
+	CmdBuiltinDisplayName    string
+	Spaces                   string
+	AbbrsSep                 string
+	EnvOpSep                 string
+	SequenceSep              string
+	CmdPathSep               string
+	CmdPathAlterSeps         string
+	EnvBracketLeft           string
+	EnvBracketRight          string
+	EnvKeyValSep             string
+	EnvPathSep               string
+	EnvValDelAllMark         string
+	EnvRuntimeSysPrefix      string
+	EnvStrsPrefix            string
+	EnvFileName              string
+	ProtoSep                 string
+	ModsRepoExt              string
+	MetaExt                  string
+	FlowExt                  string
+	HelpExt                  string
+	HubFileName              string
+	ReposFileName            string
+	AbbrsFileName            string
+	AliasesFileName          string
+	SessionEnvFileName       string
+	FlowTemplateBracketLeft  string
+	FlowTemplateBracketRight string
+	FlowTemplateMultiplyMark string
+	TagMark                  string
+	TrivialMark              string
+	TagOutOfTheBox           string
+	TagProvider              string
+	TagSelfTest              string
+}
+
+const DefaultSelfName string = "ticat"
+
+// The file exts of modules and repos are derived from the self name
+func NewStrs(selfName string) *Strs {
+	tagMark := "@"
+	return &Strs{
+		SelfName:              selfName,
+		ListSep:               ",",
+		CmdRootDisplayName:    "<root>",
+		CmdBuiltinDisplayName: "<builtin>",
+		Spaces:                "\t\n\r ",
+		AbbrsSep:              "|",
+		EnvOpSep:              ":",
+		SequenceSep:           ":",
+		CmdPathSep:            ".",
+		//CmdPathAlterSeps:         "./",
+		CmdPathAlterSeps:         ".",
+		EnvBracketLeft:           "{",
+		EnvBracketRight:          "}",
+		EnvKeyValSep:             "=",
+		EnvPathSep:               ".",
+		EnvValDelAllMark:         "--",
+		EnvRuntimeSysPrefix:      "sys",
+		EnvStrsPrefix:            "strs",
+		EnvFileName:              "bootstrap.env",
+		ProtoSep:                 "\t",
+		ModsRepoExt:              "." + selfName,
+		MetaExt:                  "." + selfName,
+		FlowExt:                  ".tiflow",
+		HelpExt:                  ".tihelp",
+		HubFileName:              "repos.hub",
+		ReposFileName:            "hub.ticat",
+		AbbrsFileName:            "abbrs",
+		AliasesFileName:          "aliases",
+		SessionEnvFileName:       "env",
+		FlowTemplateBracketLeft:  "[[",
+		FlowTemplateBracketRight: "]]",
+		FlowTemplateMultiplyMark: "*",
+		TagMark:                  tagMark,
+		TrivialMark:              "^",
+		TagOutOfTheBox:           tagMark + "ready",
+		TagProvider:              tagMark + "config",
+		TagSelfTest:              tagMark + "selftest",
+	}
+}
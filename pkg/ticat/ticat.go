@@ -0,0 +1,188 @@
+package ticat
+
+import (
+	"strings"
+
+	"github.com/pingcap/ticat/pkg/builtin"
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+	"github.com/pingcap/ticat/pkg/cli/execute"
+	"github.com/pingcap/ticat/pkg/cli/parser"
+)
+
+// A ready-to-run ticat, other go programs could embed it:
+//
+//	tc := ticat.NewTiCat()
+//	tc.Cmds().AddSub("my-cmd").RegPowerCmd(MyCmd, "my command")
+//	os.Exit(tc.Run(os.Args[1:]...))
+type TiCat struct {
+	Strs      *Strs
+	Cli       *core.Cli
+	Bootstrap string
+	executor  *execute.Executor
+}
+
+func NewTiCat() *TiCat {
+	return NewTiCatEx(NewStrs(DefaultSelfName), execute.NewScreen(), "")
+}
+
+// If dataDir is empty, "<path-of-executable>.data" will be used
+func NewTiCatEx(strs *Strs, screen core.Screen, dataDir string) *TiCat {
+	globalEnv := core.NewEnv().NewLayers(
+		core.EnvLayerDefault,
+		core.EnvLayerPersisted,
+		core.EnvLayerOs,
+		core.EnvLayerSession,
+	)
+	// Record env changes in session for tracing and rolling back
+	globalEnv.EnableJournal()
+	builtin.LoadDefaultEnv(globalEnv)
+
+	// Any mod could get the specific string val from env when it's called
+	defEnv := globalEnv.GetLayer(core.EnvLayerDefault)
+	defEnv.Set("strs.self-name", strs.SelfName)
+	defEnv.Set("strs.list-sep", strs.ListSep)
+	defEnv.Set("strs.cmd-builtin-display-name", strs.CmdBuiltinDisplayName)
+	defEnv.Set("strs.meta-ext", strs.MetaExt)
+	defEnv.Set("strs.flow-ext", strs.FlowExt)
+	defEnv.Set("strs.help-ext", strs.HelpExt)
+	defEnv.Set("strs.abbrs-sep", strs.AbbrsSep)
+	defEnv.Set("strs.seq-sep", strs.SequenceSep)
+	defEnv.Set("strs.cmd-path-sep", strs.CmdPathSep)
+	defEnv.Set("strs.env-path-sep", strs.EnvPathSep)
+	defEnv.Set("strs.env-op-sep", strs.EnvOpSep)
+	defEnv.Set("strs.env-sys-path", strs.EnvRuntimeSysPrefix)
+	defEnv.Set("strs.env-strs-path", strs.EnvStrsPrefix)
+	defEnv.Set("strs.env-kv-sep", strs.EnvKeyValSep)
+	defEnv.Set("strs.env-bracket-left", strs.EnvBracketLeft)
+	defEnv.Set("strs.env-bracket-right", strs.EnvBracketRight)
+	defEnv.Set("strs.env-file-name", strs.EnvFileName)
+	defEnv.Set("strs.session-env-file", strs.SessionEnvFileName)
+	defEnv.Set("strs.hub-file-name", strs.HubFileName)
+	defEnv.Set("strs.repos-file-name", strs.ReposFileName)
+	defEnv.Set("strs.abbrs-file-name", strs.AbbrsFileName)
+	defEnv.Set("strs.aliases-file-name", strs.AliasesFileName)
+	defEnv.Set("strs.mods-repo-ext", strs.ModsRepoExt)
+	defEnv.Set("strs.proto-sep", strs.ProtoSep)
+	defEnv.Set("strs.tag-out-of-the-box", strs.TagOutOfTheBox)
+	defEnv.Set("strs.tag-provider", strs.TagProvider)
+	defEnv.Set("strs.tag-self-test", strs.TagSelfTest)
+	defEnv.Set("strs.flow-template-bracket-left", strs.FlowTemplateBracketLeft)
+	defEnv.Set("strs.flow-template-bracket-right", strs.FlowTemplateBracketRight)
+	defEnv.Set("strs.flow-template-multiply-mark", strs.FlowTemplateMultiplyMark)
+	defEnv.Set("strs.tag-mark", strs.TagMark)
+	defEnv.Set("strs.trivial-mark", strs.TrivialMark)
+	if len(dataDir) != 0 {
+		defEnv.Set("sys.paths.data", dataDir)
+	}
+
+	// The available cmds are organized in a tree, will grow bigger after running bootstrap
+	tree := core.NewCmdTree(&core.CmdTreeStrs{
+		strs.SelfName,
+		strs.CmdRootDisplayName,
+		strs.CmdBuiltinDisplayName,
+		strs.CmdPathSep,
+		strs.CmdPathAlterSeps,
+		strs.AbbrsSep,
+		strs.EnvOpSep,
+		strs.EnvValDelAllMark,
+		strs.EnvKeyValSep,
+		strs.EnvPathSep,
+		strs.ProtoSep,
+		strs.ListSep,
+		strs.FlowTemplateBracketLeft,
+		strs.FlowTemplateBracketRight,
+		strs.FlowTemplateMultiplyMark,
+		strs.TagMark,
+	})
+	builtin.RegisterCmds(tree)
+
+	// Extra abbrs definition
+	abbrs := core.NewEnvAbbrs(strs.CmdRootDisplayName)
+	builtin.LoadEnvAbbrs(abbrs)
+
+	// A simple parser, should be insteaded in the future
+	tokenizer := parser.NewTokenizer(
+		strs.SequenceSep + strs.EnvBracketLeft + strs.EnvKeyValSep + strs.Spaces)
+	// Not break by "://" for URLs, other special chars in values need escaping or quoting
+	seqParser := parser.NewSequenceParser(
+		strs.SequenceSep,
+		nil,
+		[]string{"//"},
+	)
+	envParser := parser.NewEnvParser(
+		parser.Brackets{strs.EnvBracketLeft, strs.EnvBracketRight},
+		strs.Spaces,
+		strs.EnvKeyValSep,
+		strs.EnvPathSep)
+	cmdParser := parser.NewCmdParser(
+		envParser,
+		strs.CmdPathSep,
+		strs.CmdPathAlterSeps,
+		strs.Spaces,
+		strs.CmdRootDisplayName,
+		strs.TrivialMark)
+	cliParser := parser.NewParser(tokenizer, seqParser, cmdParser)
+
+	// The Cli is a service set, the builtin mods will receive it as a arg when being called
+	cc := core.NewCli(globalEnv, screen, tree, cliParser, abbrs)
+
+	executor := execute.NewExecutor(strs.SessionEnvFileName, "<bootstrap>", "<entry>")
+	cc.Executor = executor
+
+	// Modules and env loaders
+	var bootstrap []string
+	for _, path := range [][]string{
+		{"B", "E", "L", "R"},
+		{"B", "M", "L", "E"},
+		{"B", "E", "L", "L"},
+		{"B", "M", "L", "F"},
+		{"B", "M", "L", "H"},
+		{"B", "E", "L", "O"},
+		{"B", "D", "L", "P"},
+		{"B", "M", "L", "A"},
+	} {
+		bootstrap = append(bootstrap, strings.Join(path, strs.CmdPathSep))
+	}
+
+	return &TiCat{
+		strs,
+		cc,
+		strings.Join(bootstrap, " "+strs.SequenceSep+" "),
+		executor,
+	}
+}
+
+// The command tree, register extra commands to it before running
+func (self *TiCat) Cmds() *core.CmdTree {
+	return self.Cli.Cmds
+}
+
+// The default layer of the env, set extra default values to it before running
+func (self *TiCat) DefaultEnv() *core.Env {
+	return self.Cli.GlobalEnv.GetLayer(core.EnvLayerDefault)
+}
+
+// Run bootstrap and then the input, the input is the same as the command line args of ticat.
+// The result is the exit code: 0 if succeeded, 1 if failed, -1 if an error panicked and recovered
+func (self *TiCat) Run(input ...string) (exitCode int) {
+	// The rpc helpers and workers started and the versions probed in this session
+	defer self.Cli.RpcHelpers.Close()
+	defer self.Cli.ModWorkers.Close()
+	defer self.Cli.VersionProbes.Clear()
+
+	// TODO: handle error by types
+	defer func() {
+		if !self.Cli.GlobalEnv.GetBool("sys.panic.recover") {
+			return
+		}
+		if r := recover(); r != nil {
+			display.PrintError(self.Cli, self.Cli.GlobalEnv, r.(error))
+			exitCode = -1
+		}
+	}()
+	if !self.executor.Run(self.Cli, self.Bootstrap, input...) {
+		return 1
+	}
+	return 0
+}
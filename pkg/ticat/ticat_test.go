@@ -0,0 +1,106 @@
+package ticat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/ticat/pkg/cli/core"
+	"github.com/pingcap/ticat/pkg/cli/display"
+)
+
+func TestRun(t *testing.T) {
+	dataDir := t.TempDir()
+	screen := display.NewCacheScreen()
+	tc := NewTiCatEx(NewStrs("mytool"), screen, dataDir)
+	tc.DefaultEnv().SetBool("display.color", false)
+
+	hello := func(argv core.ArgVals, cc *core.Cli, env *core.Env, flow *core.ParsedCmds, currCmdIdx int) (int, bool) {
+		cc.Screen.Print("hello " + argv.GetRaw("name") + "\n")
+		return currCmdIdx, true
+	}
+	failed := func(argv core.ArgVals, cc *core.Cli, env *core.Env, flow *core.ParsedCmds, currCmdIdx int) (int, bool) {
+		return currCmdIdx, false
+	}
+	broken := func(argv core.ArgVals, cc *core.Cli, env *core.Env, flow *core.ParsedCmds, currCmdIdx int) (int, bool) {
+		panic(fmt.Errorf("broken"))
+	}
+	tc.Cmds().AddSub("hello").RegPowerCmd(hello, "say hello").AddArg("name", "world", "n")
+	tc.Cmds().AddSub("failed").RegPowerCmd(failed, "always fail")
+	tc.Cmds().AddSub("broken").RegPowerCmd(broken, "always panic")
+
+	output := func() string {
+		var texts []string
+		screen.WriteToEx(&core.QuietScreen{}, func(text string, isError bool, textLen int) (string, bool) {
+			texts = append(texts, text)
+			return text, isError
+		})
+		return strings.Join(texts, "")
+	}
+
+	test := func(exitCode int, input ...string) {
+		res := tc.Run(input...)
+		if res != exitCode {
+			t.Fatalf("%#v: exit code %#v != %#v\n", input, res, exitCode)
+		}
+	}
+
+	test(0, "hello", "name=ticat")
+	if !strings.Contains(output(), "hello ticat\n") {
+		t.Fatalf("output of the registered command should be in the screen: %#v\n", output())
+	}
+	test(1, "failed")
+	test(-1, "broken")
+
+	if _, err := os.Stat(filepath.Join(dataDir, "sessions")); err != nil {
+		t.Fatalf("sessions should be saved in the data dir: %v\n", err)
+	}
+
+	// Each run in the same process is a session, they should all be kept
+	sessions, _ := filepath.Glob(filepath.Join(dataDir, "sessions", "*", tc.DefaultEnv().GetRaw("strs.session-env-file")))
+	if len(sessions) != 3 {
+		t.Fatalf("the env of each run should be saved: %#v\n", sessions)
+	}
+	marks, _ := filepath.Glob(filepath.Join(dataDir, "sessions", "*", "finished"))
+	if len(marks) != 3 {
+		t.Fatalf("each run should be marked finished: %#v\n", marks)
+	}
+}
+
+func TestRunScopedFlow(t *testing.T) {
+	screen := display.NewCacheScreen()
+	tc := NewTiCatEx(NewStrs("mytool"), screen, t.TempDir())
+	tc.DefaultEnv().SetBool("display.color", false)
+
+	write := func(argv core.ArgVals, cc *core.Cli, env *core.Env, flow *core.ParsedCmds, currCmdIdx int) (int, bool) {
+		env.GetLayer(core.EnvLayerSession).Set("x.written", "1")
+		env.GetLayer(core.EnvLayerSession).Set("discarded", "1")
+		return currCmdIdx, true
+	}
+	var reads []string
+	read := func(argv core.ArgVals, cc *core.Cli, env *core.Env, flow *core.ParsedCmds, currCmdIdx int) (int, bool) {
+		reads = append(reads, fmt.Sprintf("x.by-cmd=%s x.written=%s discarded=%s",
+			env.GetRaw("x.by-cmd"), env.GetRaw("x.written"), env.GetRaw("discarded")))
+		return currCmdIdx, true
+	}
+	tc.Cmds().AddSub("write").RegPowerCmd(write, "write env")
+	tc.Cmds().AddSub("read").RegPowerCmd(read, "read env")
+	tc.Cmds().AddSub("x").AddSub("scoped").RegFlowCmd([]string{"write", ":", "read"}, "scoped flow").SetScoped("x.")
+
+	res := tc.Run("{x.by-cmd=0}", ":", "x{by-cmd=1}.scoped", ":", "read")
+	if res != 0 {
+		t.Fatalf("exit code %#v != 0\n", res)
+	}
+	expected := []string{
+		// The values of the command layer are visible in the scoped flow
+		"x.by-cmd=1 x.written=1 discarded=1",
+		// Only the exported keys written by the flow are kept
+		"x.by-cmd=0 x.written=1 discarded=",
+	}
+	if !reflect.DeepEqual(reads, expected) {
+		t.Fatalf("%#v != %#v\n", reads, expected)
+	}
+}